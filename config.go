@@ -0,0 +1,266 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// defaultConfigFile is loaded from the working directory if the -config
+// option isn't specified.
+const defaultConfigFile = "sql-migrate.toml"
+
+// configKeys are the options that can be set in the config file. The keys
+// are the same as the names of the options.
+var configKeys = []string{"driver", "dsn", "migrations_table", "dir", "fwd", "bwd", "notx", "ext", "id_scheme"}
+
+// config is the contents of a config file. The top-level values are shared
+// by the named environments of the [env.<name>] tables.
+type config struct {
+	Values map[string]string
+	Envs   map[string]map[string]string
+}
+
+// parseConfig parses the contents of a config file. The relative dir values
+// are relative to the directory of the config file.
+func parseConfig(path, data string) (*config, error) {
+	var raw map[string]interface{}
+	if _, err := toml.Decode(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing config file %q: %s", path, err)
+	}
+
+	cfg := &config{Envs: map[string]map[string]string{}}
+	var envs map[string]interface{}
+	if v, ok := raw["env"]; ok {
+		delete(raw, "env")
+		if envs, ok = v.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("error parsing config file %q: env must be a table of environments", path)
+		}
+	}
+	values, err := configValues(path, "", raw)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Values = values
+	for name, v := range envs {
+		table, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error parsing config file %q: env.%s must be a table", path, name)
+		}
+		if cfg.Envs[name], err = configValues(path, "env."+name+".", table); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+func configValues(path, prefix string, table map[string]interface{}) (map[string]string, error) {
+	values := make(map[string]string, len(table))
+	for key, v := range table {
+		if !isConfigKey(key) {
+			return nil, fmt.Errorf("error parsing config file %q: invalid key %s%s (valid keys: %s)",
+				path, prefix, key, strings.Join(configKeys, ", "))
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("error parsing config file %q: %s%s must be a string", path, prefix, key)
+		}
+		if key == "dir" && !filepath.IsAbs(s) {
+			s = filepath.Join(filepath.Dir(path), s)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
+
+func isConfigKey(key string) bool {
+	for _, k := range configKeys {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// envValues returns the top-level values overridden by the values of the
+// named environment. The top-level values are returned if env is empty.
+func (o *config) envValues(env string) (map[string]string, error) {
+	values := make(map[string]string, len(configKeys))
+	for k, v := range o.Values {
+		values[k] = v
+	}
+	if env == "" {
+		return values, nil
+	}
+	envValues, ok := o.Envs[env]
+	if !ok {
+		names := make([]string, 0, len(o.Envs))
+		for name := range o.Envs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("environment %q isn't defined in the config file (defined environments: %s)", env, strings.Join(names, ", "))
+	}
+	for k, v := range envValues {
+		values[k] = v
+	}
+	return values, nil
+}
+
+// addConfigFlags adds the -config and -env options. It is called by the
+// functions that add the options that can be set in the config file.
+func addConfigFlags(fs *flag.FlagSet) {
+	if fs.Lookup("config") != nil {
+		return
+	}
+	fs.String("config", "", "The config file that provides the defaults of the options. Default: "+defaultConfigFile+" in the working directory if it exists.")
+	fs.String("env", "", "The name of the environment to use from the [env.<name>] tables of the config file.")
+	bindEnvVars(fs, "config", "env")
+}
+
+// envVarPrefix is the prefix of the environment variables of the options.
+const envVarPrefix = "SQL_MIGRATE_"
+
+// envBoundFlags contains the names of the options that can be set with
+// environment variables. The options are bound by the functions that add
+// them to the flag set.
+var envBoundFlags = map[*flag.FlagSet]map[string]bool{}
+
+// envVarName returns the name of the environment variable of an option
+// (e.g.: SQL_MIGRATE_MIGRATIONS_TABLE for -migrations_table).
+func envVarName(flagName string) string {
+	return envVarPrefix + strings.ToUpper(flagName)
+}
+
+// bindEnvVars allows setting the options with environment variables and
+// adds the name of the environment variable to the usage of the options.
+func bindEnvVars(fs *flag.FlagSet, names ...string) {
+	bound := envBoundFlags[fs]
+	if bound == nil {
+		bound = make(map[string]bool)
+		envBoundFlags[fs] = bound
+	}
+	for _, name := range names {
+		if bound[name] {
+			continue
+		}
+		bound[name] = true
+		f := fs.Lookup(name)
+		f.Usage += " Environment variable: " + envVarName(name) + "."
+	}
+}
+
+// cmdLineFlags contains the names of the options that have been specified on
+// the command line. fs.Visit can't tell them apart after parseFlags because
+// it also visits the options set from environment variables and the config
+// file.
+var cmdLineFlags = map[*flag.FlagSet]map[string]bool{}
+
+// parseFlags parses the args and sets the options that haven't been
+// specified on the command line from environment variables and then from
+// the config file.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	specified := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		specified[f.Name] = true
+	})
+	cmdLineFlags[fs] = specified
+	if err := setUnspecifiedFlags(fs, envValues(envBoundFlags[fs], os.LookupEnv)); err != nil {
+		log.Printf("%s (environment variables)", err)
+		os.Exit(1)
+	}
+	if fs.Lookup("config") == nil {
+		return
+	}
+	values, err := loadConfigValues(fs.Lookup("config").Value.String(), fs.Lookup("env").Value.String())
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	if err := setUnspecifiedFlags(fs, values); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
+
+// envValues returns the values of the set environment variables of the
+// bound options.
+func envValues(bound map[string]bool, lookupEnv func(string) (string, bool)) map[string]string {
+	values := make(map[string]string)
+	for name := range bound {
+		if v, ok := lookupEnv(envVarName(name)); ok {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+// expandEnvVars replaces the ${VAR} references with the values of the
+// environment variables. Unlike os.ExpandEnv it leaves $VAR intact because
+// DSNs can contain dollar signs (e.g.: in passwords).
+func expandEnvVars(s string, lookupEnv func(string) (string, bool)) (string, error) {
+	var err error
+	result := envVarRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		v, ok := lookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("undefined environment variable: %s", name)
+		}
+		return v
+	})
+	return result, err
+}
+
+var envVarRefRegex = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// loadConfigValues loads the values of the environment from the config file.
+// It returns nil without error if the config file isn't specified and the
+// default config file doesn't exist.
+func loadConfigValues(path, env string) (map[string]string, error) {
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			if env != "" {
+				return nil, fmt.Errorf("the -env option requires a config file (use the -config option or create %s)", defaultConfigFile)
+			}
+			return nil, nil
+		}
+		path = defaultConfigFile
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config file: %s", err)
+	}
+	cfg, err := parseConfig(path, string(data))
+	if err != nil {
+		return nil, err
+	}
+	return cfg.envValues(env)
+}
+
+// setUnspecifiedFlags sets the flags of the values that haven't been
+// specified on the command line. The values of the options that aren't
+// defined by fs are ignored.
+func setUnspecifiedFlags(fs *flag.FlagSet, values map[string]string) error {
+	specified := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		specified[f.Name] = true
+	})
+	for name, value := range values {
+		if specified[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for the -%s option: %s", value, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultIDWidth is the zero-padded width of the ID of the first migration.
+const defaultIDWidth = 4
+
+// timestampIDFormat is the format of the new IDs of the IDSchemeTimestamp.
+const timestampIDFormat = "20060102150405"
+
+// nextMigrationID returns the ID string of the next migration:
+//   - sequential: the latest ID plus one with the zero-padding width of the
+//     latest ID
+//   - timestamp: the current UTC time (or the latest ID plus one if it isn't
+//     greater than the latest ID)
+//   - semver: the latest version with its last component incremented
+func nextMigrationID(ms *Migrations, now time.Time) string {
+	var last *ParsedFilename
+	if len(ms.Sorted) != 0 {
+		last = ms.Sorted[len(ms.Sorted)-1].Forward.ParsedFilename
+	}
+
+	switch ms.IDScheme {
+	case IDSchemeTimestamp:
+		id := now.UTC().Format(timestampIDFormat)
+		if last != nil {
+			if n, err := strconv.ParseInt(id, 10, 64); err == nil && n <= last.ID {
+				id = strconv.FormatInt(last.ID+1, 10)
+			}
+		}
+		return id
+	case IDSchemeSemver:
+		if last == nil {
+			return semverPrefix + "1"
+		}
+		version := last.Version
+		next := strings.Split(strings.TrimPrefix(last.IDStr, semverPrefix), ".")
+		next[len(next)-1] = strconv.FormatInt(version[len(version)-1]+1, 10)
+		return semverPrefix + strings.Join(next, ".")
+	default:
+		if last == nil {
+			return fmt.Sprintf("%0*d", defaultIDWidth, 1)
+		}
+		return fmt.Sprintf("%0*d", len(last.IDStr), last.ID+1)
+	}
+}
+
+// descriptionSeparator returns the separator between the ID and the
+// description of the filenames created by the create command. Flyway uses
+// double underscores after versions.
+func (o IDScheme) descriptionSeparator() string {
+	if o == IDSchemeSemver {
+		return "__"
+	}
+	return "_"
+}
+
+// newMigrationFilename returns the filename of a step of a new migration.
+// The filename is parsed back to make sure that the description doesn't
+// confuse parseFilename (e.g.: it doesn't end with a suffix).
+func newMigrationFilename(scheme IDScheme, idStr, desc string, direction Direction, noTx bool, fwd, bwd, notx, ext string) (string, error) {
+	if strings.ContainsAny(desc, `/\`) {
+		return "", fmt.Errorf("the description can't contain path separators: %q", desc)
+	}
+	description := ""
+	if desc != "" {
+		description = scheme.descriptionSeparator() + desc
+	}
+	fn := idStr + description
+	if noTx {
+		fn += notx
+	}
+	if direction == DirectionForward {
+		fn += fwd
+	} else {
+		fn += bwd
+	}
+	fn += ext
+
+	parsed, err := scheme.parseFilename(fn, fwd, bwd, notx, ext)
+	if err != nil {
+		return "", fmt.Errorf("can't create a valid %s migration filename (%q): %s", direction, fn, err)
+	}
+	if parsed.Description != description || parsed.Direction != direction || parsed.NoTx != noTx {
+		return "", fmt.Errorf("can't create a valid %s migration filename (%q) with the description %q and the configured suffixes",
+			direction, fn, desc)
+	}
+	return fn, nil
+}
+
+// createMigrationFiles creates the empty step files of a new migration and
+// returns their paths. It doesn't overwrite existing files.
+func createMigrationFiles(dir string, ms *Migrations, desc string, backward, noTx bool, fwd, bwd, notx, ext string) ([]string, error) {
+	idStr := nextMigrationID(ms, time.Now())
+	directions := []Direction{DirectionForward}
+	if backward {
+		directions = append(directions, DirectionBackward)
+	}
+
+	var filenames []string
+	for _, d := range directions {
+		fn, err := newMigrationFilename(ms.IDScheme, idStr, desc, d, noTx, fwd, bwd, notx, ext)
+		if err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, fn)
+	}
+
+	var paths []string
+	for _, fn := range filenames {
+		path := filepath.Join(dir, fn)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return paths, err
+		}
+		if err := f.Close(); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
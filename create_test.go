@@ -0,0 +1,112 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextMigrationID(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	newMigrations := func(scheme IDScheme, filenames ...string) *Migrations {
+		ms, err := loadMigrationsDir("", scheme, "", ".back", ".notx", ".sql", func(string) []string {
+			return filenames
+		})
+		require.NoError(t, err)
+		return ms
+	}
+
+	t.Run("sequential", func(t *testing.T) {
+		assert.Equal(t, "0001", nextMigrationID(newMigrations(IDSchemeSequential), now))
+		assert.Equal(t, "0010", nextMigrationID(newMigrations(IDSchemeSequential,
+			"0001.sql", "0002.sql", "0003.sql", "0004.sql", "0005.sql", "0006.sql", "0007.sql", "0008.sql", "0009.sql"), now))
+		assert.Equal(t, "3", nextMigrationID(newMigrations(IDSchemeSequential, "1.sql", "2.sql"), now))
+		assert.Equal(t, "003", nextMigrationID(newMigrations(IDSchemeSequential, "1.sql", "002.sql"), now))
+	})
+
+	t.Run("timestamp", func(t *testing.T) {
+		assert.Equal(t, "20261016100000", nextMigrationID(newMigrations(IDSchemeTimestamp), now))
+		assert.Equal(t, "20261016100000", nextMigrationID(newMigrations(IDSchemeTimestamp, "20261015000000.sql"), now))
+		assert.Equal(t, "20261017000001", nextMigrationID(newMigrations(IDSchemeTimestamp, "20261017000000.sql"), now))
+	})
+
+	t.Run("semver", func(t *testing.T) {
+		assert.Equal(t, "V1", nextMigrationID(newMigrations(IDSchemeSemver), now))
+		assert.Equal(t, "V1.2.4", nextMigrationID(newMigrations(IDSchemeSemver, "V1.sql", "V1.2.3__x.sql"), now))
+		assert.Equal(t, "V2.10", nextMigrationID(newMigrations(IDSchemeSemver, "V2.009.sql"), now))
+	})
+}
+
+func TestNewMigrationFilename(t *testing.T) {
+	for _, tc := range []struct {
+		desc      string
+		direction Direction
+		noTx      bool
+		fwd, bwd  string
+		expected  string
+	}{
+		{"add_users", DirectionForward, false, "", ".back", "0002_add_users.sql"},
+		{"add_users", DirectionBackward, false, "", ".back", "0002_add_users.back.sql"},
+		{"", DirectionForward, true, "", ".back", "0002.notx.sql"},
+		{"", DirectionBackward, true, "", ".back", "0002.notx.back.sql"},
+		{"x", DirectionForward, true, ".fw", ".bw", "0002_x.notx.fw.sql"},
+		{"x", DirectionBackward, false, ".fw", "", "0002_x.sql"},
+	} {
+		fn, err := newMigrationFilename(IDSchemeSequential, "0002", tc.desc, tc.direction, tc.noTx, tc.fwd, tc.bwd, ".notx", ".sql")
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, fn)
+	}
+
+	fn, err := newMigrationFilename(IDSchemeSemver, "V1.2", "add_users", DirectionForward, false, "", ".back", ".notx", ".sql")
+	require.NoError(t, err)
+	assert.Equal(t, "V1.2__add_users.sql", fn)
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := newMigrationFilename(IDSchemeSequential, "0002", "a/b", DirectionForward, false, "", ".back", ".notx", ".sql")
+		assert.EqualError(t, err, `the description can't contain path separators: "a/b"`)
+
+		_, err = newMigrationFilename(IDSchemeSequential, "0002", "users.back", DirectionForward, false, "", ".back", ".notx", ".sql")
+		assert.EqualError(t, err, `can't create a valid forward migration filename ("0002_users.back.sql") `+
+			`with the description "users.back" and the configured suffixes`)
+
+		_, err = newMigrationFilename(IDSchemeSequential, "0002", "", DirectionBackward, false, "", "", ".notx", ".sql")
+		assert.Error(t, err)
+	})
+}
+
+func TestCreateMigrationFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-migrate-create")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ms := &Migrations{}
+	paths, err := createMigrationFiles(dir, ms, "init", true, false, "", ".back", ".notx", ".sql")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "0001_init.sql"), filepath.Join(dir, "0001_init.back.sql")}, paths)
+
+	ms, err = loadMigrationsDir(dir, IDSchemeSequential, "", ".back", ".notx", ".sql", func(dir string) []string {
+		return []string{"0001_init.sql", "0001_init.back.sql"}
+	})
+	require.NoError(t, err)
+	paths, err = createMigrationFiles(dir, ms, "", false, true, "", ".back", ".notx", ".sql")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "0002.notx.sql")}, paths)
+
+	// Existing files aren't overwritten.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "0003_x.back.sql"), []byte("x"), 0666))
+	ms.Sorted = append(ms.Sorted, &Migration{Forward: &Step{ParsedFilename: &ParsedFilename{ID: 2, IDStr: "0002"}}})
+	paths, err = createMigrationFiles(dir, ms, "x", true, false, "", ".back", ".notx", ".sql")
+	assert.Error(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "0003_x.sql")}, paths)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "0003_x.back.sql"))
+	require.NoError(t, err)
+	assert.Equal(t, "x", string(contents))
+}
@@ -0,0 +1,530 @@
+//go:build !custom || (custom && cassandra)
+// +build !custom custom,cassandra
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+func init() {
+	drivers["cassandra"] = newCassandraDriver
+	driverCapabilities["cassandra"] = (&cassandraDriver{}).Capabilities
+}
+
+const (
+	cassandraDSNPrefix                     = "cassandra://"
+	defaultCassandraTimeout                = 10 * time.Second
+	defaultCassandraSchemaAgreementTimeout = time.Minute
+)
+
+var cassandraSplitter = &sqlSplitter{
+	LineComments: []string{"--", "//"},
+	QuoteChars:   `'"`,
+	DollarQuotes: true,
+}
+
+// cassandraConfig is the parsed form of a cassandra DSN:
+// cassandra://[user[:password]@]host1[:port][,host2[:port]...]/keyspace[?params]
+//
+// Supported params:
+// consistency (default: quorum), timeout (default: 10s),
+// schema_agreement_timeout (default: 1m).
+type cassandraConfig struct {
+	Hosts                  []string
+	Username               string
+	Password               string
+	Keyspace               string
+	Consistency            string
+	Timeout                time.Duration
+	SchemaAgreementTimeout time.Duration
+}
+
+func parseCassandraDSN(dsn string) (*cassandraConfig, error) {
+	if !strings.HasPrefix(dsn, cassandraDSNPrefix) {
+		return nil, fmt.Errorf("the DSN has to start with %q", cassandraDSNPrefix)
+	}
+	s := strings.TrimPrefix(dsn, cassandraDSNPrefix)
+
+	cfg := &cassandraConfig{
+		Consistency:            "quorum",
+		Timeout:                defaultCassandraTimeout,
+		SchemaAgreementTimeout: defaultCassandraSchemaAgreementTimeout,
+	}
+
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		params, err := url.ParseQuery(s[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid DSN params: %s", err)
+		}
+		s = s[:i]
+		for key := range params {
+			value := params.Get(key)
+			switch key {
+			case "consistency":
+				cfg.Consistency = value
+			case "timeout", "schema_agreement_timeout":
+				d, err := time.ParseDuration(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s DSN param: %q", key, value)
+				}
+				if key == "timeout" {
+					cfg.Timeout = d
+				} else {
+					cfg.SchemaAgreementTimeout = d
+				}
+			default:
+				return nil, fmt.Errorf("unknown DSN param: %q", key)
+			}
+		}
+	}
+
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		userInfo := s[:i]
+		s = s[i+1:]
+		password := ""
+		if j := strings.IndexByte(userInfo, ':'); j >= 0 {
+			userInfo, password = userInfo[:j], userInfo[j+1:]
+		}
+		var err error
+		if cfg.Username, err = url.PathUnescape(userInfo); err != nil {
+			return nil, fmt.Errorf("invalid DSN username: %s", err)
+		}
+		if cfg.Password, err = url.PathUnescape(password); err != nil {
+			return nil, fmt.Errorf("invalid DSN password: %s", err)
+		}
+	}
+
+	i := strings.IndexByte(s, '/')
+	if i < 0 || s[i+1:] == "" {
+		return nil, errors.New("missing keyspace from the DSN")
+	}
+	cfg.Keyspace = s[i+1:]
+	for _, host := range strings.Split(s[:i], ",") {
+		if host != "" {
+			cfg.Hosts = append(cfg.Hosts, host)
+		}
+	}
+	if len(cfg.Hosts) == 0 {
+		return nil, errors.New("missing hosts from the DSN")
+	}
+	return cfg, nil
+}
+
+func newCassandraDriver(dsn, tableName string) (Driver, error) {
+	cfg, err := parseCassandraDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	consistency, err := gocql.ParseConsistencyWrapper(cfg.Consistency)
+	if err != nil {
+		return nil, fmt.Errorf("invalid consistency: %q", cfg.Consistency)
+	}
+
+	cluster := gocql.NewCluster(cfg.Hosts...)
+	cluster.Keyspace = cfg.Keyspace
+	cluster.Consistency = consistency
+	cluster.Timeout = cfg.Timeout
+	cluster.ConnectTimeout = cfg.Timeout
+	if cfg.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: cfg.Username,
+			Password: cfg.Password,
+		}
+	}
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	return &cassandraDriver{
+		session: &cqlSessionWrapper{
+			session:                session,
+			schemaAgreementTimeout: cfg.SchemaAgreementTimeout,
+		},
+		tableName:        quoteCassandraIdentifier(tableName),
+		lockTableName:    quoteCassandraIdentifier(tableName + "_lock"),
+		versionTableName: quoteCassandraIdentifier(tableName + "_schema_version"),
+		historyTableName: quoteCassandraIdentifier(tableName + "_history"),
+		now:              time.Now,
+	}, nil
+}
+
+func quoteCassandraIdentifier(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// cassandraDriver stores the migration state in a table of the keyspace
+// specified in the DSN.
+//
+// Cassandra doesn't have transactions so the -notx suffix is ignored.
+// The state of a migration is updated with a lightweight transaction after
+// executing its statements one by one.
+//
+// The migration lock is a row in a lock table that is inserted and deleted
+// with lightweight transactions.
+type cassandraDriver struct {
+	session          CQLSession
+	tableName        string
+	lockTableName    string
+	versionTableName string
+	historyTableName string
+	now              func() time.Time
+
+	lockTableCreated bool
+	lockOwner        string
+}
+
+func (o *cassandraDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   false,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *cassandraDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	// CQL doesn't allow multiple statements per query.
+	for _, statement := range cassandraSplitter.Split(contents) {
+		if err := o.session.Exec(statement); err != nil {
+			return err
+		}
+		// Subsequent statements may depend on the schema change so we have
+		// to wait for all nodes to see it.
+		if isCassandraSchemaChange(statement) {
+			if err := o.session.AwaitSchemaAgreement(); err != nil {
+				return fmt.Errorf("error waiting for schema agreement: %s", err)
+			}
+		}
+	}
+	return o.SetMigrationState(st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *cassandraDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	return o.SetMigrationState(st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *cassandraDriver) SetMigrationState(migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	columns := `"name", "time"`
+	for _, c := range metadataColumns {
+		columns += ", " + quoteCassandraIdentifier(c.Name)
+	}
+	query := `INSERT INTO ` + o.tableName + ` (` + columns + `) VALUES (?, toTimestamp(now())` +
+		strings.Repeat(", ?", len(metadataColumns)) + `) IF NOT EXISTS`
+	args := insertMigrationArgs(migrationName, meta)
+	if !forwardMigrated {
+		query = `DELETE FROM ` + o.tableName + ` WHERE "name"=? IF EXISTS`
+		args = []interface{}{migrationName}
+	}
+	applied, err := o.session.ExecCAS(query, args...)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return fmt.Errorf("error setting state for migration %q in the migrations table (examine it with the status command and fix it manually)", migrationName)
+	}
+	return nil
+}
+
+func (o *cassandraDriver) CreateMigrationsTable() error {
+	err := o.session.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + o.tableName + ` (
+			"name" text PRIMARY KEY,
+			"time" timestamp
+		)`,
+	)
+	if err != nil {
+		return err
+	}
+	return o.session.AwaitSchemaAgreement()
+}
+
+// UpgradeMigrationsTable stores the versions as text in the version table
+// because the CQLSession can query only strings.
+func (o *cassandraDriver) UpgradeMigrationsTable() error {
+	err := o.session.Exec(`CREATE TABLE IF NOT EXISTS ` + o.versionTableName + ` ("version" text PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("error creating the version table of the migrations table: %s", err)
+	}
+	if err := o.session.AwaitSchemaAgreement(); err != nil {
+		return fmt.Errorf("error waiting for schema agreement: %s", err)
+	}
+	current, err := o.loadMigrationsTableVersion()
+	if err != nil {
+		return err
+	}
+
+	addColumn := func(c migrationsTableColumn) string {
+		typ := "text"
+		if c.Integer {
+			typ = "bigint"
+		}
+		return `ALTER TABLE ` + o.tableName + ` ADD ` + quoteCassandraIdentifier(c.Name) + ` ` + typ
+	}
+	for v := current + 1; v <= migrationsTableVersion; v++ {
+		for _, statement := range upgradeStatements(v, addColumn) {
+			if err := o.session.Exec(statement); err != nil {
+				return fmt.Errorf("error upgrading the migrations table to version %d (the upgrade may have been partially executed: examine the migrations table and fix it manually): %s", v, err)
+			}
+			if err := o.session.AwaitSchemaAgreement(); err != nil {
+				return fmt.Errorf("error waiting for schema agreement: %s", err)
+			}
+		}
+		if err := o.session.Exec(`INSERT INTO `+o.versionTableName+` ("version") VALUES (?)`, strconv.Itoa(v)); err != nil {
+			return fmt.Errorf("error upgrading the migrations table to version %d: %s", v, err)
+		}
+	}
+	return nil
+}
+
+// loadMigrationsTableVersion returns the version of the migrations table
+// without modifying the database. The version table is created by
+// UpgradeMigrationsTable so a missing version table means version 1.
+func (o *cassandraDriver) loadMigrationsTableVersion() (int, error) {
+	versions, err := o.session.QueryStrings(`SELECT "version" FROM ` + o.versionTableName)
+	if err != nil {
+		// The query fails if the version table doesn't exist. The migrations
+		// table is probed to tell it apart from other errors.
+		if o.probeMigrationsTable() != nil {
+			return 0, fmt.Errorf("error loading the version of the migrations table: %s", err)
+		}
+		return 1, nil
+	}
+	current := 1
+	for _, s := range versions {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid version in the version table of the migrations table: %q", s)
+		}
+		if v > current {
+			current = v
+		}
+	}
+	return current, nil
+}
+
+// probeMigrationsTable returns an error if the migrations table can't be
+// queried. It tells the missing version and history tables apart from other
+// errors (e.g.: connection errors).
+func (o *cassandraDriver) probeMigrationsTable() error {
+	_, err := o.session.QueryStrings(`SELECT "name" FROM ` + o.tableName + ` LIMIT 1`)
+	return err
+}
+
+// GetChecksums loads the names and the checksums with a single query. The
+// checksums of the migrations executed before the upgrade are empty.
+func (o *cassandraDriver) GetChecksums() (map[string]string, error) {
+	checksums := make(map[string]string)
+	version, err := o.loadMigrationsTableVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version < 2 {
+		return checksums, nil
+	}
+
+	rows, err := o.session.QueryStringRows(`SELECT "name", "checksum" FROM ` + o.tableName)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		checksums[row[0]] = row[1]
+	}
+	return checksums, nil
+}
+
+func (o *cassandraDriver) CreateHistoryTable() error {
+	err := o.session.Exec(`CREATE TABLE IF NOT EXISTS ` + o.historyTableName + ` (` +
+		historyColumnDefs(quoteCassandraIdentifier, "text PRIMARY KEY", "text", "text") + `)`)
+	if err != nil {
+		return fmt.Errorf("error creating history table: %s", err)
+	}
+	if err := o.session.AwaitSchemaAgreement(); err != nil {
+		return fmt.Errorf("error waiting for schema agreement: %s", err)
+	}
+	return nil
+}
+
+func (o *cassandraDriver) historyColumnList() string {
+	columns := make([]string, len(historyColumns))
+	for i, c := range historyColumns {
+		columns[i] = quoteCassandraIdentifier(c)
+	}
+	return strings.Join(columns, ", ")
+}
+
+func (o *cassandraDriver) RecordHistory(h *HistoryEntry) error {
+	query := `INSERT INTO ` + o.historyTableName + ` (` + o.historyColumnList() + `) VALUES (?` +
+		strings.Repeat(", ?", len(historyColumns)-1) + `)`
+	return o.session.Exec(query, h.Values()...)
+}
+
+func (o *cassandraDriver) LoadHistory() ([]*HistoryEntry, error) {
+	rows, err := o.session.QueryStringRows(`SELECT ` + o.historyColumnList() + ` FROM ` + o.historyTableName)
+	if err != nil {
+		if o.probeMigrationsTable() == nil {
+			return nil, errNoHistoryTable
+		}
+		return nil, err
+	}
+	entries := make([]*HistoryEntry, 0, len(rows))
+	for _, row := range rows {
+		h, err := newHistoryEntryFromValues(row)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, h)
+	}
+	sortHistory(entries)
+	return entries, nil
+}
+
+func (o *cassandraDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
+	rows, err := o.session.QueryStrings(`SELECT "name" FROM ` + o.tableName)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(rows))
+	for _, name := range rows {
+		names[name] = struct{}{}
+	}
+	return names, nil
+}
+
+func (o *cassandraDriver) Close() {
+	o.session.Close()
+}
+
+// createLockTableIfNeeded creates the lock table on demand
+// so the init command doesn't have to create it. Only TryLock creates it:
+// the lock isn't held if the lock table doesn't exist.
+func (o *cassandraDriver) createLockTableIfNeeded() error {
+	if o.lockTableCreated {
+		return nil
+	}
+	err := o.session.Exec(`CREATE TABLE IF NOT EXISTS ` + o.lockTableName + ` ("id" int PRIMARY KEY, "owner" text)`)
+	if err != nil {
+		return fmt.Errorf("error creating lock table: %s", err)
+	}
+	if err := o.session.AwaitSchemaAgreement(); err != nil {
+		return fmt.Errorf("error waiting for schema agreement: %s", err)
+	}
+	o.lockTableCreated = true
+	return nil
+}
+
+func (o *cassandraDriver) TryLock() (bool, error) {
+	if err := o.createLockTableIfNeeded(); err != nil {
+		return false, err
+	}
+	owner := lockOwner(o.now())
+	applied, err := o.session.ExecCAS(`INSERT INTO `+o.lockTableName+` ("id", "owner") VALUES (1, ?) IF NOT EXISTS`, owner)
+	if err != nil || !applied {
+		return false, err
+	}
+	o.lockOwner = owner
+	return true, nil
+}
+
+func (o *cassandraDriver) Unlock() error {
+	applied, err := o.session.ExecCAS(`DELETE FROM `+o.lockTableName+` WHERE "id"=1 IF "owner"=?`, o.lockOwner)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return fmt.Errorf("the migration lock of %s has been released by someone else", o.lockOwner)
+	}
+	return nil
+}
+
+func (o *cassandraDriver) LockStatus() (string, error) {
+	owners, err := o.session.QueryStrings(`SELECT "owner" FROM ` + o.lockTableName + ` WHERE "id"=1`)
+	if err != nil {
+		if !o.lockTableCreated && o.probeMigrationsTable() == nil {
+			return "", nil
+		}
+		return "", err
+	}
+	if len(owners) == 0 {
+		return "", nil
+	}
+	return owners[0], nil
+}
+
+func (o *cassandraDriver) ForceUnlock() error {
+	_, err := o.session.ExecCAS(`DELETE FROM ` + o.lockTableName + ` WHERE "id"=1 IF EXISTS`)
+	return err
+}
+
+// cassandraSchemaChangeRegexp matches statements that start with DDL
+// after optional comments.
+var cassandraSchemaChangeRegexp = regexp.MustCompile(`(?is)^(?:\s+|--[^\n]*|//[^\n]*|/\*.*?\*/)*(?:CREATE|ALTER|DROP)\b`)
+
+func isCassandraSchemaChange(statement string) bool {
+	return cassandraSchemaChangeRegexp.MatchString(statement)
+}
+
+// cqlSessionWrapper implements the CQLSession interface.
+type cqlSessionWrapper struct {
+	session                *gocql.Session
+	schemaAgreementTimeout time.Duration
+}
+
+func (o *cqlSessionWrapper) Exec(stmt string, values ...interface{}) error {
+	return o.session.Query(stmt, values...).Exec()
+}
+
+func (o *cqlSessionWrapper) ExecCAS(stmt string, values ...interface{}) (bool, error) {
+	return o.session.Query(stmt, values...).MapScanCAS(make(map[string]interface{}))
+}
+
+func (o *cqlSessionWrapper) QueryStrings(stmt string, values ...interface{}) ([]string, error) {
+	iter := o.session.Query(stmt, values...).Iter()
+	var result []string
+	var s string
+	for iter.Scan(&s) {
+		result = append(result, s)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (o *cqlSessionWrapper) QueryStringRows(stmt string, values ...interface{}) ([][]string, error) {
+	iter := o.session.Query(stmt, values...).Iter()
+	var result [][]string
+	for {
+		row := make([]string, len(iter.Columns()))
+		dest := make([]interface{}, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if !iter.Scan(dest...) {
+			break
+		}
+		result = append(result, row)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (o *cqlSessionWrapper) AwaitSchemaAgreement() error {
+	ctx, cancel := context.WithTimeout(context.Background(), o.schemaAgreementTimeout)
+	defer cancel()
+	return o.session.AwaitSchemaAgreement(ctx)
+}
+
+func (o *cqlSessionWrapper) Close() {
+	o.session.Close()
+}
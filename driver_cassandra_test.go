@@ -0,0 +1,502 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassandraDriver(t *testing.T) {
+	const tableName = `"migrations"`
+	lockTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	newDriver := func(ctrl *gomock.Controller) (*cassandraDriver, *MockCQLSession) {
+		session := NewMockCQLSession(ctrl)
+		return &cassandraDriver{
+			session:          session,
+			tableName:        tableName,
+			lockTableName:    `"migrations_lock"`,
+			versionTableName: `"migrations_schema_version"`,
+			historyTableName: `"migrations_history"`,
+			now:              func() time.Time { return lockTime },
+		}, session
+	}
+
+	newTestStep := func(migrationName, filename string) *Step {
+		parsed, err := parseFilename(filename, ".fw", ".bw", ".nt", ".cql")
+		if err != nil {
+			panic(err)
+		}
+		return &Step{
+			Filename:       filename,
+			MigrationName:  migrationName,
+			ParsedFilename: parsed,
+		}
+	}
+
+	t.Run("ExecuteStep", func(t *testing.T) {
+		const contents = "CREATE TABLE t (id int PRIMARY KEY, s text);\n" +
+			"INSERT INTO t (id, s) VALUES (1, 'a;b');\n" +
+			"-- comment\nALTER TABLE t ADD n int;\n"
+
+		t.Run("forward", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().Exec("CREATE TABLE t (id int PRIMARY KEY, s text)"),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().Exec("INSERT INTO t (id, s) VALUES (1, 'a;b')"),
+				session.EXPECT().Exec("-- comment\nALTER TABLE t ADD n int"),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().ExecCAS(`INSERT INTO "migrations" ("name", "time", "checksum", "duration_ms", "sql_migrate_version", "os_user", "hostname", "applied_by") `+
+					`VALUES (?, toTimestamp(now()), ?, ?, ?, ?, ?, ?) IF NOT EXISTS`, testMetadataArgs("0001")...).Return(true, nil),
+			)
+
+			err := driver.ExecuteStep(newTestStep("0001", "1.fw.cql"), contents, testMetadata)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("backward", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().Exec("DROP TABLE t"),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().ExecCAS(`DELETE FROM "migrations" WHERE "name"=? IF EXISTS`, "0001").Return(true, nil),
+			)
+
+			err := driver.ExecuteStep(newTestStep("0001", "1.bw.cql"), "DROP TABLE t;", testMetadata)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("statement error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			session.EXPECT().Exec("CREATE TABLE t (id int PRIMARY KEY, s text)").Return(assert.AnError)
+
+			err := driver.ExecuteStep(newTestStep("0001", "1.fw.cql"), contents, testMetadata)
+			require.Equal(t, assert.AnError, err)
+			ctrl.Finish()
+		})
+
+		t.Run("schema agreement error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().Exec("DROP TABLE t"),
+				session.EXPECT().AwaitSchemaAgreement().Return(assert.AnError),
+			)
+
+			err := driver.ExecuteStep(newTestStep("0001", "1.bw.cql"), "DROP TABLE t;", testMetadata)
+			require.EqualError(t, err, "error waiting for schema agreement: "+assert.AnError.Error())
+			ctrl.Finish()
+		})
+
+		t.Run("state not applied", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().Exec("SELECT now() FROM system.local"),
+				session.EXPECT().ExecCAS(gomock.Any(), testMetadataArgs("0001")...).Return(false, nil),
+			)
+
+			err := driver.ExecuteStep(newTestStep("0001", "1.fw.cql"), "SELECT now() FROM system.local;", testMetadata)
+			require.EqualError(t, err, `error setting state for migration "0001" in the migrations table (examine it with the status command and fix it manually)`)
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("CreateMigrationsTable", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, session := newDriver(ctrl)
+
+		gomock.InOrder(
+			session.EXPECT().Exec(gomock.Any()).Do(func(query string, args ...interface{}) {
+				assert.Contains(t, query, `CREATE TABLE IF NOT EXISTS "migrations" (`)
+			}),
+			session.EXPECT().AwaitSchemaAgreement(),
+		)
+
+		err := driver.CreateMigrationsTable()
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("UpgradeMigrationsTable", func(t *testing.T) {
+		t.Run("from version 1", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			calls := []*gomock.Call{
+				session.EXPECT().Exec(`CREATE TABLE IF NOT EXISTS "migrations_schema_version" ("version" text PRIMARY KEY)`),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().QueryStrings(`SELECT "version" FROM "migrations_schema_version"`),
+			}
+			for _, c := range []string{`"checksum" text`, `"duration_ms" bigint`, `"sql_migrate_version" text`, `"os_user" text`, `"hostname" text`, `"applied_by" text`} {
+				calls = append(calls,
+					session.EXPECT().Exec(`ALTER TABLE "migrations" ADD `+c),
+					session.EXPECT().AwaitSchemaAgreement(),
+				)
+			}
+			calls = append(calls, session.EXPECT().Exec(`INSERT INTO "migrations_schema_version" ("version") VALUES (?)`, "2"))
+			gomock.InOrder(calls...)
+
+			err := driver.UpgradeMigrationsTable()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("up to date", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().Exec(gomock.Any()),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().QueryStrings(gomock.Any()).Return([]string{"2"}, nil),
+			)
+
+			err := driver.UpgradeMigrationsTable()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("invalid version", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().Exec(gomock.Any()),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().QueryStrings(gomock.Any()).Return([]string{"x"}, nil),
+			)
+
+			err := driver.UpgradeMigrationsTable()
+			require.EqualError(t, err, `invalid version in the version table of the migrations table: "x"`)
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("GetChecksums", func(t *testing.T) {
+		t.Run("version 2", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().QueryStrings(`SELECT "version" FROM "migrations_schema_version"`).Return([]string{"2"}, nil),
+				session.EXPECT().QueryStringRows(`SELECT "name", "checksum" FROM "migrations"`).Return([][]string{{"0001", "abc"}, {"0002", ""}}, nil),
+			)
+
+			checksums, err := driver.GetChecksums()
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"0001": "abc", "0002": ""}, checksums)
+			ctrl.Finish()
+		})
+
+		t.Run("version 1", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			session.EXPECT().QueryStrings(gomock.Any())
+
+			checksums, err := driver.GetChecksums()
+			require.NoError(t, err)
+			assert.Empty(t, checksums)
+			ctrl.Finish()
+		})
+
+		t.Run("missing version table", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().QueryStrings(`SELECT "version" FROM "migrations_schema_version"`).Return(nil, errors.New("unconfigured table")),
+				session.EXPECT().QueryStrings(`SELECT "name" FROM "migrations" LIMIT 1`),
+			)
+
+			checksums, err := driver.GetChecksums()
+			require.NoError(t, err)
+			assert.Empty(t, checksums)
+			ctrl.Finish()
+		})
+
+		t.Run("query error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().QueryStrings(`SELECT "version" FROM "migrations_schema_version"`).Return(nil, errors.New("test")),
+				session.EXPECT().QueryStrings(`SELECT "name" FROM "migrations" LIMIT 1`).Return(nil, errors.New("no connection")),
+			)
+
+			_, err := driver.GetChecksums()
+			assert.EqualError(t, err, "error loading the version of the migrations table: test")
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("history", func(t *testing.T) {
+		const columns = `"id", "migration_name", "filename", "direction", "status", "started_at", "finished_at", "error", "os_user", "hostname", "applied_by"`
+
+		t.Run("CreateHistoryTable", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().Exec(gomock.Any()).Do(func(query string, args ...interface{}) {
+					assert.Contains(t, query, `CREATE TABLE IF NOT EXISTS "migrations_history" ("id" text PRIMARY KEY, `)
+				}),
+				session.EXPECT().AwaitSchemaAgreement(),
+			)
+
+			err := driver.CreateHistoryTable()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("RecordHistory", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+			h := &HistoryEntry{ID: "id"}
+
+			session.EXPECT().Exec(`INSERT INTO "migrations_history" (`+columns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, h.Values()...)
+
+			err := driver.RecordHistory(h)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("LoadHistory", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+			row := func(id string) []string {
+				return []string{id, "1", "1.fw.cql", "forward", "succeeded",
+					"2020-01-02T03:04:05.000000Z", "2020-01-02T03:04:06.000000Z", "", "user", "host", ""}
+			}
+
+			session.EXPECT().QueryStringRows(`SELECT `+columns+` FROM "migrations_history"`).Return([][]string{row("b"), row("a")}, nil)
+
+			entries, err := driver.LoadHistory()
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			assert.Equal(t, "a", entries[0].ID)
+			assert.Equal(t, "b", entries[1].ID)
+			assert.Equal(t, time.Second, entries[0].EndTime.Sub(entries[0].StartTime))
+			ctrl.Finish()
+		})
+
+		t.Run("LoadHistory without history table", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().QueryStringRows(gomock.Any()).Return(nil, errors.New("unconfigured table")),
+				session.EXPECT().QueryStrings(`SELECT "name" FROM "migrations" LIMIT 1`),
+			)
+
+			_, err := driver.LoadHistory()
+			assert.Equal(t, errNoHistoryTable, err)
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("GetForwardMigratedNames", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, session := newDriver(ctrl)
+
+		session.EXPECT().QueryStrings(`SELECT "name" FROM "migrations"`).Return([]string{"0001", "0002"}, nil)
+
+		names, err := driver.GetForwardMigratedNames()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]struct{}{"0001": {}, "0002": {}}, names)
+		ctrl.Finish()
+	})
+
+	t.Run("Locker", func(t *testing.T) {
+		const insertLock = `INSERT INTO "migrations_lock" ("id", "owner") VALUES (1, ?) IF NOT EXISTS`
+		owner := lockOwner(lockTime)
+
+		expectCreateLockTable := func(session *MockCQLSession) *gomock.Call {
+			return session.EXPECT().Exec(`CREATE TABLE IF NOT EXISTS "migrations_lock" ("id" int PRIMARY KEY, "owner" text)`)
+		}
+
+		t.Run("lock and unlock", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				expectCreateLockTable(session),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().ExecCAS(insertLock, owner).Return(true, nil),
+				session.EXPECT().ExecCAS(`DELETE FROM "migrations_lock" WHERE "id"=1 IF "owner"=?`, owner).Return(true, nil),
+			)
+
+			ok, err := driver.TryLock()
+			require.NoError(t, err)
+			assert.True(t, ok)
+			err = driver.Unlock()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("held by someone else", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				expectCreateLockTable(session),
+				session.EXPECT().AwaitSchemaAgreement(),
+				session.EXPECT().ExecCAS(insertLock, owner).Return(false, nil),
+				session.EXPECT().ExecCAS(insertLock, owner).Return(false, nil),
+				session.EXPECT().QueryStrings(`SELECT "owner" FROM "migrations_lock" WHERE "id"=1`).Return([]string{"other"}, nil),
+			)
+
+			// The lock table is created only once.
+			for i := 0; i < 2; i++ {
+				ok, err := driver.TryLock()
+				require.NoError(t, err)
+				assert.False(t, ok)
+			}
+			holder, err := driver.LockStatus()
+			require.NoError(t, err)
+			assert.Equal(t, "other", holder)
+			ctrl.Finish()
+		})
+
+		t.Run("released by someone else", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+			driver.lockOwner = owner
+
+			session.EXPECT().ExecCAS(gomock.Any(), owner).Return(false, nil)
+
+			err := driver.Unlock()
+			assert.EqualError(t, err, "the migration lock of "+owner+" has been released by someone else")
+			ctrl.Finish()
+		})
+
+		t.Run("not held", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			session.EXPECT().QueryStrings(gomock.Any()).Return(nil, nil)
+
+			holder, err := driver.LockStatus()
+			require.NoError(t, err)
+			assert.Equal(t, "", holder)
+			ctrl.Finish()
+		})
+
+		t.Run("LockStatus without lock table", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			gomock.InOrder(
+				session.EXPECT().QueryStrings(`SELECT "owner" FROM "migrations_lock" WHERE "id"=1`).Return(nil, errors.New("unconfigured table")),
+				session.EXPECT().QueryStrings(`SELECT "name" FROM "migrations" LIMIT 1`),
+			)
+
+			holder, err := driver.LockStatus()
+			require.NoError(t, err)
+			assert.Equal(t, "", holder)
+			ctrl.Finish()
+		})
+
+		t.Run("ForceUnlock", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			session.EXPECT().ExecCAS(`DELETE FROM "migrations_lock" WHERE "id"=1 IF EXISTS`).Return(true, nil)
+
+			err := driver.ForceUnlock()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("ForceUnlock error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, session := newDriver(ctrl)
+
+			session.EXPECT().ExecCAS(`DELETE FROM "migrations_lock" WHERE "id"=1 IF EXISTS`).Return(false, errors.New("test"))
+
+			err := driver.ForceUnlock()
+			assert.EqualError(t, err, "test")
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, session := newDriver(ctrl)
+
+		session.EXPECT().Close()
+
+		driver.Close()
+
+		ctrl.Finish()
+	})
+}
+
+func TestParseCassandraDSN(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := parseCassandraDSN("cassandra://localhost/ks")
+		require.NoError(t, err)
+		assert.Equal(t, &cassandraConfig{
+			Hosts:                  []string{"localhost"},
+			Keyspace:               "ks",
+			Consistency:            "quorum",
+			Timeout:                10 * time.Second,
+			SchemaAgreementTimeout: time.Minute,
+		}, cfg)
+	})
+
+	t.Run("all parts", func(t *testing.T) {
+		cfg, err := parseCassandraDSN("cassandra://us%40r:p%3Ass@h1:9042,h2:9043/ks?consistency=local_quorum&timeout=5s&schema_agreement_timeout=2m")
+		require.NoError(t, err)
+		assert.Equal(t, &cassandraConfig{
+			Hosts:                  []string{"h1:9042", "h2:9043"},
+			Username:               "us@r",
+			Password:               "p:ss",
+			Keyspace:               "ks",
+			Consistency:            "local_quorum",
+			Timeout:                5 * time.Second,
+			SchemaAgreementTimeout: 2 * time.Minute,
+		}, cfg)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for dsn, expectedErr := range map[string]string{
+			"localhost/ks":                       `the DSN has to start with "cassandra://"`,
+			"cassandra://localhost":              "missing keyspace from the DSN",
+			"cassandra://localhost/":             "missing keyspace from the DSN",
+			"cassandra:///ks":                    "missing hosts from the DSN",
+			"cassandra://localhost/ks?timeout=x": `invalid timeout DSN param: "x"`,
+			"cassandra://localhost/ks?unknown=1": `unknown DSN param: "unknown"`,
+		} {
+			_, err := parseCassandraDSN(dsn)
+			assert.EqualError(t, err, expectedErr, dsn)
+		}
+	})
+}
+
+func TestIsCassandraSchemaChange(t *testing.T) {
+	assert.True(t, isCassandraSchemaChange("CREATE TABLE t (id int PRIMARY KEY)"))
+	assert.True(t, isCassandraSchemaChange("alter table t add n int"))
+	assert.True(t, isCassandraSchemaChange("-- comment\n/* block */ DROP INDEX i"))
+	assert.False(t, isCassandraSchemaChange("INSERT INTO t (id) VALUES (1)"))
+	assert.False(t, isCassandraSchemaChange("SELECT created FROM t"))
+}
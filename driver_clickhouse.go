@@ -0,0 +1,387 @@
+//go:build !custom || (custom && clickhouse)
+// +build !custom custom,clickhouse
+
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// clickHouseCluster is the value of the -clickhouse_cluster option.
+var clickHouseCluster string
+
+// clickHouseZooKeeperPath and clickHouseReplicaName are the values of the
+// -clickhouse_zookeeper_path and -clickhouse_replica_name options.
+var clickHouseZooKeeperPath, clickHouseReplicaName string
+
+func init() {
+	drivers["clickhouse"] = newClickHouseDriver
+	driverCapabilities["clickhouse"] = (&clickHouseDriver{}).Capabilities
+	driverFlags = append(driverFlags, func(fs *flag.FlagSet) {
+		fs.StringVar(&clickHouseCluster, "clickhouse_cluster", "", "ClickHouse only: the name of the cluster used in the ON CLUSTER clause of the migrations table DDL and in place of the {on_cluster} placeholder of the migration steps.")
+		fs.StringVar(&clickHouseZooKeeperPath, "clickhouse_zookeeper_path", "", "ClickHouse only: the ZooKeeper path of the ReplicatedMergeTree tables of sql-migrate in cluster mode. It has to contain the {table} placeholder that is replaced with the name of the table. Default: the default_replica_path server setting.")
+		fs.StringVar(&clickHouseReplicaName, "clickhouse_replica_name", "{replica}", "ClickHouse only: the replica name of the ReplicatedMergeTree tables of sql-migrate. Used only with -clickhouse_zookeeper_path.")
+	})
+}
+
+// clickHouseTablePlaceholder is replaced with the name of the table in the
+// value of the -clickhouse_zookeeper_path option.
+const clickHouseTablePlaceholder = "{table}"
+
+// clickHouseOnClusterPlaceholder is replaced with an ON CLUSTER clause in the
+// migration steps when the -clickhouse_cluster option is set and it is
+// removed from the migration steps when -clickhouse_cluster isn't set.
+// This way the same migration files can be used with a single server
+// (e.g.: in development) and with a cluster.
+const clickHouseOnClusterPlaceholder = "{on_cluster}"
+
+// clickHouseVersion is the expression that generates the versions of the
+// rows of the append-only tables on the server.
+const clickHouseVersion = "toUnixTimestamp64Nano(now64(9))"
+
+var clickHouseSplitter = &sqlSplitter{
+	LineComments:     []string{"--"},
+	QuoteChars:       "'\"`",
+	BackslashEscapes: true,
+}
+
+func newClickHouseDriver(dsn, tableName string) (Driver, error) {
+	if clickHouseZooKeeperPath != "" && !strings.Contains(clickHouseZooKeeperPath, clickHouseTablePlaceholder) {
+		return nil, fmt.Errorf("the -clickhouse_zookeeper_path option has to contain the %s placeholder", clickHouseTablePlaceholder)
+	}
+	db, err := sql.Open("clickhouse", dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := &clickHouseDriver{
+		db:            dbWrapper{db},
+		tableName:     quoteClickHouseIdentifier(tableName),
+		name:          tableName,
+		cluster:       clickHouseCluster,
+		zooKeeperPath: clickHouseZooKeeperPath,
+		replicaName:   clickHouseReplicaName,
+	}
+	versionTable := quoteClickHouseIdentifier(tableName + "_schema_version")
+	d.migrationsTableUpgrader = &migrationsTableUpgrader{
+		db:           d.db,
+		tableName:    d.tableName,
+		versionTable: versionTable,
+		createVersionTable: fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s (`version` Int64) ENGINE = %s ORDER BY `version`",
+			versionTable, d.onCluster(), d.engine(tableName+"_schema_version")),
+		addColumn:        d.addColumn,
+		placeholder:      func(int) string { return "?" },
+		quote:            quoteClickHouseIdentifier,
+		transactionalDDL: false,
+	}
+	historyTable := quoteClickHouseIdentifier(tableName + "_history")
+	d.tableHistoryRecorder = &tableHistoryRecorder{
+		db:              d.db,
+		tableName:       historyTable,
+		migrationsTable: d.tableName,
+		createTable: fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s (%s) ENGINE = %s ORDER BY `id`",
+			historyTable, d.onCluster(), historyColumnDefs(quoteClickHouseIdentifier, "String", "String", "String"), d.engine(tableName+"_history")),
+		placeholder: func(int) string { return "?" },
+		quote:       quoteClickHouseIdentifier,
+	}
+	lockTable := quoteClickHouseIdentifier(tableName + "_lock")
+	d.clickHouseLocker = &clickHouseLocker{
+		db:              d.db,
+		tableName:       lockTable,
+		migrationsTable: d.tableName,
+		createTable: fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s (`owner` String, `released` UInt8, `version` Int64) ENGINE = %s ORDER BY (`owner`, `version`)",
+			lockTable, d.onCluster(), d.engine(tableName+"_lock")),
+		now: time.Now,
+	}
+	return d, nil
+}
+
+func quoteClickHouseIdentifier(s string) string {
+	return "`" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "`", "\\`", -1) + "`"
+}
+
+func quoteClickHouseString(s string) string {
+	return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+}
+
+// clickHouseDriver stores the migration state in an append-only MergeTree
+// table because ClickHouse doesn't have unique keys and it doesn't support
+// efficient row deletion. Every state change inserts a new row and the
+// row with the highest version of a migration tells whether the migration
+// is forward migrated or not. Backward migrations insert tombstone rows
+// (applied=0). The versions are generated by the server so the order of
+// the rows doesn't depend on the clocks of the clients.
+//
+// ClickHouse doesn't have transactions so the -notx suffix is ignored.
+type clickHouseDriver struct {
+	db        DB
+	tableName string
+	// name is the unquoted name of the migrations table.
+	name          string
+	cluster       string
+	zooKeeperPath string
+	replicaName   string
+	*migrationsTableUpgrader
+	*tableHistoryRecorder
+	*clickHouseLocker
+}
+
+func (o *clickHouseDriver) onCluster() string {
+	if o.cluster == "" {
+		return ""
+	}
+	return "ON CLUSTER " + quoteClickHouseIdentifier(o.cluster)
+}
+
+// engine returns the engine of the table created by sql-migrate. Without
+// the -clickhouse_zookeeper_path option the ReplicatedMergeTree engine of
+// the cluster mode relies on the default_replica_path and
+// default_replica_name server settings.
+func (o *clickHouseDriver) engine(table string) string {
+	switch {
+	case o.cluster == "":
+		return "MergeTree()"
+	case o.zooKeeperPath == "":
+		return "ReplicatedMergeTree()"
+	default:
+		path := strings.Replace(o.zooKeeperPath, clickHouseTablePlaceholder, table, -1)
+		return fmt.Sprintf("ReplicatedMergeTree(%s, %s)", quoteClickHouseString(path), quoteClickHouseString(o.replicaName))
+	}
+}
+
+// addColumn is idempotent because the upgrades can't be executed in
+// transactions. The default values of the new columns are used by the
+// rows of the migrations inserted before the upgrade.
+func (o *clickHouseDriver) addColumn(c migrationsTableColumn) string {
+	typ := "String DEFAULT ''"
+	if c.Integer {
+		typ = "Int64 DEFAULT 0"
+	}
+	return fmt.Sprintf("ALTER TABLE %s %s ADD COLUMN IF NOT EXISTS %s %s", o.tableName, o.onCluster(), quoteClickHouseIdentifier(c.Name), typ)
+}
+
+func (o *clickHouseDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   false,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *clickHouseDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	if err := o.checkMigrationState(st); err != nil {
+		return err
+	}
+	for _, statement := range o.statements(contents) {
+		if _, err := o.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *clickHouseDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	if err := o.checkMigrationState(st); err != nil {
+		return err
+	}
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+// checkMigrationState checks the state of the migration before executing the
+// step. It replaces the RowsAffected check of the other drivers: the INSERT
+// of a tombstone row would succeed even if the migration isn't forward
+// migrated. The check and the INSERT aren't atomic but the commands that
+// execute steps hold the migration lock.
+func (o *clickHouseDriver) checkMigrationState(st *Step) error {
+	// argMax returns 0 if the migration doesn't have rows.
+	var applied int64
+	query := "SELECT toInt64(argMax(`applied`, `version`)) FROM " + o.tableName + " WHERE `name` = ?"
+	if _, err := queryRow(o.db, []interface{}{&applied}, query, st.MigrationName); err != nil {
+		return err
+	}
+	if (applied == 1) == (st.ParsedFilename.Direction == DirectionForward) {
+		return fmt.Errorf("error setting state for migration %q in the migrations table (examine it with the status command and fix it manually)", st.MigrationName)
+	}
+	return nil
+}
+
+// statements splits the contents of a migration step into statements
+// because ClickHouse can execute only one statement per query.
+func (o *clickHouseDriver) statements(contents string) []string {
+	contents = strings.Replace(contents, clickHouseOnClusterPlaceholder, o.onCluster(), -1)
+	return clickHouseSplitter.Split(contents)
+}
+
+// SetMigrationState stores the metadata only in the rows of forward
+// migrations. The metadata columns of tombstone rows have default values.
+func (o *clickHouseDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	if !forwardMigrated {
+		query := "INSERT INTO " + o.tableName + " (`name`, `applied`, `version`) SELECT ?, ?, " + clickHouseVersion
+		_, err := e.Exec(query, migrationName, 0)
+		return err
+	}
+	columns := []string{"`name`", "`applied`", "`version`"}
+	for _, c := range metadataColumns {
+		columns = append(columns, quoteClickHouseIdentifier(c.Name))
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) SELECT ?, ?, %s%s", o.tableName, strings.Join(columns, ", "), clickHouseVersion, strings.Repeat(", ?", len(metadataColumns)))
+	args := append([]interface{}{migrationName, 1}, meta.Values()...)
+	_, err := e.Exec(query, args...)
+	return err
+}
+
+func (o *clickHouseDriver) CreateMigrationsTable() error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s %s (
+			%s String,
+			%s UInt8,
+			%s Int64,
+			%s DateTime('UTC') DEFAULT now()
+		) ENGINE = %s
+		ORDER BY (%s, %s)`,
+		o.tableName, o.onCluster(), "`name`", "`applied`", "`version`", "`time`", o.engine(o.name), "`name`", "`version`",
+	)
+	_, err := o.db.Exec(query)
+	return err
+}
+
+func (o *clickHouseDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
+	rows, err := o.db.Query("SELECT `name` FROM " + o.tableName + " GROUP BY `name` HAVING argMax(`applied`, `version`) = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning forward migration result set: %s", err)
+		}
+		names[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %s", err)
+	}
+	return names, nil
+}
+
+// GetChecksums returns the checksums stored in the latest rows of the forward
+// migrated migrations.
+func (o *clickHouseDriver) GetChecksums() (map[string]string, error) {
+	query := "SELECT `name`, argMax(`checksum`, `version`) FROM " + o.tableName + " GROUP BY `name` HAVING argMax(`applied`, `version`) = 1"
+	return loadChecksums(o.db, o.loadVersion, query)
+}
+
+func (o *clickHouseDriver) Close() {
+	if err := o.db.Close(); err != nil {
+		log.Print(err)
+	}
+}
+
+// clickHouseLocker implements the Locker interface with an append-only lock
+// table because ClickHouse doesn't have unique keys. TryLock inserts a row
+// and the lock is held by the oldest owner whose latest row isn't a release
+// row. The versions of the rows are generated by the server so the owner
+// that inserts its row after another owner has checked the holder can't
+// take the lock. Unlock and ForceUnlock insert release rows.
+//
+// In cluster mode the rows are replicated asynchronously so the lock is
+// reliable only if the concurrent commands connect to the same replica.
+type clickHouseLocker struct {
+	db DB
+	// tableName is the quoted name of the lock table.
+	tableName string
+	// migrationsTable is the quoted name of the migrations table. It is
+	// probed to detect the missing lock table.
+	migrationsTable string
+	createTable     string
+	now             func() time.Time
+
+	tableCreated bool
+	owner        string
+}
+
+// createTableIfNeeded creates the lock table on demand
+// so the init command doesn't have to create it.
+func (o *clickHouseLocker) createTableIfNeeded() error {
+	if o.tableCreated {
+		return nil
+	}
+	if _, err := o.db.Exec(o.createTable); err != nil {
+		return fmt.Errorf("error creating lock table: %s", err)
+	}
+	o.tableCreated = true
+	return nil
+}
+
+func (o *clickHouseLocker) insertRow(owner string, released bool) error {
+	r := 0
+	if released {
+		r = 1
+	}
+	query := "INSERT INTO " + o.tableName + " (`owner`, `released`, `version`) SELECT ?, ?, " + clickHouseVersion
+	_, err := o.db.Exec(query, owner, r)
+	return err
+}
+
+func (o *clickHouseLocker) TryLock() (bool, error) {
+	if err := o.createTableIfNeeded(); err != nil {
+		return false, err
+	}
+	holder, err := o.LockStatus()
+	if err != nil || holder != "" {
+		return false, err
+	}
+
+	owner := lockOwner(o.now())
+	if err := o.insertRow(owner, false); err != nil {
+		return false, err
+	}
+	holder, err = o.LockStatus()
+	if err != nil {
+		return false, err
+	}
+	if holder == owner {
+		o.owner = owner
+		return true, nil
+	}
+	// Someone else has inserted a row before us.
+	return false, o.insertRow(owner, true)
+}
+
+func (o *clickHouseLocker) Unlock() error {
+	holder, err := o.LockStatus()
+	if err != nil {
+		return err
+	}
+	if holder != o.owner {
+		return fmt.Errorf("the migration lock of %s has been released by someone else", o.owner)
+	}
+	return o.insertRow(o.owner, true)
+}
+
+func (o *clickHouseLocker) LockStatus() (string, error) {
+	var owner string
+	query := "SELECT `owner` FROM " + o.tableName + " GROUP BY `owner` HAVING argMax(`released`, `version`) = 0 ORDER BY max(`version`), `owner` LIMIT 1"
+	if _, err := queryRow(o.db, []interface{}{&owner}, query); err != nil {
+		if !o.tableCreated && probeTable(o.db, o.migrationsTable) == nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return owner, nil
+}
+
+func (o *clickHouseLocker) ForceUnlock() error {
+	query := "INSERT INTO " + o.tableName + " (`owner`, `released`, `version`) " +
+		"SELECT `owner`, 1, " + clickHouseVersion + " FROM " + o.tableName + " GROUP BY `owner` HAVING argMax(`released`, `version`) = 0"
+	_, err := o.db.Exec(query)
+	return err
+}
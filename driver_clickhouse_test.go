@@ -0,0 +1,239 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClickHouseDriver(t *testing.T) {
+	const tableName = "`migrations`"
+	now := time.Unix(1500000000, 123)
+
+	newDriver := func(ctrl *gomock.Controller, cluster string) (*clickHouseDriver, *MockDB) {
+		db := NewMockDB(ctrl)
+		return &clickHouseDriver{
+			db:        db,
+			tableName: tableName,
+			cluster:   cluster,
+			clickHouseLocker: &clickHouseLocker{
+				db:              db,
+				tableName:       "`migrations_lock`",
+				migrationsTable: tableName,
+				createTable:     "CREATE TABLE `migrations_lock`",
+				now: func() time.Time {
+					return now
+				},
+			},
+		}, db
+	}
+
+	t.Run("engine", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, _ := newDriver(ctrl, "")
+		assert.Equal(t, "MergeTree()", driver.engine("migrations"))
+
+		driver.cluster = "my_cluster"
+		assert.Equal(t, "ReplicatedMergeTree()", driver.engine("migrations"))
+
+		driver.zooKeeperPath = "/clickhouse/tables/{shard}/db/{table}"
+		driver.replicaName = "{replica}"
+		assert.Equal(t, "ReplicatedMergeTree('/clickhouse/tables/{shard}/db/migrations_lock', '{replica}')", driver.engine("migrations_lock"))
+		ctrl.Finish()
+	})
+
+	t.Run("ExecuteStep checks the state of the migration", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, db := newDriver(ctrl, "")
+
+		st := newTestStep("1.fw.sql")
+		st.MigrationName = "1"
+		db.EXPECT().Query("SELECT toInt64(argMax(`applied`, `version`)) FROM `migrations` WHERE `name` = ?", "1").Return(nil, errors.New("test"))
+
+		err := driver.ExecuteStep(st, "CREATE TABLE t (id UInt64) ENGINE = Memory", testMetadata)
+		assert.EqualError(t, err, "test")
+		ctrl.Finish()
+	})
+
+	t.Run("Locker", func(t *testing.T) {
+		const lockStatus = "SELECT `owner` FROM `migrations_lock` GROUP BY `owner` HAVING argMax(`released`, `version`) = 0 ORDER BY max(`version`), `owner` LIMIT 1"
+
+		t.Run("create table error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			db.EXPECT().Exec("CREATE TABLE `migrations_lock`").Return(nil, errors.New("test"))
+
+			_, err := driver.TryLock()
+			assert.EqualError(t, err, "error creating lock table: test")
+			ctrl.Finish()
+		})
+
+		t.Run("lock status error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			gomock.InOrder(
+				db.EXPECT().Exec("CREATE TABLE `migrations_lock`"),
+				db.EXPECT().Query(lockStatus).Return(nil, errors.New("test")),
+			)
+
+			// The migrations table isn't probed after the creation of the
+			// lock table.
+			_, err := driver.TryLock()
+			assert.EqualError(t, err, "test")
+			ctrl.Finish()
+		})
+
+		t.Run("LockStatus without migrations table", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			gomock.InOrder(
+				db.EXPECT().Query(lockStatus).Return(nil, errors.New("test")),
+				db.EXPECT().Query("SELECT 1 FROM `migrations` WHERE 1=0").Return(nil, errors.New("closed")),
+			)
+
+			_, err := driver.LockStatus()
+			assert.EqualError(t, err, "test")
+			ctrl.Finish()
+		})
+
+		t.Run("ForceUnlock", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			db.EXPECT().Exec("INSERT INTO `migrations_lock` (`owner`, `released`, `version`) " +
+				"SELECT `owner`, 1, toUnixTimestamp64Nano(now64(9)) FROM `migrations_lock` GROUP BY `owner` HAVING argMax(`released`, `version`) = 0")
+
+			err := driver.ForceUnlock()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("ForceUnlock error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			db.EXPECT().Exec(gomock.Any()).Return(nil, errors.New("test"))
+
+			err := driver.ForceUnlock()
+			assert.EqualError(t, err, "test")
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("statements", func(t *testing.T) {
+		const contents = "CREATE TABLE t {on_cluster} (id UInt64) ENGINE = MergeTree() ORDER BY id;\n" +
+			"ALTER TABLE t {on_cluster} ADD COLUMN s String DEFAULT ';';\n"
+
+		t.Run("without cluster", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, _ := newDriver(ctrl, "")
+			assert.Equal(t, []string{
+				"CREATE TABLE t  (id UInt64) ENGINE = MergeTree() ORDER BY id",
+				"ALTER TABLE t  ADD COLUMN s String DEFAULT ';'",
+			}, driver.statements(contents))
+			ctrl.Finish()
+		})
+
+		t.Run("with cluster", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, _ := newDriver(ctrl, "my_cluster")
+			assert.Equal(t, []string{
+				"CREATE TABLE t ON CLUSTER `my_cluster` (id UInt64) ENGINE = MergeTree() ORDER BY id",
+				"ALTER TABLE t ON CLUSTER `my_cluster` ADD COLUMN s String DEFAULT ';'",
+			}, driver.statements(contents))
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("SetMigrationState", func(t *testing.T) {
+		t.Run("forward", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			db.EXPECT().Exec("INSERT INTO `migrations` (`name`, `applied`, `version`, `checksum`, `duration_ms`, `sql_migrate_version`, `os_user`, `hostname`, `applied_by`) "+
+				"SELECT ?, ?, toUnixTimestamp64Nano(now64(9)), ?, ?, ?, ?, ?, ?", "0001", 1, "checksum", gomock.Any(), "version", "user", "host", "applied_by")
+
+			err := driver.SetMigrationState(db, "0001", true, testMetadata)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("backward inserts a tombstone", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			db.EXPECT().Exec("INSERT INTO `migrations` (`name`, `applied`, `version`) SELECT ?, ?, toUnixTimestamp64Nano(now64(9))", "0001", 0)
+
+			err := driver.SetMigrationState(db, "0001", false, testMetadata)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			db.EXPECT().Exec(gomock.Any(), "0001", 1, "checksum", gomock.Any(), "version", "user", "host", "applied_by").Return(nil, assert.AnError)
+
+			err := driver.SetMigrationState(db, "0001", true, testMetadata)
+			require.Equal(t, assert.AnError, err)
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("CreateMigrationsTable", func(t *testing.T) {
+		t.Run("without cluster", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "")
+
+			db.EXPECT().Exec(gomock.Any()).Do(func(query string, args ...interface{}) {
+				assert.Contains(t, query, "CREATE TABLE IF NOT EXISTS `migrations`  (")
+				assert.Contains(t, query, "ENGINE = MergeTree()")
+			})
+
+			err := driver.CreateMigrationsTable()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("with cluster", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "my_cluster")
+
+			db.EXPECT().Exec(gomock.Any()).Do(func(query string, args ...interface{}) {
+				assert.Contains(t, query, "CREATE TABLE IF NOT EXISTS `migrations` ON CLUSTER `my_cluster` (")
+				assert.Contains(t, query, "ENGINE = ReplicatedMergeTree()")
+			})
+
+			err := driver.CreateMigrationsTable()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, db := newDriver(ctrl, "")
+
+		db.EXPECT().Close()
+
+		driver.Close()
+
+		ctrl.Finish()
+	})
+}
+
+func TestQuoteClickHouseIdentifier(t *testing.T) {
+	assert.Equal(t, "`migrations`", quoteClickHouseIdentifier("migrations"))
+	assert.Equal(t, "`a\\`b\\\\c`", quoteClickHouseIdentifier("a`b\\c"))
+}
@@ -0,0 +1,167 @@
+//go:build !custom || (custom && cockroach)
+// +build !custom custom,cockroach
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	drivers["cockroach"] = newCockroachDriver
+	driverCapabilities["cockroach"] = (&cockroachDriver{}).Capabilities
+}
+
+const (
+	// cockroachMaxAttempts is the maximum number of times a transaction
+	// is executed when it keeps failing with a retryable error.
+	cockroachMaxAttempts = 10
+	// cockroachRetryDelay is the delay before the first retry.
+	// It is doubled before every subsequent retry.
+	cockroachRetryDelay = 50 * time.Millisecond
+)
+
+func newCockroachDriver(dsn, tableName string) (Driver, error) {
+	// CockroachDB speaks the postgres wire protocol.
+	db, err := openPostgresDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := &cockroachDriver{
+		postgresDriver: newPostgresDriverWithDB(db, tableName),
+		maxAttempts:    cockroachMaxAttempts,
+		sleep:          time.Sleep,
+	}
+	lockTable := d.qualifiedName(tableName + "_lock")
+	d.Locker = newTableLocker(d.db, lockTable, d.tableName,
+		`CREATE TABLE IF NOT EXISTS `+lockTable+` ("id" INT PRIMARY KEY, "owner" TEXT NOT NULL)`,
+		postgresPlaceholder,
+		quotePostgresIdentifier,
+	)
+	// Schema changes and writes can't share a transaction.
+	d.migrationsTableUpgrader.transactionalDDL = false
+	return d, nil
+}
+
+// cockroachDriver reuses the postgres driver with a few differences.
+//
+// CockroachDB runs transactions with SERIALIZABLE isolation and expects the
+// client to retry them when they fail with a serialization failure
+// (SQLSTATE 40001). This happens regularly under contention.
+//
+// Schema changes can't safely share a transaction with writes (e.g.: the
+// INSERT into the migrations table). Steps that contain schema changes are
+// executed in their own transaction and the migration state is updated in
+// a separate transaction. If the second transaction fails then the error
+// tells how to fix the migration state.
+//
+// The migration lock is a row in a lock table because the postgres advisory
+// lock functions are accepted by CockroachDB but they are no-ops.
+type cockroachDriver struct {
+	postgresDriver
+	maxAttempts int
+	sleep       func(time.Duration)
+}
+
+// Capabilities doesn't report advisory locking because CockroachDB accepts
+// the postgres advisory lock functions but they are no-ops.
+func (o *cockroachDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   true,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *cockroachDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	if st.ParsedFilename.NoTx {
+		return o.postgresDriver.ExecuteStep(st, contents, meta)
+	}
+	if err := o.setSearchPath(); err != nil {
+		return err
+	}
+
+	forwardMigrated := st.ParsedFilename.Direction == DirectionForward
+	if !containsCockroachSchemaChange(contents) {
+		return o.executeInRetriedTx(func(e Execer) error {
+			if _, err := e.Exec(contents); err != nil {
+				return err
+			}
+			return o.SetMigrationState(e, st.MigrationName, forwardMigrated, meta)
+		})
+	}
+
+	err := o.executeInRetriedTx(func(e Execer) error {
+		_, err := e.Exec(contents)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = o.executeInRetriedTx(func(e Execer) error {
+		return o.SetMigrationState(e, st.MigrationName, forwardMigrated, meta)
+	})
+	if err != nil {
+		cmd := "mark-applied"
+		if !forwardMigrated {
+			cmd = "mark-unapplied"
+		}
+		return fmt.Errorf("error setting state for migration %q in the migrations table after committing its schema changes (fix it with the %s command): %s", st.MigrationName, cmd, err)
+	}
+	return nil
+}
+
+func (o *cockroachDriver) executeInRetriedTx(f func(Execer) error) error {
+	delay := cockroachRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := o.executeInTx(f)
+		if err == nil || attempt >= o.maxAttempts || !isCockroachRetryableError(err) {
+			return err
+		}
+		o.sleep(delay)
+		delay *= 2
+	}
+}
+
+func (o *cockroachDriver) executeInTx(f func(Execer) error) error {
+	tx, err := o.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (o *cockroachDriver) CreateMigrationsTable() error {
+	if err := o.createSchemaIfNeeded(); err != nil {
+		return err
+	}
+	// CockroachDB sessions use UTC by default.
+	_, err := o.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + o.tableName + `(
+			"name" TEXT PRIMARY KEY,
+			"time" TIMESTAMP NOT NULL DEFAULT now()
+		);`,
+	)
+	return err
+}
+
+func isCockroachRetryableError(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "40001"
+}
+
+// cockroachSchemaChangeRegexp matches DDL statements at the beginning
+// of a line or after a semicolon.
+var cockroachSchemaChangeRegexp = regexp.MustCompile(`(?im)(?:^|;)\s*(?:CREATE|ALTER|DROP|TRUNCATE|COMMENT\s+ON)\b`)
+
+func containsCockroachSchemaChange(contents string) bool {
+	return cockroachSchemaChangeRegexp.MatchString(contents)
+}
@@ -0,0 +1,242 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCockroachDriver(t *testing.T) {
+	const tableName = "migrations"
+	const maxAttempts = 3
+
+	newDriver := func(ctrl *gomock.Controller) (_ *cockroachDriver, _ *MockDB, sleeps *[]time.Duration) {
+		db := NewMockDB(ctrl)
+		sleeps = new([]time.Duration)
+		return &cockroachDriver{
+			postgresDriver: postgresDriver{
+				db:        db,
+				tableName: tableName,
+			},
+			maxAttempts: maxAttempts,
+			sleep: func(d time.Duration) {
+				*sleeps = append(*sleeps, d)
+			},
+		}, db, sleeps
+	}
+
+	newTestStep := func(migrationName, filename string) *Step {
+		parsed, err := parseFilename(filename, ".fw", ".bw", ".nt", ".sql")
+		if err != nil {
+			panic(err)
+		}
+		return &Step{
+			Filename:       filename,
+			MigrationName:  migrationName,
+			ParsedFilename: parsed,
+		}
+	}
+
+	retryableError := &pq.Error{Code: "40001"}
+
+	t.Run("ExecuteStep", func(t *testing.T) {
+		t.Run("success", func(t *testing.T) {
+			t.Run("with transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db, sleeps := newDriver(ctrl)
+				tx := NewMockTX(ctrl)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "INSERT INTO t VALUES (1);"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx, nil),
+					tx.EXPECT().Exec(query),
+					// postgresDriver.SetMigrationState
+					tx.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+					tx.EXPECT().Commit(),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+				require.NoError(t, err)
+				assert.Empty(t, *sleeps)
+				ctrl.Finish()
+			})
+
+			t.Run("without transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db, _ := newDriver(ctrl)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "CREATE TABLE t (id INT);"
+
+				gomock.InOrder(
+					db.EXPECT().Exec(query),
+					// postgresDriver.SetMigrationState
+					db.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.nt.sql"), query, testMetadata)
+				require.NoError(t, err)
+				ctrl.Finish()
+			})
+
+			t.Run("schema change in separate transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db, _ := newDriver(ctrl)
+				tx1 := NewMockTX(ctrl)
+				tx2 := NewMockTX(ctrl)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "CREATE TABLE t (id INT);"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx1, nil),
+					tx1.EXPECT().Exec(query),
+					tx1.EXPECT().Commit(),
+					db.EXPECT().Begin().Return(tx2, nil),
+					// postgresDriver.SetMigrationState
+					tx2.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+					tx2.EXPECT().Commit(),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+				require.NoError(t, err)
+				ctrl.Finish()
+			})
+
+			t.Run("migration state error after schema change", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db, _ := newDriver(ctrl)
+				tx1 := NewMockTX(ctrl)
+				tx2 := NewMockTX(ctrl)
+
+				const migrationName = "0001"
+				const query = "CREATE TABLE t (id INT);"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx1, nil),
+					tx1.EXPECT().Exec(query),
+					tx1.EXPECT().Commit(),
+					db.EXPECT().Begin().Return(tx2, nil),
+					tx2.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(nil, errors.New("test")),
+					tx2.EXPECT().Rollback(),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+				assert.EqualError(t, err, `error setting state for migration "0001" in the migrations table after committing its schema changes (fix it with the mark-applied command): test`)
+				ctrl.Finish()
+			})
+
+			t.Run("retry after serialization failure", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db, sleeps := newDriver(ctrl)
+				tx1 := NewMockTX(ctrl)
+				tx2 := NewMockTX(ctrl)
+				tx3 := NewMockTX(ctrl)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "INSERT INTO t VALUES (1);"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx1, nil),
+					tx1.EXPECT().Exec(query).Return(nil, retryableError),
+					tx1.EXPECT().Rollback(),
+					db.EXPECT().Begin().Return(tx2, nil),
+					tx2.EXPECT().Exec(query),
+					tx2.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+					tx2.EXPECT().Commit().Return(retryableError),
+					db.EXPECT().Begin().Return(tx3, nil),
+					tx3.EXPECT().Exec(query),
+					tx3.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+					tx3.EXPECT().Commit(),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+				require.NoError(t, err)
+				assert.Equal(t, []time.Duration{cockroachRetryDelay, 2 * cockroachRetryDelay}, *sleeps)
+				ctrl.Finish()
+			})
+		})
+
+		t.Run("error", func(t *testing.T) {
+			t.Run("non-retryable", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db, sleeps := newDriver(ctrl)
+				tx := NewMockTX(ctrl)
+
+				const query = "INSERT INTO t VALUES (1);"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx, nil),
+					tx.EXPECT().Exec(query).Return(nil, assert.AnError),
+					tx.EXPECT().Rollback(),
+				)
+
+				err := driver.ExecuteStep(newTestStep("0001", "1.fw.sql"), query, testMetadata)
+				require.Equal(t, assert.AnError, err)
+				assert.Empty(t, *sleeps)
+				ctrl.Finish()
+			})
+
+			t.Run("too many attempts", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db, sleeps := newDriver(ctrl)
+
+				const query = "INSERT INTO t VALUES (1);"
+
+				for i := 0; i < maxAttempts; i++ {
+					tx := NewMockTX(ctrl)
+					gomock.InOrder(
+						db.EXPECT().Begin().Return(tx, nil),
+						tx.EXPECT().Exec(query).Return(nil, retryableError),
+						tx.EXPECT().Rollback(),
+					)
+				}
+
+				err := driver.ExecuteStep(newTestStep("0001", "1.fw.sql"), query, testMetadata)
+				require.Equal(t, retryableError, err)
+				assert.Len(t, *sleeps, maxAttempts-1)
+				ctrl.Finish()
+			})
+		})
+	})
+}
+
+func TestContainsCockroachSchemaChange(t *testing.T) {
+	tests := []*struct {
+		contents string
+		expected bool
+	}{
+		{"INSERT INTO t VALUES (1);", false},
+		{"UPDATE t SET created = 1;", false},
+		{"CREATE TABLE t (id INT);", true},
+		{"  alter table t add column c INT;", true},
+		{"INSERT INTO t VALUES (1); DROP TABLE t2;", true},
+		{"INSERT INTO t VALUES (1);\nCOMMENT ON TABLE t IS 'x';", true},
+		{"TRUNCATE t;", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.contents, func(t *testing.T) {
+			assert.Equal(t, test.expected, containsCockroachSchemaChange(test.contents))
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/pasztorpisti/sql-migrate/plugin"
+)
+
+// execDriverPrefix is the prefix of the -driver option values that point to
+// an external driver plugin executable. The protocol is described in the
+// documentation of the plugin package.
+const execDriverPrefix = "exec:"
+
+// execDriverProtocolVersions are the plugin protocol versions offered to
+// the plugins during the handshake.
+var execDriverProtocolVersions = []int{plugin.ProtocolVersion}
+
+func newExecDriverFactory(path string) func(dsn, tableName string) (Driver, error) {
+	return func(dsn, tableName string) (Driver, error) {
+		return newExecDriver(path, dsn, tableName)
+	}
+}
+
+func newExecDriver(path, dsn, tableName string) (Driver, error) {
+	if path == "" {
+		return nil, errors.New("missing plugin path")
+	}
+	cmd := exec.Command(path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting plugin %q: %s", path, err)
+	}
+
+	d := &execDriver{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+	}
+	if err := d.handshake(dsn, tableName); err != nil {
+		stdin.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("plugin handshake error: %s", err)
+	}
+	return d.withFeatures(), nil
+}
+
+// execDriver forwards the Driver method calls to an external plugin process
+// as line-delimited JSON requests.
+type execDriver struct {
+	cmd          *exec.Cmd
+	stdin        io.WriteCloser
+	stdout       *bufio.Reader
+	lastID       int64
+	capabilities DriverCapabilities
+	features     []string
+}
+
+// The optional interfaces of the drivers are detected with type assertions
+// so the execDriver implements only the mandatory methods of the protocol.
+// The drivers below add the optional features negotiated in the handshake.
+type execHistoryDriver struct {
+	*execDriver
+	*execHistoryRecorder
+}
+
+type execLockingDriver struct {
+	*execDriver
+	*execLocker
+}
+
+type execHistoryLockingDriver struct {
+	*execDriver
+	*execHistoryRecorder
+	*execLocker
+}
+
+func (o *execDriver) withFeatures() Driver {
+	history := containsString(o.features, plugin.FeatureHistory)
+	locking := containsString(o.features, plugin.FeatureLocking)
+	switch {
+	case history && locking:
+		return &execHistoryLockingDriver{o, &execHistoryRecorder{o}, &execLocker{o}}
+	case history:
+		return &execHistoryDriver{o, &execHistoryRecorder{o}}
+	case locking:
+		return &execLockingDriver{o, &execLocker{o}}
+	default:
+		return o
+	}
+}
+
+func (o *execDriver) handshake(dsn, tableName string) error {
+	var result plugin.HandshakeResult
+	err := o.call(plugin.MethodHandshake, &plugin.HandshakeParams{
+		ProtocolVersions: execDriverProtocolVersions,
+		DSN:              dsn,
+		MigrationsTable:  tableName,
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if !containsInt(execDriverProtocolVersions, result.ProtocolVersion) {
+		return fmt.Errorf("the plugin chose protocol version %d that wasn't offered: %v", result.ProtocolVersion, execDriverProtocolVersions)
+	}
+
+	o.features = result.Features
+	o.capabilities = DriverCapabilities{
+		TransactionalDDL:   true,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+	if c := result.Capabilities; c != nil {
+		o.capabilities = DriverCapabilities{
+			TransactionalDDL:   c.TransactionalDDL,
+			MultiStatementExec: c.MultiStatementExec,
+			AdvisoryLocking:    c.AdvisoryLocking,
+		}
+	}
+	return nil
+}
+
+func containsInt(a []int, v int) bool {
+	for _, x := range a {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(a []string, v string) bool {
+	for _, x := range a {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *execDriver) Capabilities() DriverCapabilities {
+	return o.capabilities
+}
+
+func (o *execDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	return o.call(plugin.MethodExecuteStep, &plugin.ExecuteStepParams{
+		MigrationName: st.MigrationName,
+		Filename:      st.Filename,
+		Direction:     st.ParsedFilename.Direction.String(),
+		NoTx:          st.ParsedFilename.NoTx,
+		Contents:      contents,
+		Metadata:      pluginMetadata(meta),
+	}, nil)
+}
+
+func (o *execDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	return o.call(plugin.MethodMarkStep, &plugin.MarkStepParams{
+		MigrationName: st.MigrationName,
+		Filename:      st.Filename,
+		Direction:     st.ParsedFilename.Direction.String(),
+		Metadata:      pluginMetadata(meta),
+	}, nil)
+}
+
+func pluginMetadata(meta *MigrationMetadata) *plugin.Metadata {
+	return &plugin.Metadata{
+		Checksum:          meta.Checksum,
+		SQLMigrateVersion: meta.Version,
+		OSUser:            meta.OSUser,
+		Hostname:          meta.Hostname,
+		AppliedBy:         meta.AppliedBy,
+	}
+}
+
+func (o *execDriver) CreateMigrationsTable() error {
+	return o.call(plugin.MethodCreateMigrationsTable, nil, nil)
+}
+
+func (o *execDriver) UpgradeMigrationsTable() error {
+	return o.call(plugin.MethodUpgradeMigrationsTable, nil, nil)
+}
+
+func (o *execDriver) GetChecksums() (map[string]string, error) {
+	var result plugin.GetChecksumsResult
+	if err := o.call(plugin.MethodGetChecksums, nil, &result); err != nil {
+		return nil, err
+	}
+	if result.Checksums == nil {
+		result.Checksums = map[string]string{}
+	}
+	return result.Checksums, nil
+}
+
+func (o *execDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
+	var result plugin.GetForwardMigratedNamesResult
+	if err := o.call(plugin.MethodGetForwardMigratedNames, nil, &result); err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(result.Names))
+	for _, name := range result.Names {
+		names[name] = struct{}{}
+	}
+	return names, nil
+}
+
+func (o *execDriver) Close() {
+	if err := o.call(plugin.MethodClose, nil, nil); err != nil {
+		log.Print(err)
+	}
+	if err := o.stdin.Close(); err != nil {
+		log.Print(err)
+	}
+	if err := o.cmd.Wait(); err != nil {
+		log.Printf("plugin exit error: %s", err)
+	}
+}
+
+// execHistoryRecorder implements the HistoryRecorder interface for the
+// plugins that support plugin.FeatureHistory.
+type execHistoryRecorder struct {
+	d *execDriver
+}
+
+func (o *execHistoryRecorder) CreateHistoryTable() error {
+	return o.d.call(plugin.MethodCreateHistoryTable, nil, nil)
+}
+
+func (o *execHistoryRecorder) RecordHistory(h *HistoryEntry) error {
+	return o.d.call(plugin.MethodRecordHistory, &plugin.HistoryEntry{
+		ID:            h.ID,
+		MigrationName: h.MigrationName,
+		Filename:      h.Filename,
+		Direction:     h.Direction,
+		Status:        h.Status,
+		StartTime:     h.StartTime,
+		EndTime:       h.EndTime,
+		Error:         h.Error,
+		OSUser:        h.OSUser,
+		Hostname:      h.Hostname,
+		AppliedBy:     h.AppliedBy,
+	}, nil)
+}
+
+func (o *execHistoryRecorder) LoadHistory() ([]*HistoryEntry, error) {
+	var result plugin.LoadHistoryResult
+	if err := o.d.call(plugin.MethodLoadHistory, nil, &result); err != nil {
+		return nil, err
+	}
+	if !result.TableExists {
+		return nil, errNoHistoryTable
+	}
+	entries := make([]*HistoryEntry, len(result.Entries))
+	for i, e := range result.Entries {
+		entries[i] = &HistoryEntry{
+			ID:            e.ID,
+			MigrationName: e.MigrationName,
+			Filename:      e.Filename,
+			Direction:     e.Direction,
+			Status:        e.Status,
+			StartTime:     e.StartTime,
+			EndTime:       e.EndTime,
+			Error:         e.Error,
+			OSUser:        e.OSUser,
+			Hostname:      e.Hostname,
+			AppliedBy:     e.AppliedBy,
+		}
+	}
+	return entries, nil
+}
+
+// execLocker implements the Locker interface for the plugins that support
+// plugin.FeatureLocking.
+type execLocker struct {
+	d *execDriver
+}
+
+func (o *execLocker) TryLock() (bool, error) {
+	var result plugin.TryLockResult
+	if err := o.d.call(plugin.MethodTryLock, nil, &result); err != nil {
+		return false, err
+	}
+	return result.Acquired, nil
+}
+
+func (o *execLocker) Unlock() error {
+	return o.d.call(plugin.MethodUnlock, nil, nil)
+}
+
+func (o *execLocker) LockStatus() (string, error) {
+	var result plugin.LockStatusResult
+	if err := o.d.call(plugin.MethodLockStatus, nil, &result); err != nil {
+		return "", err
+	}
+	return result.Holder, nil
+}
+
+func (o *execLocker) ForceUnlock() error {
+	return o.d.call(plugin.MethodForceUnlock, nil, nil)
+}
+
+// call sends a request to the plugin and waits for its response.
+// The result of the response is decoded into result if it isn't nil.
+func (o *execDriver) call(method string, params, result interface{}) error {
+	o.lastID++
+	req := plugin.Request{
+		ID:     o.lastID,
+		Method: method,
+	}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = b
+	}
+	b, err := json.Marshal(&req)
+	if err != nil {
+		return err
+	}
+	if _, err := o.stdin.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error sending %s request to plugin: %s", method, err)
+	}
+
+	line, err := o.stdout.ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return fmt.Errorf("error receiving %s response from plugin: %s", method, err)
+	}
+	var resp plugin.Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("error decoding %s response from plugin: %s", method, err)
+	}
+	if resp.ID != req.ID {
+		return fmt.Errorf("plugin response ID mismatch: expected %d, got %d", req.ID, resp.ID)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("error decoding %s result from plugin: %s", method, err)
+		}
+	}
+	return nil
+}
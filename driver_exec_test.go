@@ -0,0 +1,192 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildReferencePlugin compiles the reference driver plugin into dir.
+func buildReferencePlugin(t *testing.T, dir string) string {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("the go tool is required to build the reference plugin")
+	}
+	path := filepath.Join(dir, "reference-plugin")
+	out, err := exec.Command(goBin, "build", "-o", path, "./plugin/reference").CombinedOutput()
+	require.NoError(t, err, string(out))
+	return path
+}
+
+func TestExecDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-migrate-exec-driver")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pluginPath := buildReferencePlugin(t, dir)
+	dbPath := filepath.Join(dir, "db.json")
+
+	newTestStep := func(migrationName, filename string) *Step {
+		parsed, err := parseFilename(filename, ".fw", ".bw", ".nt", ".sql")
+		if err != nil {
+			panic(err)
+		}
+		return &Step{
+			Filename:       filename,
+			MigrationName:  migrationName,
+			ParsedFilename: parsed,
+		}
+	}
+
+	t.Run("migrations table doesn't exist", func(t *testing.T) {
+		driver, err := newExecDriver(pluginPath, dbPath, "missing_table")
+		require.NoError(t, err)
+		defer driver.Close()
+
+		_, err = driver.GetForwardMigratedNames()
+		assert.EqualError(t, err, `table "missing_table" doesn't exist`)
+	})
+
+	t.Run("forward and backward migration", func(t *testing.T) {
+		driver, err := newExecDriver(pluginPath, dbPath, "migrations")
+		require.NoError(t, err)
+		defer driver.Close()
+
+		require.NoError(t, driver.CreateMigrationsTable())
+		require.NoError(t, driver.CreateMigrationsTable())
+
+		names, err := driver.GetForwardMigratedNames()
+		require.NoError(t, err)
+		assert.Empty(t, names)
+
+		require.NoError(t, driver.ExecuteStep(newTestStep("0001", "1.fw.sql"), "CREATE 1;", testMetadata))
+		require.NoError(t, driver.ExecuteStep(newTestStep("0002", "2.fw.nt.sql"), "CREATE 2;", testMetadata))
+
+		err = driver.ExecuteStep(newTestStep("0002", "2.fw.sql"), "CREATE 2;", testMetadata)
+		assert.EqualError(t, err, `error setting state for migration "0002" in the migrations table`)
+
+		names, err = driver.GetForwardMigratedNames()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]struct{}{"0001": {}, "0002": {}}, names)
+
+		require.NoError(t, driver.ExecuteStep(newTestStep("0002", "2.bw.sql"), "DROP 2;", testMetadata))
+
+		names, err = driver.GetForwardMigratedNames()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]struct{}{"0001": {}}, names)
+	})
+
+	t.Run("state survives plugin restart", func(t *testing.T) {
+		driver, err := newExecDriver(pluginPath, dbPath, "migrations")
+		require.NoError(t, err)
+		defer driver.Close()
+
+		names, err := driver.GetForwardMigratedNames()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]struct{}{"0001": {}}, names)
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		driver, err := newExecDriver(pluginPath, dbPath, "migrations")
+		require.NoError(t, err)
+		defer driver.Close()
+
+		assert.Equal(t, DriverCapabilities{
+			TransactionalDDL:   true,
+			MultiStatementExec: true,
+		}, driver.(CapabilityReporter).Capabilities())
+	})
+
+	t.Run("optional interfaces", func(t *testing.T) {
+		driver, err := newExecDriver(pluginPath, dbPath, "migrations")
+		require.NoError(t, err)
+		defer driver.Close()
+
+		require.NoError(t, driver.UpgradeMigrationsTable())
+
+		checksums, err := driver.(ChecksumLoader).GetChecksums()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"0001": "checksum"}, checksums)
+
+		sm := driver.(StateMarker)
+		require.NoError(t, sm.MarkStep(newTestStep("0003", "3.fw.sql"), testMetadata))
+		err = sm.MarkStep(newTestStep("0003", "3.fw.sql"), testMetadata)
+		assert.EqualError(t, err, `error setting state for migration "0003" in the migrations table`)
+		names, err := driver.GetForwardMigratedNames()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]struct{}{"0001": {}, "0003": {}}, names)
+	})
+
+	t.Run("history", func(t *testing.T) {
+		driver, err := newExecDriver(pluginPath, dbPath, "migrations")
+		require.NoError(t, err)
+		defer driver.Close()
+
+		hr := driver.(HistoryRecorder)
+		_, err = hr.LoadHistory()
+		assert.Equal(t, errNoHistoryTable, err)
+
+		h := &HistoryEntry{
+			ID:            "id",
+			MigrationName: "0001",
+			Filename:      "1.fw.sql",
+			Direction:     "forward",
+			Status:        historyStatusSucceeded,
+			StartTime:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			EndTime:       time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC),
+			OSUser:        "user",
+		}
+		require.NoError(t, hr.CreateHistoryTable())
+		require.NoError(t, hr.RecordHistory(h))
+		entries, err := hr.LoadHistory()
+		require.NoError(t, err)
+		assert.Equal(t, []*HistoryEntry{h}, entries)
+	})
+
+	t.Run("locking", func(t *testing.T) {
+		d1, err := newExecDriver(pluginPath, dbPath, "migrations")
+		require.NoError(t, err)
+		defer d1.Close()
+		d2, err := newExecDriver(pluginPath, dbPath, "migrations")
+		require.NoError(t, err)
+		defer d2.Close()
+		l1, l2 := d1.(Locker), d2.(Locker)
+
+		ok, err := l1.TryLock()
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = l2.TryLock()
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		holder, err := l2.LockStatus()
+		require.NoError(t, err)
+		assert.NotEmpty(t, holder)
+
+		require.NoError(t, l2.ForceUnlock())
+		err = l1.Unlock()
+		assert.Error(t, err)
+		holder, err = l1.LockStatus()
+		require.NoError(t, err)
+		assert.Empty(t, holder)
+	})
+
+	t.Run("missing plugin", func(t *testing.T) {
+		_, err := newExecDriver(filepath.Join(dir, "missing"), dbPath, "migrations")
+		assert.Error(t, err)
+	})
+
+	t.Run("handshake error", func(t *testing.T) {
+		_, err := newExecDriver(pluginPath, "", "migrations")
+		assert.EqualError(t, err, "plugin handshake error: the DSN has to be the path of the database file")
+	})
+}
@@ -0,0 +1,273 @@
+//go:build !custom || (custom && generic)
+// +build !custom custom,generic
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// The values of the -generic_* options.
+var (
+	genericSQLDriver       string
+	genericPlaceholder     string
+	genericQuote           string
+	genericTxDDL           bool
+	genericTableDDL        string
+	genericLockTableDDL    string
+	genericVersionTableDDL string
+	genericHistoryTableDDL string
+)
+
+const (
+	defaultGenericTableDDL        = `CREATE TABLE IF NOT EXISTS {table} ({name} VARCHAR(255) PRIMARY KEY, {time} TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`
+	defaultGenericLockTableDDL    = `CREATE TABLE IF NOT EXISTS {table} ({id} INT PRIMARY KEY, {owner} VARCHAR(255) NOT NULL)`
+	defaultGenericVersionTableDDL = `CREATE TABLE IF NOT EXISTS {table} ({version} INT PRIMARY KEY)`
+)
+
+var defaultGenericHistoryTableDDL = `CREATE TABLE IF NOT EXISTS {table} (` +
+	historyColumnDefs(func(c string) string { return "{" + c + "}" }, "VARCHAR(255) PRIMARY KEY", "VARCHAR(255)", "VARCHAR(4000)") + `)`
+
+func init() {
+	drivers["generic"] = newGenericDriver
+	driverCapabilities["generic"] = func() DriverCapabilities {
+		return (&genericDriver{dialect: &genericDialect{transactionalDDL: genericTxDDL}}).Capabilities()
+	}
+	driverFlags = append(driverFlags, func(fs *flag.FlagSet) {
+		fs.StringVar(&genericSQLDriver, "generic_sql_driver", "", "Generic driver only: the name of the database/sql driver to use. Valid values: "+strings.Join(sqlDriverNames(), ", "))
+		fs.StringVar(&genericPlaceholder, "generic_placeholder", "?", "Generic driver only: the query parameter placeholder style. Valid values: ?, $1, :1, @p1")
+		fs.StringVar(&genericQuote, "generic_quote", `"`, "Generic driver only: the identifier quote character or the opening and closing identifier quote characters (e.g.: [])")
+		fs.BoolVar(&genericTxDDL, "generic_tx_ddl", false, "Generic driver only: the database supports DDL inside transactions. If true then the migration steps are executed in transactions unless they have the -notx suffix.")
+		fs.StringVar(&genericTableDDL, "generic_table_ddl", defaultGenericTableDDL, "Generic driver only: the statement that creates the migrations table if it doesn't exist. The {table}, {name} and {time} placeholders are replaced with the quoted table and column names.")
+		fs.StringVar(&genericLockTableDDL, "generic_lock_table_ddl", defaultGenericLockTableDDL, "Generic driver only: the statement that creates the lock table of the goto command if it doesn't exist. The {table}, {id} and {owner} placeholders are replaced with the quoted table and column names.")
+		fs.StringVar(&genericHistoryTableDDL, "generic_history_table_ddl", defaultGenericHistoryTableDDL, "Generic driver only: the statement that creates the history table if it doesn't exist. The {table} placeholder and the {<column_name>} placeholders are replaced with the quoted table and column names.")
+		fs.StringVar(&genericVersionTableDDL, "generic_version_table_ddl", defaultGenericVersionTableDDL, "Generic driver only: the statement that creates the table that stores the schema version of the migrations table if it doesn't exist. The {table} and {version} placeholders are replaced with the quoted table and column names.")
+	})
+}
+
+// sqlDriverNames returns the database/sql drivers compiled into the binary.
+func sqlDriverNames() []string {
+	names := sql.Drivers()
+	sort.Strings(names)
+	return names
+}
+
+func newGenericDriver(dsn, tableName string) (Driver, error) {
+	if genericSQLDriver == "" {
+		return nil, errors.New("missing -generic_sql_driver parameter")
+	}
+	dialect, err := newGenericDialect(genericPlaceholder, genericQuote, genericTableDDL, genericTxDDL)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(genericSQLDriver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	lockTable := dialect.QuoteIdentifier(tableName + "_lock")
+	versionTable := dialect.QuoteIdentifier(tableName + "_schema_version")
+	historyTable := dialect.QuoteIdentifier(tableName + "_history")
+	historyReplacements := []string{"{table}", historyTable}
+	for _, c := range historyColumns {
+		historyReplacements = append(historyReplacements, "{"+c+"}", dialect.QuoteIdentifier(c))
+	}
+	return &genericDriver{
+		db:        dbWrapper{db},
+		dialect:   dialect,
+		tableName: dialect.QuoteIdentifier(tableName),
+		Locker: newTableLocker(dbWrapper{db}, lockTable, dialect.QuoteIdentifier(tableName),
+			strings.NewReplacer(
+				"{table}", lockTable,
+				"{id}", dialect.QuoteIdentifier("id"),
+				"{owner}", dialect.QuoteIdentifier("owner"),
+			).Replace(genericLockTableDDL),
+			dialect.placeholder,
+			dialect.QuoteIdentifier,
+		),
+		migrationsTableUpgrader: &migrationsTableUpgrader{
+			db:           dbWrapper{db},
+			tableName:    dialect.QuoteIdentifier(tableName),
+			versionTable: versionTable,
+			createVersionTable: strings.NewReplacer(
+				"{table}", versionTable,
+				"{version}", dialect.QuoteIdentifier("version"),
+			).Replace(genericVersionTableDDL),
+			addColumn:        sqlAddColumn(dialect.QuoteIdentifier(tableName), dialect.QuoteIdentifier, "VARCHAR(255)", "BIGINT"),
+			placeholder:      dialect.placeholder,
+			quote:            dialect.QuoteIdentifier,
+			transactionalDDL: dialect.transactionalDDL,
+		},
+		tableHistoryRecorder: &tableHistoryRecorder{
+			db:              dbWrapper{db},
+			tableName:       historyTable,
+			migrationsTable: dialect.QuoteIdentifier(tableName),
+			createTable:     strings.NewReplacer(historyReplacements...).Replace(genericHistoryTableDDL),
+			placeholder:     dialect.placeholder,
+			quote:           dialect.QuoteIdentifier,
+		},
+	}, nil
+}
+
+// genericDialect describes the differences between databases that can be
+// handled by the generic driver.
+type genericDialect struct {
+	// placeholder returns the nth (1-based) query parameter placeholder.
+	placeholder      func(n int) string
+	quoteOpen        string
+	quoteClose       string
+	transactionalDDL bool
+	tableDDL         string
+}
+
+func newGenericDialect(placeholder, quote, tableDDL string, transactionalDDL bool) (*genericDialect, error) {
+	d := &genericDialect{
+		transactionalDDL: transactionalDDL,
+		tableDDL:         tableDDL,
+	}
+
+	switch placeholder {
+	case "?":
+		d.placeholder = func(int) string { return "?" }
+	case "$1":
+		d.placeholder = func(n int) string { return fmt.Sprintf("$%d", n) }
+	case ":1":
+		d.placeholder = func(n int) string { return fmt.Sprintf(":%d", n) }
+	case "@p1":
+		d.placeholder = func(n int) string { return fmt.Sprintf("@p%d", n) }
+	default:
+		return nil, fmt.Errorf("invalid placeholder style: %q", placeholder)
+	}
+
+	switch len(quote) {
+	case 1:
+		d.quoteOpen, d.quoteClose = quote, quote
+	case 2:
+		d.quoteOpen, d.quoteClose = quote[:1], quote[1:]
+	default:
+		return nil, fmt.Errorf("the identifier quote has to be one or two characters long: %q", quote)
+	}
+
+	if strings.TrimSpace(tableDDL) == "" {
+		return nil, errors.New("the migrations table DDL can't be an empty string")
+	}
+	return d, nil
+}
+
+// QuoteIdentifier quotes an identifier by escaping the closing quote
+// characters inside the identifier with doubling.
+func (o *genericDialect) QuoteIdentifier(s string) string {
+	return o.quoteOpen + strings.Replace(s, o.quoteClose, o.quoteClose+o.quoteClose, -1) + o.quoteClose
+}
+
+type genericDriver struct {
+	db        DB
+	dialect   *genericDialect
+	tableName string
+	Locker
+	*migrationsTableUpgrader
+	*tableHistoryRecorder
+}
+
+// Capabilities doesn't report multi-statement support because the generic
+// driver passes the migration steps to the database/sql driver as they are
+// and it can't know whether the database/sql driver is able to execute
+// multiple statements with a single Exec call.
+func (o *genericDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   o.dialect.transactionalDDL,
+		MultiStatementExec: false,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *genericDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	performStep := func(e Execer) error {
+		if _, err := e.Exec(contents); err != nil {
+			return err
+		}
+		return o.SetMigrationState(e, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+	}
+
+	if !o.dialect.transactionalDDL || st.ParsedFilename.NoTx {
+		return performStep(o.db)
+	}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := performStep(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (o *genericDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *genericDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	name := o.dialect.QuoteIdentifier("name")
+	query := insertMigrationQuery(o.tableName, o.dialect.QuoteIdentifier, o.dialect.placeholder)
+	args := insertMigrationArgs(migrationName, meta)
+	if !forwardMigrated {
+		query = "DELETE FROM " + o.tableName + " WHERE " + name + "=" + o.dialect.placeholder(1)
+		args = []interface{}{migrationName}
+	}
+	res, err := e.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if ra != 1 {
+		return fmt.Errorf("error setting state for migration %q in the migrations table (examine it with the status command and fix it manually)", migrationName)
+	}
+	return nil
+}
+
+func (o *genericDriver) CreateMigrationsTable() error {
+	query := strings.NewReplacer(
+		"{table}", o.tableName,
+		"{name}", o.dialect.QuoteIdentifier("name"),
+		"{time}", o.dialect.QuoteIdentifier("time"),
+	).Replace(o.dialect.tableDDL)
+	_, err := o.db.Exec(query)
+	return err
+}
+
+func (o *genericDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
+	rows, err := o.db.Query("SELECT " + o.dialect.QuoteIdentifier("name") + " FROM " + o.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning forward migration result set: %s", err)
+		}
+		names[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %s", err)
+	}
+	return names, nil
+}
+
+func (o *genericDriver) Close() {
+	if err := o.db.Close(); err != nil {
+		log.Print(err)
+	}
+}
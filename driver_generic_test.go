@@ -0,0 +1,207 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericDriver(t *testing.T) {
+	newDriver := func(ctrl *gomock.Controller, placeholder, quote string, txDDL bool) (*genericDriver, *MockDB) {
+		dialect, err := newGenericDialect(placeholder, quote, defaultGenericTableDDL, txDDL)
+		require.NoError(t, err)
+		db := NewMockDB(ctrl)
+		return &genericDriver{
+			db:        db,
+			dialect:   dialect,
+			tableName: dialect.QuoteIdentifier("migrations"),
+		}, db
+	}
+
+	newTestStep := func(migrationName, filename string) *Step {
+		parsed, err := parseFilename(filename, ".fw", ".bw", ".nt", ".sql")
+		if err != nil {
+			panic(err)
+		}
+		return &Step{
+			Filename:       filename,
+			MigrationName:  migrationName,
+			ParsedFilename: parsed,
+		}
+	}
+
+	t.Run("ExecuteStep", func(t *testing.T) {
+		t.Run("transactional DDL", func(t *testing.T) {
+			t.Run("with transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db := newDriver(ctrl, "$1", `"`, true)
+				tx := NewMockTX(ctrl)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "SELECT 1;"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx, nil),
+					tx.EXPECT().Exec(query),
+					// genericDriver.SetMigrationState
+					tx.EXPECT().Exec(`INSERT INTO "migrations" ("name", "checksum", "duration_ms", "sql_migrate_version", "os_user", "hostname", "applied_by") VALUES ($1, $2, $3, $4, $5, $6, $7)`, testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+					tx.EXPECT().Commit(),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+				require.NoError(t, err)
+				ctrl.Finish()
+			})
+
+			t.Run("without transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db := newDriver(ctrl, "$1", `"`, true)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "SELECT 1;"
+
+				gomock.InOrder(
+					db.EXPECT().Exec(query),
+					// genericDriver.SetMigrationState
+					db.EXPECT().Exec(`DELETE FROM "migrations" WHERE "name"=$1`, migrationName).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.bw.nt.sql"), query, testMetadata)
+				require.NoError(t, err)
+				ctrl.Finish()
+			})
+
+			t.Run("error", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db := newDriver(ctrl, "$1", `"`, true)
+				tx := NewMockTX(ctrl)
+
+				const query = "SELECT 1;"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx, nil),
+					tx.EXPECT().Exec(query).Return(nil, assert.AnError),
+					tx.EXPECT().Rollback(),
+				)
+
+				err := driver.ExecuteStep(newTestStep("0001", "1.fw.sql"), query, testMetadata)
+				require.Error(t, err)
+				ctrl.Finish()
+			})
+		})
+
+		t.Run("non-transactional DDL ignores the notx suffix", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "?", "`", false)
+			res := NewMockResult(ctrl)
+
+			const migrationName = "0001"
+			const query = "SELECT 1;"
+
+			gomock.InOrder(
+				db.EXPECT().Exec(query),
+				// genericDriver.SetMigrationState
+				db.EXPECT().Exec("INSERT INTO `migrations` (`name`, `checksum`, `duration_ms`, `sql_migrate_version`, `os_user`, `hostname`, `applied_by`) VALUES (?, ?, ?, ?, ?, ?, ?)", testMetadataArgs(migrationName)...).Return(res, nil),
+				res.EXPECT().RowsAffected().Return(int64(1), nil),
+			)
+
+			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("invalid rows affected", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl, "?", "`", false)
+			res := NewMockResult(ctrl)
+
+			gomock.InOrder(
+				db.EXPECT().Exec("SELECT 1;"),
+				db.EXPECT().Exec(gomock.Any(), testMetadataArgs("0001")...).Return(res, nil),
+				res.EXPECT().RowsAffected().Return(int64(0), nil),
+			)
+
+			err := driver.ExecuteStep(newTestStep("0001", "1.fw.sql"), "SELECT 1;", testMetadata)
+			require.EqualError(t, err, `error setting state for migration "0001" in the migrations table (examine it with the status command and fix it manually)`)
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("CreateMigrationsTable", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, db := newDriver(ctrl, "@p1", "[]", false)
+
+		db.EXPECT().Exec(`CREATE TABLE IF NOT EXISTS [migrations] ([name] VARCHAR(255) PRIMARY KEY, [time] TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`)
+
+		err := driver.CreateMigrationsTable()
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, db := newDriver(ctrl, "?", `"`, false)
+
+		db.EXPECT().Close()
+
+		driver.Close()
+
+		ctrl.Finish()
+	})
+}
+
+func TestNewGenericDialect(t *testing.T) {
+	t.Run("placeholders", func(t *testing.T) {
+		tests := []*struct {
+			style       string
+			placeholder string
+		}{
+			{"?", "?"},
+			{"$1", "$2"},
+			{":1", ":2"},
+			{"@p1", "@p2"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.style, func(t *testing.T) {
+				d, err := newGenericDialect(test.style, `"`, defaultGenericTableDDL, false)
+				require.NoError(t, err)
+				assert.Equal(t, test.placeholder, d.placeholder(2))
+			})
+		}
+	})
+
+	t.Run("quote", func(t *testing.T) {
+		d, err := newGenericDialect("?", `"`, defaultGenericTableDDL, false)
+		require.NoError(t, err)
+		assert.Equal(t, `"a""b"`, d.QuoteIdentifier(`a"b`))
+
+		d, err = newGenericDialect("?", "[]", defaultGenericTableDDL, false)
+		require.NoError(t, err)
+		assert.Equal(t, `[a[b]]c]`, d.QuoteIdentifier(`a[b]c`))
+	})
+
+	t.Run("invalid placeholder", func(t *testing.T) {
+		_, err := newGenericDialect("%s", `"`, defaultGenericTableDDL, false)
+		require.EqualError(t, err, `invalid placeholder style: "%s"`)
+	})
+
+	t.Run("invalid quote", func(t *testing.T) {
+		_, err := newGenericDialect("?", "", defaultGenericTableDDL, false)
+		require.EqualError(t, err, `the identifier quote has to be one or two characters long: ""`)
+	})
+
+	t.Run("empty table DDL", func(t *testing.T) {
+		_, err := newGenericDialect("?", `"`, " ", false)
+		require.EqualError(t, err, `the migrations table DDL can't be an empty string`)
+	})
+}
@@ -1,11 +1,14 @@
+//go:build integration
 // +build integration
 
 package main
 
 import (
+	"errors"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -23,6 +26,13 @@ func TestDrivers(t *testing.T) {
 	}
 }
 
+// noOpQueries contains the no-op queries of the databases
+// that can't execute "SELECT 1;".
+var noOpQueries = map[string]string{
+	"oracle":    "SELECT 1 FROM dual;",
+	"cassandra": "SELECT now() FROM system.local;",
+}
+
 func testDriver(t *testing.T, driverName string) {
 	driverFactory := drivers[driverName]
 	driverNameUpper := strings.ToUpper(driverName)
@@ -65,6 +75,18 @@ func testDriver(t *testing.T, driverName string) {
 			require.NoError(t, err)
 
 			require.True(t, tableExists(driver))
+
+			// The read-only commands don't create the missing version and
+			// history tables.
+			if cl, ok := driver.(ChecksumLoader); ok {
+				checksums, err := cl.GetChecksums()
+				require.NoError(t, err)
+				assert.Empty(t, checksums)
+			}
+			if hr, ok := driver.(HistoryRecorder); ok {
+				_, err := hr.LoadHistory()
+				assert.Equal(t, errNoHistoryTable, err)
+			}
 		})
 
 		t.Run("table creation succeeds if exists", func(t *testing.T) {
@@ -90,6 +112,11 @@ func testDriver(t *testing.T, driverName string) {
 		defer driver.Close()
 		err = driver.CreateMigrationsTable()
 		require.NoError(t, err)
+		// The second upgrade has to be a no-op.
+		require.NoError(t, driver.UpgradeMigrationsTable())
+		require.NoError(t, driver.UpgradeMigrationsTable())
+
+		meta := newMigrationMetadata("integration-test").forStep([]byte("test"))
 
 		newTestStep := func(migrationName, filename string) *Step {
 			parsed, err := parseFilename(filename, ".fw", ".bw", ".nt", ".sql")
@@ -115,30 +142,127 @@ func testDriver(t *testing.T, driverName string) {
 		require.NoError(t, err)
 		assert.Equal(t, nameSet(), names)
 
-		const noOpQuery = "SELECT 1;"
+		noOpQuery := "SELECT 1;"
+		if q, ok := noOpQueries[driverName]; ok {
+			noOpQuery = q
+		}
 
-		err = driver.ExecuteStep(newTestStep("0001_initial", "0001_initial.fw.sql"), noOpQuery)
+		err = driver.ExecuteStep(newTestStep("0001_initial", "0001_initial.fw.sql"), noOpQuery, meta)
 		require.NoError(t, err)
 		names, err = driver.GetForwardMigratedNames()
 		require.NoError(t, err)
 		assert.Equal(t, nameSet("0001_initial"), names)
 
-		err = driver.ExecuteStep(newTestStep("0002", "0002.fw.sql"), noOpQuery)
+		err = driver.ExecuteStep(newTestStep("0002", "0002.fw.sql"), noOpQuery, meta)
 		require.NoError(t, err)
 		names, err = driver.GetForwardMigratedNames()
 		require.NoError(t, err)
 		assert.Equal(t, nameSet("0001_initial", "0002"), names)
 
-		err = driver.ExecuteStep(newTestStep("0003", "0003.fw.sql"), noOpQuery)
+		err = driver.ExecuteStep(newTestStep("0003", "0003.fw.sql"), noOpQuery, meta)
 		require.NoError(t, err)
 		names, err = driver.GetForwardMigratedNames()
 		require.NoError(t, err)
 		assert.Equal(t, nameSet("0001_initial", "0002", "0003"), names)
 
-		err = driver.ExecuteStep(newTestStep("0002", "0002.bw.sql"), noOpQuery)
+		err = driver.ExecuteStep(newTestStep("0002", "0002.bw.sql"), noOpQuery, meta)
 		require.NoError(t, err)
 		names, err = driver.GetForwardMigratedNames()
 		require.NoError(t, err)
 		assert.Equal(t, nameSet("0001_initial", "0003"), names)
+
+		if cl, ok := driver.(ChecksumLoader); ok {
+			checksums, err := cl.GetChecksums()
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"0001_initial": meta.Checksum, "0003": meta.Checksum}, checksums)
+		}
+
+		if sm, ok := driver.(StateMarker); ok {
+			err = sm.MarkStep(newTestStep("0004", "0004.fw.sql"), meta)
+			require.NoError(t, err)
+			names, err = driver.GetForwardMigratedNames()
+			require.NoError(t, err)
+			assert.Equal(t, nameSet("0001_initial", "0003", "0004"), names)
+
+			err = sm.MarkStep(newTestStep("0004", "0004.bw.sql"), meta)
+			require.NoError(t, err)
+			names, err = driver.GetForwardMigratedNames()
+			require.NoError(t, err)
+			assert.Equal(t, nameSet("0001_initial", "0003"), names)
+		}
+	})
+	t.Run("HistoryRecorder", func(t *testing.T) {
+		driver, err := driverFactory(dsn, table)
+		require.NoError(t, err)
+		defer driver.Close()
+		hr, ok := driver.(HistoryRecorder)
+		if !ok {
+			t.Skip("the driver doesn't support history")
+		}
+		require.NoError(t, hr.CreateHistoryTable())
+		require.NoError(t, hr.CreateHistoryTable())
+
+		meta := newMigrationMetadata("")
+		meta.StartTime = time.Now()
+		st := &Step{Filename: "0001.fw.sql", MigrationName: "0001", ParsedFilename: &ParsedFilename{Direction: DirectionForward}}
+		h1 := newHistoryEntry(st, meta, meta.StartTime.Add(time.Second), nil)
+		meta.StartTime = meta.StartTime.Add(2 * time.Second)
+		h2 := newHistoryEntry(st, meta, meta.StartTime.Add(time.Second), errors.New("test error"))
+		require.NoError(t, hr.RecordHistory(h2))
+		require.NoError(t, hr.RecordHistory(h1))
+
+		entries, err := hr.LoadHistory()
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, h1.Values(), entries[0].Values())
+		assert.Equal(t, h2.Values(), entries[1].Values())
+	})
+	t.Run("Locker", func(t *testing.T) {
+		newLocker := func() (Driver, Locker) {
+			driver, err := driverFactory(dsn, table)
+			require.NoError(t, err)
+			locker, ok := driver.(Locker)
+			if !ok {
+				driver.Close()
+				t.Skip("the driver doesn't support locking")
+			}
+			return driver, locker
+		}
+
+		d1, l1 := newLocker()
+		defer d1.Close()
+		d2, l2 := newLocker()
+		defer d2.Close()
+
+		// LockStatus doesn't fail if the lock table hasn't been created yet.
+		holder, err := l1.LockStatus()
+		require.NoError(t, err)
+		assert.Empty(t, holder)
+
+		ok, err := l1.TryLock()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = l2.TryLock()
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		holder, err = l2.LockStatus()
+		require.NoError(t, err)
+		assert.NotEmpty(t, holder)
+
+		err = l1.Unlock()
+		require.NoError(t, err)
+
+		holder, err = l2.LockStatus()
+		require.NoError(t, err)
+		assert.Empty(t, holder)
+
+		ok, err = l2.TryLock()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		err = l1.ForceUnlock()
+		require.NoError(t, err)
 	})
 }
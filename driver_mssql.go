@@ -0,0 +1,307 @@
+//go:build !custom || (custom && mssql)
+// +build !custom custom,mssql
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+func init() {
+	drivers["mssql"] = newMSSQLDriver
+	driverCapabilities["mssql"] = (&msSQLDriver{}).Capabilities
+}
+
+func newMSSQLDriver(dsn, tableName string) (Driver, error) {
+	db, err := sql.Open("sqlserver", dsn)
+	if err != nil {
+		return nil, err
+	}
+	lockTable := quoteMSSQLIdentifier(tableName + "_lock")
+	versionTable := quoteMSSQLIdentifier(tableName + "_schema_version")
+	historyTable := quoteMSSQLIdentifier(tableName + "_history")
+	return &msSQLDriver{
+		db:        dbWrapper{db},
+		tableName: quoteMSSQLIdentifier(tableName),
+		Locker: newTableLocker(dbWrapper{db}, lockTable, quoteMSSQLIdentifier(tableName), `
+			IF OBJECT_ID(`+quoteMSSQLString(lockTable)+`, N'U') IS NULL
+			CREATE TABLE `+lockTable+` ([id] INT PRIMARY KEY, [owner] NVARCHAR(255) NOT NULL)`,
+			msSQLPlaceholder,
+			quoteMSSQLIdentifier,
+		),
+		migrationsTableUpgrader: &migrationsTableUpgrader{
+			db:           dbWrapper{db},
+			tableName:    quoteMSSQLIdentifier(tableName),
+			versionTable: versionTable,
+			createVersionTable: `
+				IF OBJECT_ID(` + quoteMSSQLString(versionTable) + `, N'U') IS NULL
+				CREATE TABLE ` + versionTable + ` ([version] INT PRIMARY KEY)`,
+			addColumn:        sqlAddColumn(quoteMSSQLIdentifier(tableName), quoteMSSQLIdentifier, "NVARCHAR(255)", "BIGINT"),
+			placeholder:      msSQLPlaceholder,
+			quote:            quoteMSSQLIdentifier,
+			transactionalDDL: true,
+		},
+		tableHistoryRecorder: &tableHistoryRecorder{
+			db:              dbWrapper{db},
+			tableName:       historyTable,
+			migrationsTable: quoteMSSQLIdentifier(tableName),
+			createTable: `
+				IF OBJECT_ID(` + quoteMSSQLString(historyTable) + `, N'U') IS NULL
+				CREATE TABLE ` + historyTable + ` (` + historyColumnDefs(quoteMSSQLIdentifier, "NVARCHAR(255) PRIMARY KEY", "NVARCHAR(255)", "NVARCHAR(MAX)") + `)`,
+			placeholder: msSQLPlaceholder,
+			quote:       quoteMSSQLIdentifier,
+		},
+	}, nil
+}
+
+func msSQLPlaceholder(n int) string {
+	return fmt.Sprintf("@p%d", n)
+}
+
+func quoteMSSQLIdentifier(s string) string {
+	return "[" + strings.Replace(s, "]", "]]", -1) + "]"
+}
+
+func quoteMSSQLString(s string) string {
+	return "N'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+type msSQLDriver struct {
+	db        DB
+	tableName string
+	Locker
+	*migrationsTableUpgrader
+	*tableHistoryRecorder
+}
+
+func (o *msSQLDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   true,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *msSQLDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	batches, err := splitMSSQLBatches(contents)
+	if err != nil {
+		return err
+	}
+
+	performStep := func(e Execer) error {
+		for _, batch := range batches {
+			if _, err := e.Exec(batch); err != nil {
+				return err
+			}
+		}
+		return o.SetMigrationState(e, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+	}
+
+	if st.ParsedFilename.NoTx {
+		return performStep(o.db)
+	}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := performStep(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (o *msSQLDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *msSQLDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	query := insertMigrationQuery(o.tableName, quoteMSSQLIdentifier, msSQLPlaceholder)
+	args := insertMigrationArgs(migrationName, meta)
+	if !forwardMigrated {
+		query = `DELETE FROM ` + o.tableName + ` WHERE [name]=@p1`
+		args = []interface{}{migrationName}
+	}
+	res, err := e.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if ra != 1 {
+		return fmt.Errorf("error setting state for migration %q in the migrations table (examine it with the status command and fix it manually)", migrationName)
+	}
+	return nil
+}
+
+func (o *msSQLDriver) CreateMigrationsTable() error {
+	// SQL Server doesn't support CREATE TABLE IF NOT EXISTS.
+	_, err := o.db.Exec(`
+		IF OBJECT_ID(` + quoteMSSQLString(o.tableName) + `, N'U') IS NULL
+		CREATE TABLE ` + o.tableName + `(
+			[name] NVARCHAR(255) PRIMARY KEY,
+			[time] DATETIME2 NOT NULL DEFAULT SYSUTCDATETIME()
+		);`,
+	)
+	return err
+}
+
+func (o *msSQLDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
+	rows, err := o.db.Query(`SELECT [name] FROM ` + o.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning forward migration result set: %s", err)
+		}
+		names[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %s", err)
+	}
+	return names, nil
+}
+
+func (o *msSQLDriver) Close() {
+	if err := o.db.Close(); err != nil {
+		log.Print(err)
+	}
+}
+
+// mssqlBatchSeparator matches a line that contains only a GO batch separator
+// with an optional repeat count and an optional trailing comment.
+var mssqlBatchSeparator = regexp.MustCompile(`^\s*(?i:GO)(?:\s+(\d+))?\s*(?:--.*)?$`)
+
+type mssqlScanState int
+
+const (
+	mssqlScanCode mssqlScanState = iota
+	mssqlScanBlockComment
+	mssqlScanString
+	mssqlScanQuotedIdentifier
+	mssqlScanBracketedIdentifier
+)
+
+// splitMSSQLBatches splits a T-SQL script into batches the same way as the
+// sqlcmd utility does: the batch separator is a GO command on its own line.
+// GO lines inside string literals, quoted identifiers and block comments are
+// part of the batch. A "GO <count>" separator repeats the preceding batch
+// <count> times. Empty batches are omitted from the result.
+func splitMSSQLBatches(script string) ([]string, error) {
+	var batches []string
+	var batch bytes.Buffer
+	state := mssqlScanCode
+	commentDepth := 0
+
+	addBatch := func(count int) {
+		if s := batch.String(); strings.TrimSpace(s) != "" {
+			for i := 0; i < count; i++ {
+				batches = append(batches, s)
+			}
+		}
+		batch.Reset()
+	}
+
+	lines := strings.SplitAfter(script, "\n")
+	for _, line := range lines {
+		if state == mssqlScanCode {
+			if m := mssqlBatchSeparator.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil {
+				count := 1
+				if m[1] != "" {
+					n, err := strconv.Atoi(m[1])
+					if err != nil || n < 1 {
+						return nil, fmt.Errorf("invalid batch separator count: %q", strings.TrimSpace(line))
+					}
+					count = n
+				}
+				addBatch(count)
+				continue
+			}
+		}
+
+		batch.WriteString(line)
+
+	scan:
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			var next byte
+			if i+1 < len(line) {
+				next = line[i+1]
+			}
+
+			switch state {
+			case mssqlScanCode:
+				switch {
+				case c == '-' && next == '-':
+					break scan
+				case c == '/' && next == '*':
+					state = mssqlScanBlockComment
+					commentDepth = 1
+					i++
+				case c == '\'':
+					state = mssqlScanString
+				case c == '"':
+					state = mssqlScanQuotedIdentifier
+				case c == '[':
+					state = mssqlScanBracketedIdentifier
+				}
+			case mssqlScanBlockComment:
+				// T-SQL block comments can be nested.
+				switch {
+				case c == '/' && next == '*':
+					commentDepth++
+					i++
+				case c == '*' && next == '/':
+					commentDepth--
+					i++
+					if commentDepth == 0 {
+						state = mssqlScanCode
+					}
+				}
+			case mssqlScanString:
+				if c == '\'' {
+					if next == '\'' {
+						i++
+					} else {
+						state = mssqlScanCode
+					}
+				}
+			case mssqlScanQuotedIdentifier:
+				if c == '"' {
+					if next == '"' {
+						i++
+					} else {
+						state = mssqlScanCode
+					}
+				}
+			case mssqlScanBracketedIdentifier:
+				if c == ']' {
+					if next == ']' {
+						i++
+					} else {
+						state = mssqlScanCode
+					}
+				}
+			}
+		}
+	}
+
+	addBatch(1)
+	return batches, nil
+}
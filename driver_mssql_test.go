@@ -0,0 +1,214 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMSSQLDriver(t *testing.T) {
+	const tableName = "migrations"
+
+	newDriver := func(ctrl *gomock.Controller) (*msSQLDriver, *MockDB) {
+		db := NewMockDB(ctrl)
+		return &msSQLDriver{
+			db:        db,
+			tableName: tableName,
+		}, db
+	}
+
+	newTestStep := func(migrationName, filename string) *Step {
+		parsed, err := parseFilename(filename, ".fw", ".bw", ".nt", ".sql")
+		if err != nil {
+			panic(err)
+		}
+		return &Step{
+			Filename:       filename,
+			MigrationName:  migrationName,
+			ParsedFilename: parsed,
+		}
+	}
+
+	t.Run("ExecuteStep", func(t *testing.T) {
+		t.Run("success", func(t *testing.T) {
+			t.Run("with transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db := newDriver(ctrl)
+				tx := NewMockTX(ctrl)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "SELECT 1;\nGO\nSELECT 2;\n"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx, nil),
+					tx.EXPECT().Exec("SELECT 1;\n"),
+					tx.EXPECT().Exec("SELECT 2;\n"),
+					// msSQLDriver.SetMigrationState
+					tx.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+					tx.EXPECT().Commit(),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+				require.NoError(t, err)
+				ctrl.Finish()
+			})
+
+			t.Run("without transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db := newDriver(ctrl)
+				res := NewMockResult(ctrl)
+
+				const migrationName = "0001"
+				const query = "SELECT 1;\nGO\nSELECT 2;\n"
+
+				gomock.InOrder(
+					db.EXPECT().Exec("SELECT 1;\n"),
+					db.EXPECT().Exec("SELECT 2;\n"),
+					// msSQLDriver.SetMigrationState
+					db.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+					res.EXPECT().RowsAffected().Return(int64(1), nil),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.nt.sql"), query, testMetadata)
+				require.NoError(t, err)
+				ctrl.Finish()
+			})
+		})
+
+		t.Run("error", func(t *testing.T) {
+			t.Run("with transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db := newDriver(ctrl)
+				tx := NewMockTX(ctrl)
+
+				const migrationName = "0001"
+				const query = "SELECT 1;\nGO\nSELECT 2;\n"
+
+				gomock.InOrder(
+					db.EXPECT().Begin().Return(tx, nil),
+					tx.EXPECT().Exec("SELECT 1;\n").Return(nil, assert.AnError),
+					tx.EXPECT().Rollback(),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+				require.Error(t, err)
+				ctrl.Finish()
+			})
+
+			t.Run("without transaction", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, db := newDriver(ctrl)
+
+				const migrationName = "0001"
+				const query = "SELECT 1;\nGO\nSELECT 2;\n"
+
+				gomock.InOrder(
+					db.EXPECT().Exec("SELECT 1;\n").Return(nil, assert.AnError),
+				)
+
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.nt.sql"), query, testMetadata)
+				require.Error(t, err)
+				ctrl.Finish()
+			})
+
+			t.Run("invalid batch separator", func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				driver, _ := newDriver(ctrl)
+
+				err := driver.ExecuteStep(newTestStep("0001", "1.fw.sql"), "SELECT 1;\nGO 0\n", testMetadata)
+				require.EqualError(t, err, `invalid batch separator count: "GO 0"`)
+				ctrl.Finish()
+			})
+		})
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, db := newDriver(ctrl)
+
+		db.EXPECT().Close()
+
+		driver.Close()
+
+		ctrl.Finish()
+	})
+}
+
+func TestSplitMSSQLBatches(t *testing.T) {
+	tests := []*struct {
+		name    string
+		script  string
+		batches []string
+	}{
+		{
+			name:    "empty",
+			script:  "",
+			batches: nil,
+		},
+		{
+			name:    "single batch without separator",
+			script:  "SELECT 1;\nSELECT 2;",
+			batches: []string{"SELECT 1;\nSELECT 2;"},
+		},
+		{
+			name:    "multiple batches",
+			script:  "SELECT 1;\nGO\nSELECT 2;\ngo\r\nSELECT 3;\n  Go  \n",
+			batches: []string{"SELECT 1;\n", "SELECT 2;\n", "SELECT 3;\n"},
+		},
+		{
+			name:    "empty batches are omitted",
+			script:  "GO\n\nGO\nSELECT 1;\nGO\n  \nGO",
+			batches: []string{"SELECT 1;\n"},
+		},
+		{
+			name:    "separator with count and comment",
+			script:  "SELECT 1;\nGO 3 -- repeat\nSELECT 2;\nGO -- done\n",
+			batches: []string{"SELECT 1;\n", "SELECT 1;\n", "SELECT 1;\n", "SELECT 2;\n"},
+		},
+		{
+			name:    "GO isn't a separator when it isn't alone in the line",
+			script:  "SELECT 1; GO\nGOTO label;\nGO;\n",
+			batches: []string{"SELECT 1; GO\nGOTO label;\nGO;\n"},
+		},
+		{
+			name:    "GO inside a string literal",
+			script:  "SELECT 'it''s\nGO\n';\nGO\nSELECT 2;",
+			batches: []string{"SELECT 'it''s\nGO\n';\n", "SELECT 2;"},
+		},
+		{
+			name:    "GO inside nested block comments",
+			script:  "/* a /* b */\nGO\n*/ SELECT 1;\nGO\nSELECT 2;",
+			batches: []string{"/* a /* b */\nGO\n*/ SELECT 1;\n", "SELECT 2;"},
+		},
+		{
+			name:    "GO inside quoted identifiers",
+			script:  "SELECT 1 AS \"a\nGO\n\", 2 AS [b]]\nGO\n];\nGO\nSELECT 2;",
+			batches: []string{"SELECT 1 AS \"a\nGO\n\", 2 AS [b]]\nGO\n];\n", "SELECT 2;"},
+		},
+		{
+			name:    "line comments don't start strings or block comments",
+			script:  "SELECT 1; -- it's /* not a comment\nGO\nSELECT 2;",
+			batches: []string{"SELECT 1; -- it's /* not a comment\n", "SELECT 2;"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batches, err := splitMSSQLBatches(test.script)
+			require.NoError(t, err)
+			assert.Equal(t, test.batches, batches)
+		})
+	}
+
+	t.Run("invalid count", func(t *testing.T) {
+		_, err := splitMSSQLBatches("SELECT 1;\nGO 0\n")
+		require.EqualError(t, err, `invalid batch separator count: "GO 0"`)
+	})
+}
@@ -1,9 +1,11 @@
+//go:build !custom || (custom && mysql)
 // +build !custom custom,mysql
 
 package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -13,6 +15,7 @@ import (
 
 func init() {
 	drivers["mysql"] = newMySQLDriver
+	driverCapabilities["mysql"] = (&mySQLDriver{}).Capabilities
 }
 
 func newMySQLDriver(dsn, tableName string) (Driver, error) {
@@ -27,9 +30,36 @@ func newMySQLDriver(dsn, tableName string) (Driver, error) {
 		return nil, err
 	}
 
+	versionTable := quoteMySQLIdentifier(tableName + "_schema_version")
+	historyTable := quoteMySQLIdentifier(tableName + "_history")
 	return &mySQLDriver{
 		db:        dbWrapper{db},
 		tableName: quoteMySQLIdentifier(tableName),
+		migrationsTableUpgrader: &migrationsTableUpgrader{
+			db:                 dbWrapper{db},
+			tableName:          quoteMySQLIdentifier(tableName),
+			versionTable:       versionTable,
+			createVersionTable: "CREATE TABLE IF NOT EXISTS " + versionTable + " (`version` INT PRIMARY KEY)",
+			addColumn:          sqlAddColumn(quoteMySQLIdentifier(tableName), quoteMySQLIdentifier, "VARCHAR(255)", "BIGINT"),
+			placeholder:        mySQLPlaceholder,
+			quote:              quoteMySQLIdentifier,
+			// MySQL implicitly commits DDL statements.
+			transactionalDDL: false,
+		},
+		tableHistoryRecorder: &tableHistoryRecorder{
+			db:              dbWrapper{db},
+			tableName:       historyTable,
+			migrationsTable: quoteMySQLIdentifier(tableName),
+			createTable:     "CREATE TABLE IF NOT EXISTS " + historyTable + " (" + historyColumnDefs(quoteMySQLIdentifier, "VARCHAR(255) PRIMARY KEY", "VARCHAR(255)", "TEXT") + ")",
+			placeholder:     mySQLPlaceholder,
+			quote:           quoteMySQLIdentifier,
+		},
+		Locker: &mySQLLocker{
+			db:  dbWrapper{db},
+			dsn: cfg.FormatDSN(),
+			// Lock names are server-wide and limited to 64 characters.
+			name: fmt.Sprintf("sql-migrate:%x", lockKey(cfg.DBName+"."+tableName)),
+		},
 	}, nil
 }
 
@@ -37,26 +67,47 @@ func quoteMySQLIdentifier(s string) string {
 	return "`" + strings.Replace(s, "`", "``", -1) + "`"
 }
 
+func mySQLPlaceholder(int) string {
+	return "?"
+}
+
 type mySQLDriver struct {
 	db        DB
 	tableName string
+	Locker
+	*migrationsTableUpgrader
+	*tableHistoryRecorder
+}
+
+func (o *mySQLDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   false,
+		MultiStatementExec: true,
+		AdvisoryLocking:    true,
+	}
 }
 
-func (o *mySQLDriver) ExecuteStep(st *Step, contents string) error {
+func (o *mySQLDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
 	// MySQL doesn't support DDL statements inside transactions.
 	// For this reason we don't even try to open a transaction.
 	if _, err := o.db.Exec(contents); err != nil {
 		return err
 	}
-	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward)
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
 }
 
-func (o *mySQLDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool) error {
-	query := "INSERT INTO " + o.tableName + " (`name`) VALUES (?)"
+func (o *mySQLDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *mySQLDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	query := insertMigrationQuery(o.tableName, quoteMySQLIdentifier, mySQLPlaceholder)
+	args := insertMigrationArgs(migrationName, meta)
 	if !forwardMigrated {
 		query = "DELETE FROM " + o.tableName + " WHERE `name`=?"
+		args = []interface{}{migrationName}
 	}
-	res, err := e.Exec(query, migrationName)
+	res, err := e.Exec(query, args...)
 	if err != nil {
 		return err
 	}
@@ -108,3 +159,86 @@ func (o *mySQLDriver) Close() {
 		log.Print(err)
 	}
 }
+
+// mySQLLocker implements the Locker interface with a named lock (GET_LOCK).
+// The lock is held by a dedicated connection that isn't used by the migration
+// steps. The server releases the lock automatically when this connection is
+// closed (e.g.: because the process dies).
+type mySQLLocker struct {
+	// db is used by LockStatus and ForceUnlock.
+	db   DB
+	dsn  string
+	name string
+	// lockDB holds the lock. It is nil when the lock isn't held.
+	lockDB *sql.DB
+}
+
+func (o *mySQLLocker) TryLock() (bool, error) {
+	db, err := sql.Open("mysql", o.dsn)
+	if err != nil {
+		return false, err
+	}
+	// The lock belongs to the session so all queries have to use
+	// the same connection.
+	db.SetMaxOpenConns(1)
+
+	var locked sql.NullInt64
+	if err := db.QueryRow("SELECT GET_LOCK(?, 0)", o.name).Scan(&locked); err != nil || locked.Int64 != 1 {
+		db.Close()
+		return false, err
+	}
+	o.lockDB = db
+	return true, nil
+}
+
+func (o *mySQLLocker) Unlock() error {
+	if o.lockDB == nil {
+		return errors.New("the migration lock isn't held")
+	}
+	defer func() {
+		o.lockDB.Close()
+		o.lockDB = nil
+	}()
+
+	var released sql.NullInt64
+	if err := o.lockDB.QueryRow("SELECT RELEASE_LOCK(?)", o.name).Scan(&released); err != nil {
+		return err
+	}
+	if released.Int64 != 1 {
+		return errors.New("the migration lock has been released by someone else")
+	}
+	return nil
+}
+
+// holderID returns the connection ID of the holder of the lock or 0.
+func (o *mySQLLocker) holderID() (int64, error) {
+	var id sql.NullInt64
+	_, err := queryRow(o.db, []interface{}{&id}, "SELECT IS_USED_LOCK(?)", o.name)
+	return id.Int64, err
+}
+
+func (o *mySQLLocker) LockStatus() (string, error) {
+	id, err := o.holderID()
+	if err != nil || id == 0 {
+		return "", err
+	}
+	holder := fmt.Sprintf("connection %d", id)
+	// The PROCESSLIST shows only the own connections of users without
+	// the PROCESS privilege.
+	var user, host string
+	ok, err := queryRow(o.db, []interface{}{&user, &host}, "SELECT `USER`, `HOST` FROM information_schema.PROCESSLIST WHERE `ID`=?", id)
+	if err == nil && ok {
+		holder += fmt.Sprintf(" (%s@%s)", user, host)
+	}
+	return holder, nil
+}
+
+// ForceUnlock kills the connection that holds the lock.
+func (o *mySQLLocker) ForceUnlock() error {
+	id, err := o.holderID()
+	if err != nil || id == 0 {
+		return err
+	}
+	_, err = o.db.Exec(fmt.Sprintf("KILL %d", id))
+	return err
+}
@@ -1,3 +1,4 @@
+//go:build !integration
 // +build !integration
 
 package main
@@ -45,11 +46,11 @@ func TestMySQLDriver(t *testing.T) {
 			gomock.InOrder(
 				db.EXPECT().Exec(query),
 				// mysqlDriver.SetMigrationState
-				db.EXPECT().Exec(gomock.Any(), migrationName).Return(res, nil),
+				db.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
 				res.EXPECT().RowsAffected().Return(int64(1), nil),
 			)
 
-			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query)
+			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
 			require.NoError(t, err)
 			ctrl.Finish()
 		})
@@ -65,7 +66,7 @@ func TestMySQLDriver(t *testing.T) {
 				db.EXPECT().Exec(query).Return(nil, assert.AnError),
 			)
 
-			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query)
+			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
 			require.Error(t, err)
 			ctrl.Finish()
 		})
@@ -0,0 +1,353 @@
+//go:build !custom || (custom && oracle)
+// +build !custom custom,oracle
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	// Pure-Go Oracle client that doesn't need the Oracle Instant Client.
+	_ "github.com/sijms/go-ora/v2"
+)
+
+func init() {
+	drivers["oracle"] = newOracleDriver
+	driverCapabilities["oracle"] = (&oracleDriver{}).Capabilities
+}
+
+func newOracleDriver(dsn, tableName string) (Driver, error) {
+	if err := checkOracleIdentifier(tableName); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("oracle", dsn)
+	if err != nil {
+		return nil, err
+	}
+	lockTable := quoteOracleIdentifier(tableName + "_lock")
+	versionTable := quoteOracleIdentifier(tableName + "_schema_version")
+	historyTable := quoteOracleIdentifier(tableName + "_history")
+	return &oracleDriver{
+		db:        dbWrapper{db},
+		tableName: quoteOracleIdentifier(tableName),
+		Locker: newTableLocker(dbWrapper{db}, lockTable, quoteOracleIdentifier(tableName),
+			oracleCreateTableIfNotExists(`CREATE TABLE `+lockTable+` ("id" NUMBER(10) PRIMARY KEY, "owner" VARCHAR2(255) NOT NULL)`),
+			oraclePlaceholder,
+			quoteOracleIdentifier,
+		),
+		migrationsTableUpgrader: &migrationsTableUpgrader{
+			db:                 dbWrapper{db},
+			tableName:          quoteOracleIdentifier(tableName),
+			versionTable:       versionTable,
+			createVersionTable: oracleCreateTableIfNotExists(`CREATE TABLE ` + versionTable + ` ("version" NUMBER(10) PRIMARY KEY)`),
+			addColumn:          sqlAddColumn(quoteOracleIdentifier(tableName), quoteOracleIdentifier, "VARCHAR2(255)", "NUMBER(19)"),
+			placeholder:        oraclePlaceholder,
+			quote:              quoteOracleIdentifier,
+			// Oracle implicitly commits DDL statements.
+			transactionalDDL: false,
+		},
+		tableHistoryRecorder: &tableHistoryRecorder{
+			db:              dbWrapper{db},
+			tableName:       historyTable,
+			migrationsTable: quoteOracleIdentifier(tableName),
+			createTable:     oracleCreateTableIfNotExists(`CREATE TABLE ` + historyTable + ` (` + historyColumnDefs(quoteOracleIdentifier, "VARCHAR2(255) PRIMARY KEY", "VARCHAR2(255)", "VARCHAR2(4000)") + `)`),
+			placeholder:     oraclePlaceholder,
+			quote:           quoteOracleIdentifier,
+		},
+	}, nil
+}
+
+func oraclePlaceholder(n int) string {
+	return fmt.Sprintf(":%d", n)
+}
+
+// checkOracleIdentifier returns an error if s can't be quoted because
+// Oracle doesn't allow double quotes inside quoted identifiers.
+func checkOracleIdentifier(s string) error {
+	if strings.Contains(s, `"`) {
+		return fmt.Errorf("invalid oracle identifier %q: quoted identifiers can't contain double quotes", s)
+	}
+	return nil
+}
+
+// quoteOracleIdentifier returns a case sensitive quoted identifier.
+// The identifier has to be validated with checkOracleIdentifier.
+func quoteOracleIdentifier(s string) string {
+	return `"` + s + `"`
+}
+
+func quoteOracleString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+type oracleDriver struct {
+	db        DB
+	tableName string
+	Locker
+	*migrationsTableUpgrader
+	*tableHistoryRecorder
+}
+
+func (o *oracleDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   false,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *oracleDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	// Oracle implicitly commits before and after DDL statements so using
+	// transactions would be pointless. We don't even try to open one.
+	for _, statement := range splitOracleScript(contents) {
+		if _, err := o.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *oracleDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *oracleDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	query := insertMigrationQuery(o.tableName, quoteOracleIdentifier, oraclePlaceholder)
+	args := insertMigrationArgs(migrationName, meta)
+	if !forwardMigrated {
+		query = `DELETE FROM ` + o.tableName + ` WHERE "name"=:1`
+		args = []interface{}{migrationName}
+	}
+	res, err := e.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if ra != 1 {
+		return fmt.Errorf("error setting state for migration %q in the migrations table (examine it with the status command and fix it manually)", migrationName)
+	}
+	return nil
+}
+
+func (o *oracleDriver) CreateMigrationsTable() error {
+	_, err := o.db.Exec(oracleCreateTableIfNotExists(`CREATE TABLE ` + o.tableName + ` (
+			"name" VARCHAR2(255) PRIMARY KEY,
+			"time" TIMESTAMP DEFAULT SYS_EXTRACT_UTC(SYSTIMESTAMP) NOT NULL
+		)`))
+	return err
+}
+
+// oracleCreateTableIfNotExists wraps a CREATE TABLE statement into a PL/SQL
+// block that ignores the error if the table already exists.
+// Older Oracle versions don't support CREATE TABLE IF NOT EXISTS.
+// ORA-00955: name is already used by an existing object.
+func oracleCreateTableIfNotExists(createTable string) string {
+	return `
+		BEGIN
+			EXECUTE IMMEDIATE ` + quoteOracleString(createTable) + `;
+		EXCEPTION
+			WHEN OTHERS THEN
+				IF SQLCODE != -955 THEN
+					RAISE;
+				END IF;
+		END;`
+}
+
+func (o *oracleDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
+	rows, err := o.db.Query(`SELECT "name" FROM ` + o.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning forward migration result set: %s", err)
+		}
+		names[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %s", err)
+	}
+	return names, nil
+}
+
+func (o *oracleDriver) Close() {
+	if err := o.db.Close(); err != nil {
+		log.Print(err)
+	}
+}
+
+// oraclePLSQLRegexp matches the beginning of statements that are PL/SQL
+// blocks or that contain PL/SQL code. These can contain semicolons so they
+// have to be terminated by a line that contains only a slash.
+var oraclePLSQLRegexp = regexp.MustCompile(`(?is)^\s*(?:DECLARE|BEGIN|CREATE\s+(?:OR\s+REPLACE\s+)?(?:(?:NON)?EDITIONABLE\s+)?(?:FUNCTION|PROCEDURE|PACKAGE|TRIGGER|TYPE|LIBRARY))\b`)
+
+type oracleScanState int
+
+const (
+	oracleScanCode oracleScanState = iota
+	oracleScanBlockComment
+	oracleScanString
+	oracleScanQString
+	oracleScanQuotedIdentifier
+)
+
+// splitOracleScript splits a script into statements that can be executed one
+// by one because Oracle rejects multiple statements in one Exec call.
+// It follows the conventions of SQL*Plus:
+//
+// SQL statements are terminated by a semicolon or by a line that contains only
+// a slash. The terminating semicolon isn't part of the returned statement.
+//
+// PL/SQL blocks (DECLARE/BEGIN blocks, CREATE FUNCTION, PROCEDURE, PACKAGE,
+// TRIGGER, TYPE, ...) are terminated only by a line that contains only a slash
+// and their semicolons are kept.
+func splitOracleScript(script string) []string {
+	var statements []string
+	var stmt bytes.Buffer
+	// head collects the beginning of the statement without comments
+	// in order to find out whether the statement is a PL/SQL block.
+	var head bytes.Buffer
+	hasCode := false
+	plsql := false
+	state := oracleScanCode
+	var qClose byte
+
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(stmt.String()))
+		}
+		stmt.Reset()
+		head.Reset()
+		hasCode = false
+		plsql = false
+	}
+
+	addToHead := func(s string) {
+		if head.Len() < 256 {
+			head.WriteString(s)
+		}
+	}
+
+	for _, line := range strings.SplitAfter(script, "\n") {
+		if state == oracleScanCode && strings.TrimSpace(line) == "/" {
+			flush()
+			continue
+		}
+
+		start := 0
+	scan:
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			var next byte
+			if i+1 < len(line) {
+				next = line[i+1]
+			}
+
+			switch state {
+			case oracleScanCode:
+				switch {
+				case c == '-' && next == '-':
+					addToHead(" ")
+					break scan
+				case c == '/' && next == '*':
+					addToHead(" ")
+					state = oracleScanBlockComment
+					i++
+				case (c == 'q' || c == 'Q') && next == '\'' && i+2 < len(line) && isOracleQQuoteStart(line, i):
+					hasCode = true
+					addToHead(line[i : i+3])
+					qClose = oracleQQuoteCloser(line[i+2])
+					state = oracleScanQString
+					i += 2
+				case c == '\'':
+					hasCode = true
+					addToHead("'")
+					state = oracleScanString
+				case c == '"':
+					hasCode = true
+					addToHead(`"`)
+					state = oracleScanQuotedIdentifier
+				case c == ';' && !plsql:
+					if oraclePLSQLRegexp.MatchString(head.String()) {
+						plsql = true
+						break
+					}
+					stmt.WriteString(line[start:i])
+					flush()
+					start = i + 1
+				default:
+					if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+						hasCode = true
+					}
+					addToHead(string(c))
+				}
+			case oracleScanBlockComment:
+				if c == '*' && next == '/' {
+					state = oracleScanCode
+					i++
+				}
+			case oracleScanString:
+				if c == '\'' {
+					if next == '\'' {
+						i++
+					} else {
+						state = oracleScanCode
+					}
+				}
+			case oracleScanQString:
+				if c == qClose && next == '\'' {
+					state = oracleScanCode
+					i++
+				}
+			case oracleScanQuotedIdentifier:
+				if c == '"' {
+					state = oracleScanCode
+				}
+			}
+		}
+		stmt.WriteString(line[start:])
+	}
+
+	flush()
+	return statements
+}
+
+// isOracleQQuoteStart returns true if the q at s[i] is the beginning of
+// an alternative quoting mechanism literal (q'[...]' or nq'[...]') and not
+// the last character of an identifier.
+func isOracleQQuoteStart(s string, i int) bool {
+	if i > 0 && (s[i-1] == 'n' || s[i-1] == 'N') {
+		i--
+	}
+	return i == 0 || !isOracleIdentifierChar(s[i-1])
+}
+
+func isOracleIdentifierChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c == '#'
+}
+
+func oracleQQuoteCloser(c byte) byte {
+	switch c {
+	case '[':
+		return ']'
+	case '{':
+		return '}'
+	case '(':
+		return ')'
+	case '<':
+		return '>'
+	default:
+		return c
+	}
+}
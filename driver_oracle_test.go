@@ -0,0 +1,164 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOracleDriver(t *testing.T) {
+	const tableName = "migrations"
+
+	newDriver := func(ctrl *gomock.Controller) (*oracleDriver, *MockDB) {
+		db := NewMockDB(ctrl)
+		return &oracleDriver{
+			db:        db,
+			tableName: tableName,
+		}, db
+	}
+
+	newTestStep := func(migrationName, filename string) *Step {
+		parsed, err := parseFilename(filename, ".fw", ".bw", ".nt", ".sql")
+		if err != nil {
+			panic(err)
+		}
+		return &Step{
+			Filename:       filename,
+			MigrationName:  migrationName,
+			ParsedFilename: parsed,
+		}
+	}
+
+	t.Run("ExecuteStep", func(t *testing.T) {
+		t.Run("success", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl)
+			res := NewMockResult(ctrl)
+
+			const migrationName = "0001"
+			const query = "CREATE TABLE t (id NUMBER);\nINSERT INTO t VALUES (1);\n"
+
+			gomock.InOrder(
+				db.EXPECT().Exec("CREATE TABLE t (id NUMBER)"),
+				db.EXPECT().Exec("INSERT INTO t VALUES (1)"),
+				// oracleDriver.SetMigrationState
+				db.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+				res.EXPECT().RowsAffected().Return(int64(1), nil),
+			)
+
+			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newDriver(ctrl)
+
+			const migrationName = "0001"
+			const query = "SELECT 1 FROM dual;\nSELECT 2 FROM dual;\n"
+
+			gomock.InOrder(
+				db.EXPECT().Exec("SELECT 1 FROM dual").Return(nil, assert.AnError),
+			)
+
+			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+			require.Error(t, err)
+			ctrl.Finish()
+		})
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, db := newDriver(ctrl)
+
+		db.EXPECT().Close()
+
+		driver.Close()
+
+		ctrl.Finish()
+	})
+}
+
+func TestSplitOracleScript(t *testing.T) {
+	tests := []*struct {
+		name       string
+		script     string
+		statements []string
+	}{
+		{
+			name:       "empty",
+			script:     "",
+			statements: nil,
+		},
+		{
+			name:       "SQL statements",
+			script:     "CREATE TABLE t (id NUMBER);\nINSERT INTO t VALUES (1); INSERT INTO t VALUES (2);\nSELECT 1 FROM dual",
+			statements: []string{"CREATE TABLE t (id NUMBER)", "INSERT INTO t VALUES (1)", "INSERT INTO t VALUES (2)", "SELECT 1 FROM dual"},
+		},
+		{
+			name:       "SQL statement terminated by slash",
+			script:     "INSERT INTO t\nVALUES (1)\n/\nINSERT INTO t VALUES (2);\n/\n",
+			statements: []string{"INSERT INTO t\nVALUES (1)", "INSERT INTO t VALUES (2)"},
+		},
+		{
+			name:       "comments",
+			script:     "-- comment;\n/* block; comment */\nINSERT INTO t VALUES (1); -- trailing;\n/* only a comment; */",
+			statements: []string{"-- comment;\n/* block; comment */\nINSERT INTO t VALUES (1)"},
+		},
+		{
+			name:       "quoted sections",
+			script:     "INSERT INTO \"t;\" VALUES ('a;''b');\nINSERT INTO t VALUES (q'[c;']d]');\nINSERT INTO t VALUES (nq'{e;}');",
+			statements: []string{"INSERT INTO \"t;\" VALUES ('a;''b')", "INSERT INTO t VALUES (q'[c;']d]')", "INSERT INTO t VALUES (nq'{e;}')"},
+		},
+		{
+			name: "PL/SQL blocks",
+			script: "CREATE OR REPLACE PROCEDURE p AS\nBEGIN\n  INSERT INTO t VALUES (1);\nEND;\n/\n" +
+				"-- anonymous block\nBEGIN\n  p;\nEND;\n/\n" +
+				"DECLARE\n  x NUMBER;\nBEGIN\n  x := 1;\nEND;\n/\n" +
+				"CREATE OR REPLACE EDITIONABLE TRIGGER trg BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n  NULL;\nEND;\n/\n" +
+				"DROP PROCEDURE p;\n",
+			statements: []string{
+				"CREATE OR REPLACE PROCEDURE p AS\nBEGIN\n  INSERT INTO t VALUES (1);\nEND;",
+				"-- anonymous block\nBEGIN\n  p;\nEND;",
+				"DECLARE\n  x NUMBER;\nBEGIN\n  x := 1;\nEND;",
+				"CREATE OR REPLACE EDITIONABLE TRIGGER trg BEFORE INSERT ON t FOR EACH ROW\nBEGIN\n  NULL;\nEND;",
+				"DROP PROCEDURE p",
+			},
+		},
+		{
+			name:       "PL/SQL block without terminating slash",
+			script:     "BEGIN\n  NULL;\nEND;\n",
+			statements: []string{"BEGIN\n  NULL;\nEND;"},
+		},
+		{
+			name:       "slash inside string and comment",
+			script:     "INSERT INTO t VALUES ('\n/\n');\n/*\n/\n*/\nSELECT 1 FROM dual;",
+			statements: []string{"INSERT INTO t VALUES ('\n/\n')", "/*\n/\n*/\nSELECT 1 FROM dual"},
+		},
+		{
+			name:       "identifiers ending with q aren't q-quotes",
+			script:     "SELECT seq'x' FROM dual; SELECT 2 FROM dual;",
+			statements: []string{"SELECT seq'x' FROM dual", "SELECT 2 FROM dual"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.statements, splitOracleScript(test.script))
+		})
+	}
+}
+
+func TestCheckOracleIdentifier(t *testing.T) {
+	assert.NoError(t, checkOracleIdentifier("migrations"))
+	assert.EqualError(t, checkOracleIdentifier(`a"b`), `invalid oracle identifier "a\"b": quoted identifiers can't contain double quotes`)
+
+	_, err := newOracleDriver("", `a"b`)
+	assert.Error(t, err)
+}
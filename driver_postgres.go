@@ -1,9 +1,12 @@
-// +build !custom custom,postgres
+//go:build !custom || (custom && postgres) || (custom && cockroach)
+// +build !custom custom,postgres custom,cockroach
 
 package main
 
 import (
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"strings"
@@ -11,36 +14,153 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// The values of the -schema and -create_schema options.
+var (
+	postgresSchema       string
+	postgresCreateSchema bool
+)
+
+// The options are registered here instead of driver_postgres_register.go
+// because they are used also by the cockroach driver.
 func init() {
-	drivers["postgres"] = newPostgresDriver
+	driverFlags = append(driverFlags, func(fs *flag.FlagSet) {
+		fs.StringVar(&postgresSchema, "schema", "", "Postgres and cockroach only: the schema of the migrations table. "+
+			"The search_path of the session is set to this schema before executing the migration steps.")
+		fs.BoolVar(&postgresCreateSchema, "create_schema", false, "Postgres and cockroach only: the init command creates the schema specified by the -schema option if it doesn't exist.")
+	})
 }
 
 func newPostgresDriver(dsn, tableName string) (Driver, error) {
+	db, err := openPostgresDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := newPostgresDriverWithDB(db, tableName)
+	d.Locker = &postgresAdvisoryLocker{
+		db:  d.db,
+		dsn: dsn,
+		key: lockKey(d.tableName),
+	}
+	return &d, nil
+}
+
+// openPostgresDB is used also by the cockroach driver that speaks the postgres
+// wire protocol.
+func openPostgresDB(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
-	return &postgresDriver{
-		db:        dbWrapper{db},
-		tableName: quotePostgresIdentifier(tableName),
-	}, nil
+	if postgresSchema != "" {
+		// The search_path is a session setting. Using a single connection
+		// makes sure that the migration steps are executed in the session
+		// that has the search_path set.
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+func newPostgresDriverWithDB(db *sql.DB, tableName string) postgresDriver {
+	d := postgresDriver{
+		db:           dbWrapper{db},
+		createSchema: postgresCreateSchema,
+	}
+	if postgresSchema != "" {
+		d.schema = quotePostgresIdentifier(postgresSchema)
+	}
+	d.tableName = d.qualifiedName(tableName)
+	versionTable := d.qualifiedName(tableName + "_schema_version")
+	d.migrationsTableUpgrader = &migrationsTableUpgrader{
+		db:                 d.db,
+		tableName:          d.tableName,
+		versionTable:       versionTable,
+		createVersionTable: `CREATE TABLE IF NOT EXISTS ` + versionTable + ` ("version" INT PRIMARY KEY)`,
+		addColumn:          sqlAddColumn(d.tableName, quotePostgresIdentifier, "TEXT", "BIGINT"),
+		placeholder:        postgresPlaceholder,
+		quote:              quotePostgresIdentifier,
+		transactionalDDL:   true,
+	}
+	historyTable := d.qualifiedName(tableName + "_history")
+	d.tableHistoryRecorder = &tableHistoryRecorder{
+		db:              d.db,
+		tableName:       historyTable,
+		migrationsTable: d.tableName,
+		createTable:     `CREATE TABLE IF NOT EXISTS ` + historyTable + ` (` + historyColumnDefs(quotePostgresIdentifier, "TEXT PRIMARY KEY", "TEXT", "TEXT") + `)`,
+		placeholder:     postgresPlaceholder,
+		quote:           quotePostgresIdentifier,
+	}
+	return d
 }
 
 func quotePostgresIdentifier(s string) string {
 	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
 }
 
+func postgresPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
 type postgresDriver struct {
-	db        DB
+	db DB
+	// tableName is schema qualified if schema isn't empty.
 	tableName string
+	// schema is the quoted schema name or an empty string.
+	schema       string
+	createSchema bool
+	// Locker is a postgresAdvisoryLocker in case of postgres
+	// and a tableLocker in case of cockroach.
+	Locker
+	*migrationsTableUpgrader
+	*tableHistoryRecorder
 }
 
-func (o *postgresDriver) ExecuteStep(st *Step, contents string) error {
+// qualifiedName returns the quoted name of a table of the schema of the
+// driver or the quoted unqualified name if the driver doesn't have a schema.
+func (o *postgresDriver) qualifiedName(table string) string {
+	if o.schema == "" {
+		return quotePostgresIdentifier(table)
+	}
+	return o.schema + "." + quotePostgresIdentifier(table)
+}
+
+// setSearchPath sets the search_path of the session to the schema
+// of the driver if it has one.
+func (o *postgresDriver) setSearchPath() error {
+	if o.schema == "" {
+		return nil
+	}
+	_, err := o.db.Exec(`SET search_path TO ` + o.schema)
+	return err
+}
+
+// createSchemaIfNeeded creates the schema of the driver if the -create_schema
+// option is set.
+func (o *postgresDriver) createSchemaIfNeeded() error {
+	if o.schema == "" || !o.createSchema {
+		return nil
+	}
+	_, err := o.db.Exec(`CREATE SCHEMA IF NOT EXISTS ` + o.schema)
+	return err
+}
+
+func (o *postgresDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   true,
+		MultiStatementExec: true,
+		AdvisoryLocking:    true,
+	}
+}
+
+func (o *postgresDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	if err := o.setSearchPath(); err != nil {
+		return err
+	}
+
 	performStep := func(e Execer) error {
 		if _, err := e.Exec(contents); err != nil {
 			return err
 		}
-		return o.SetMigrationState(e, st.MigrationName, st.ParsedFilename.Direction == DirectionForward)
+		return o.SetMigrationState(e, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
 	}
 
 	if st.ParsedFilename.NoTx {
@@ -58,12 +178,21 @@ func (o *postgresDriver) ExecuteStep(st *Step, contents string) error {
 	return tx.Commit()
 }
 
-func (o *postgresDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool) error {
-	query := `INSERT INTO ` + o.tableName + ` ("name") VALUES ($1)`
+func (o *postgresDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	if err := o.setSearchPath(); err != nil {
+		return err
+	}
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *postgresDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	query := insertMigrationQuery(o.tableName, quotePostgresIdentifier, postgresPlaceholder)
+	args := insertMigrationArgs(migrationName, meta)
 	if !forwardMigrated {
 		query = `DELETE FROM ` + o.tableName + ` WHERE "name"=$1`
+		args = []interface{}{migrationName}
 	}
-	res, err := e.Exec(query, migrationName)
+	res, err := e.Exec(query, args...)
 	if err != nil {
 		return err
 	}
@@ -78,6 +207,9 @@ func (o *postgresDriver) SetMigrationState(e Execer, migrationName string, forwa
 }
 
 func (o *postgresDriver) CreateMigrationsTable() error {
+	if err := o.createSchemaIfNeeded(); err != nil {
+		return err
+	}
 	_, err := o.db.Exec(`
 		CREATE TABLE IF NOT EXISTS ` + o.tableName + `(
 			"name" TEXT PRIMARY KEY,
@@ -113,3 +245,83 @@ func (o *postgresDriver) Close() {
 		log.Print(err)
 	}
 }
+
+// postgresAdvisoryLocker implements the Locker interface with a session
+// level advisory lock. The lock is held by a dedicated connection that isn't
+// used by the migration steps. The database releases the lock automatically
+// when this connection is closed (e.g.: because the process dies).
+type postgresAdvisoryLocker struct {
+	// db is used by LockStatus and ForceUnlock.
+	db  DB
+	dsn string
+	key int64
+	// lockDB holds the lock. It is nil when the lock isn't held.
+	lockDB *sql.DB
+}
+
+func (o *postgresAdvisoryLocker) TryLock() (bool, error) {
+	db, err := sql.Open("postgres", o.dsn)
+	if err != nil {
+		return false, err
+	}
+	// The lock belongs to the session so all queries have to use
+	// the same connection.
+	db.SetMaxOpenConns(1)
+
+	var locked bool
+	if err := db.QueryRow(`SELECT pg_try_advisory_lock($1)`, o.key).Scan(&locked); err != nil || !locked {
+		db.Close()
+		return false, err
+	}
+	o.lockDB = db
+	return true, nil
+}
+
+func (o *postgresAdvisoryLocker) Unlock() error {
+	if o.lockDB == nil {
+		return errors.New("the migration lock isn't held")
+	}
+	defer func() {
+		o.lockDB.Close()
+		o.lockDB = nil
+	}()
+
+	var unlocked bool
+	if err := o.lockDB.QueryRow(`SELECT pg_advisory_unlock($1)`, o.key).Scan(&unlocked); err != nil {
+		return err
+	}
+	if !unlocked {
+		return errors.New("the migration lock has been released by someone else")
+	}
+	return nil
+}
+
+// postgresLockCondition selects the advisory lock from pg_locks.
+// A bigint advisory lock key is stored in the classid (high 32 bits)
+// and the objid (low 32 bits) columns.
+const postgresLockCondition = `
+	l.locktype = 'advisory' AND l.granted AND l.objsubid = 1 AND
+	l.database = (SELECT oid FROM pg_database WHERE datname = current_database()) AND
+	l.classid::bigint = $1 AND l.objid::bigint = $2`
+
+func (o *postgresAdvisoryLocker) LockStatus() (string, error) {
+	var holder string
+	_, err := queryRow(o.db, []interface{}{&holder}, `
+		SELECT format('pid %s (%s@%s) since %s', a.pid, a.usename,
+			coalesce(host(a.client_addr), 'local'), a.backend_start)
+		FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE `+postgresLockCondition,
+		o.key>>32, o.key&0xffffffff,
+	)
+	return holder, err
+}
+
+// ForceUnlock terminates the session that holds the lock.
+func (o *postgresAdvisoryLocker) ForceUnlock() error {
+	_, err := o.db.Exec(`
+		SELECT pg_terminate_backend(l.pid) FROM pg_locks l
+		WHERE `+postgresLockCondition,
+		o.key>>32, o.key&0xffffffff,
+	)
+	return err
+}
@@ -0,0 +1,12 @@
+//go:build !custom || (custom && postgres)
+// +build !custom custom,postgres
+
+package main
+
+// The postgres driver implementation is compiled also into custom cockroach
+// builds because the cockroach driver is based on it. The registration of
+// the postgres driver is in this separate file to keep it out of those builds.
+func init() {
+	drivers["postgres"] = newPostgresDriver
+	driverCapabilities["postgres"] = (&postgresDriver{}).Capabilities
+}
@@ -1,3 +1,4 @@
+//go:build !integration
 // +build !integration
 
 package main
@@ -48,12 +49,12 @@ func TestPostgresDriver(t *testing.T) {
 					db.EXPECT().Begin().Return(tx, nil),
 					tx.EXPECT().Exec(query),
 					// postgresDriver.SetMigrationState
-					tx.EXPECT().Exec(gomock.Any(), migrationName).Return(res, nil),
+					tx.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
 					res.EXPECT().RowsAffected().Return(int64(1), nil),
 					tx.EXPECT().Commit(),
 				)
 
-				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query)
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
 				require.NoError(t, err)
 				ctrl.Finish()
 			})
@@ -69,11 +70,11 @@ func TestPostgresDriver(t *testing.T) {
 				gomock.InOrder(
 					db.EXPECT().Exec(query),
 					// postgresDriver.SetMigrationState
-					db.EXPECT().Exec(gomock.Any(), migrationName).Return(res, nil),
+					db.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
 					res.EXPECT().RowsAffected().Return(int64(1), nil),
 				)
 
-				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.nt.sql"), query)
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.nt.sql"), query, testMetadata)
 				require.NoError(t, err)
 				ctrl.Finish()
 			})
@@ -94,7 +95,7 @@ func TestPostgresDriver(t *testing.T) {
 					tx.EXPECT().Rollback(),
 				)
 
-				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query)
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
 				require.Error(t, err)
 				ctrl.Finish()
 			})
@@ -110,13 +111,106 @@ func TestPostgresDriver(t *testing.T) {
 					db.EXPECT().Exec(query).Return(nil, assert.AnError),
 				)
 
-				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.nt.sql"), query)
+				err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.nt.sql"), query, testMetadata)
 				require.Error(t, err)
 				ctrl.Finish()
 			})
 		})
 	})
 
+	t.Run("MarkStep", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, db := newDriver(ctrl)
+		res := NewMockResult(ctrl)
+
+		const migrationName = "0001"
+
+		gomock.InOrder(
+			// postgresDriver.SetMigrationState
+			db.EXPECT().Exec(gomock.Any(), testMetadataArgs(migrationName)...).Return(res, nil),
+			res.EXPECT().RowsAffected().Return(int64(1), nil),
+		)
+
+		err := driver.MarkStep(newTestStep(migrationName, "1.fw.sql"), testMetadata)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		newSchemaDriver := func(ctrl *gomock.Controller, createSchema bool) (*postgresDriver, *MockDB) {
+			db := NewMockDB(ctrl)
+			return &postgresDriver{
+				db:           db,
+				tableName:    `"my schema"."migrations"`,
+				schema:       `"my schema"`,
+				createSchema: createSchema,
+			}, db
+		}
+
+		t.Run("ExecuteStep sets the search_path", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newSchemaDriver(ctrl, false)
+			tx := NewMockTX(ctrl)
+			res := NewMockResult(ctrl)
+
+			const migrationName = "0001"
+			const query = "SELECT 1;"
+
+			gomock.InOrder(
+				db.EXPECT().Exec(`SET search_path TO "my schema"`),
+				db.EXPECT().Begin().Return(tx, nil),
+				tx.EXPECT().Exec(query),
+				tx.EXPECT().Exec(`INSERT INTO "my schema"."migrations" ("name", "checksum", "duration_ms", "sql_migrate_version", "os_user", "hostname", "applied_by") VALUES ($1, $2, $3, $4, $5, $6, $7)`, testMetadataArgs(migrationName)...).Return(res, nil),
+				res.EXPECT().RowsAffected().Return(int64(1), nil),
+				tx.EXPECT().Commit(),
+			)
+
+			err := driver.ExecuteStep(newTestStep(migrationName, "1.fw.sql"), query, testMetadata)
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("ExecuteStep search_path error", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newSchemaDriver(ctrl, false)
+
+			db.EXPECT().Exec(`SET search_path TO "my schema"`).Return(nil, assert.AnError)
+
+			err := driver.ExecuteStep(newTestStep("0001", "1.fw.nt.sql"), "SELECT 1;", testMetadata)
+			require.Equal(t, assert.AnError, err)
+			ctrl.Finish()
+		})
+
+		t.Run("CreateMigrationsTable without -create_schema", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newSchemaDriver(ctrl, false)
+
+			db.EXPECT().Exec(gomock.Any()).Do(func(query string, args ...interface{}) {
+				assert.Contains(t, query, `CREATE TABLE IF NOT EXISTS "my schema"."migrations"(`)
+			})
+
+			err := driver.CreateMigrationsTable()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+
+		t.Run("CreateMigrationsTable with -create_schema", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			driver, db := newSchemaDriver(ctrl, true)
+
+			gomock.InOrder(
+				db.EXPECT().Exec(`CREATE SCHEMA IF NOT EXISTS "my schema"`),
+				db.EXPECT().Exec(gomock.Any()).Do(func(query string, args ...interface{}) {
+					assert.Contains(t, query, `CREATE TABLE IF NOT EXISTS "my schema"."migrations"(`)
+				}),
+			)
+
+			err := driver.CreateMigrationsTable()
+			require.NoError(t, err)
+			ctrl.Finish()
+		})
+	})
+
 	t.Run("Close", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		driver, db := newDriver(ctrl)
@@ -128,3 +222,20 @@ func TestPostgresDriver(t *testing.T) {
 		ctrl.Finish()
 	})
 }
+
+func TestNewPostgresDriverWithDB(t *testing.T) {
+	defer func(schema string, createSchema bool) {
+		postgresSchema, postgresCreateSchema = schema, createSchema
+	}(postgresSchema, postgresCreateSchema)
+
+	postgresSchema, postgresCreateSchema = "", false
+	d := newPostgresDriverWithDB(nil, "migrations")
+	assert.Equal(t, `"migrations"`, d.tableName)
+	assert.Equal(t, "", d.schema)
+
+	postgresSchema, postgresCreateSchema = `my"schema`, true
+	d = newPostgresDriverWithDB(nil, "my.table")
+	assert.Equal(t, `"my""schema"."my.table"`, d.tableName)
+	assert.Equal(t, `"my""schema"`, d.schema)
+	assert.True(t, d.createSchema)
+}
@@ -0,0 +1,171 @@
+//go:build !custom || (custom && sqlite)
+// +build !custom custom,sqlite
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	// Pure-Go SQLite implementation that works with CGO_ENABLED=0.
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	drivers["sqlite"] = newSQLiteDriver
+	driverCapabilities["sqlite"] = (&sqliteDriver{}).Capabilities
+}
+
+func newSQLiteDriver(dsn, tableName string) (Driver, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows only one writer at a time and an in-memory database
+	// (":memory:") exists only inside the connection that created it.
+	// Using a single connection avoids "database is locked" errors
+	// and makes in-memory databases behave as expected.
+	db.SetMaxOpenConns(1)
+
+	lockTable := quoteSQLiteIdentifier(tableName + "_lock")
+	versionTable := quoteSQLiteIdentifier(tableName + "_schema_version")
+	historyTable := quoteSQLiteIdentifier(tableName + "_history")
+	return &sqliteDriver{
+		db:        dbWrapper{db},
+		tableName: quoteSQLiteIdentifier(tableName),
+		Locker: newTableLocker(dbWrapper{db}, lockTable, quoteSQLiteIdentifier(tableName),
+			`CREATE TABLE IF NOT EXISTS `+lockTable+` ("id" INTEGER PRIMARY KEY, "owner" TEXT NOT NULL)`,
+			sqlitePlaceholder,
+			quoteSQLiteIdentifier,
+		),
+		migrationsTableUpgrader: &migrationsTableUpgrader{
+			db:                 dbWrapper{db},
+			tableName:          quoteSQLiteIdentifier(tableName),
+			versionTable:       versionTable,
+			createVersionTable: `CREATE TABLE IF NOT EXISTS ` + versionTable + ` ("version" INTEGER PRIMARY KEY)`,
+			addColumn:          sqlAddColumn(quoteSQLiteIdentifier(tableName), quoteSQLiteIdentifier, "TEXT", "INTEGER"),
+			placeholder:        sqlitePlaceholder,
+			quote:              quoteSQLiteIdentifier,
+			transactionalDDL:   true,
+		},
+		tableHistoryRecorder: &tableHistoryRecorder{
+			db:              dbWrapper{db},
+			tableName:       historyTable,
+			migrationsTable: quoteSQLiteIdentifier(tableName),
+			createTable:     `CREATE TABLE IF NOT EXISTS ` + historyTable + ` (` + historyColumnDefs(quoteSQLiteIdentifier, "TEXT PRIMARY KEY", "TEXT", "TEXT") + `)`,
+			placeholder:     sqlitePlaceholder,
+			quote:           quoteSQLiteIdentifier,
+		},
+	}, nil
+}
+
+func quoteSQLiteIdentifier(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+func sqlitePlaceholder(int) string {
+	return "?"
+}
+
+type sqliteDriver struct {
+	db        DB
+	tableName string
+	Locker
+	*migrationsTableUpgrader
+	*tableHistoryRecorder
+}
+
+func (o *sqliteDriver) Capabilities() DriverCapabilities {
+	return DriverCapabilities{
+		TransactionalDDL:   true,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *sqliteDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	performStep := func(e Execer) error {
+		if _, err := e.Exec(contents); err != nil {
+			return err
+		}
+		return o.SetMigrationState(e, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+	}
+
+	if st.ParsedFilename.NoTx {
+		return performStep(o.db)
+	}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := performStep(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (o *sqliteDriver) MarkStep(st *Step, meta *MigrationMetadata) error {
+	return o.SetMigrationState(o.db, st.MigrationName, st.ParsedFilename.Direction == DirectionForward, meta)
+}
+
+func (o *sqliteDriver) SetMigrationState(e Execer, migrationName string, forwardMigrated bool, meta *MigrationMetadata) error {
+	query := insertMigrationQuery(o.tableName, quoteSQLiteIdentifier, sqlitePlaceholder)
+	args := insertMigrationArgs(migrationName, meta)
+	if !forwardMigrated {
+		query = `DELETE FROM ` + o.tableName + ` WHERE "name"=?`
+		args = []interface{}{migrationName}
+	}
+	res, err := e.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if ra != 1 {
+		return fmt.Errorf("error setting state for migration %q in the migrations table (examine it with the status command and fix it manually)", migrationName)
+	}
+	return nil
+}
+
+func (o *sqliteDriver) CreateMigrationsTable() error {
+	_, err := o.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + o.tableName + `(
+			"name" TEXT PRIMARY KEY,
+			"time" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`,
+	)
+	return err
+}
+
+func (o *sqliteDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
+	rows, err := o.db.Query(`SELECT "name" FROM ` + o.tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning forward migration result set: %s", err)
+		}
+		names[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %s", err)
+	}
+	return names, nil
+}
+
+func (o *sqliteDriver) Close() {
+	if err := o.db.Close(); err != nil {
+		log.Print(err)
+	}
+}
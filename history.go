@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyTimeFormat is a fixed width UTC timestamp format. The timestamps of
+// the history table are stored as strings in this format because it is
+// portable across databases and its lexicographical order is chronological.
+const historyTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+// maxHistoryErrorLength is the maximum number of characters stored in the
+// error column of the history table. It fits into 4000 bytes with any
+// UTF-8 encoded text.
+const maxHistoryErrorLength = 1000
+
+// Values of the status column of the history table.
+const (
+	historyStatusSucceeded = "succeeded"
+	historyStatusFailed    = "failed"
+	// historyStatusMarked is the status of the steps that have updated the
+	// migrations table without being executed.
+	historyStatusMarked = "marked"
+)
+
+// historyColumns are the columns of the history table in the order of the
+// values returned by HistoryEntry.Values. All of them are strings.
+var historyColumns = []string{
+	"id", "migration_name", "filename", "direction", "status",
+	"started_at", "finished_at", "error", "os_user", "hostname", "applied_by",
+}
+
+// HistoryEntry is a row of the history table. The history table is an
+// append-only log that has a row for every executed migration step
+// regardless of its success.
+type HistoryEntry struct {
+	// ID starts with the StartTime so the entries can be sorted by ID.
+	ID            string
+	MigrationName string
+	Filename      string
+	Direction     string
+	Status        string
+	StartTime     time.Time
+	EndTime       time.Time
+	Error         string
+	OSUser        string
+	Hostname      string
+	AppliedBy     string
+}
+
+// newHistoryEntry returns the history entry of an executed step.
+// The start time of the step is meta.StartTime.
+func newHistoryEntry(st *Step, meta *MigrationMetadata, endTime time.Time, err error) *HistoryEntry {
+	h := &HistoryEntry{
+		ID:            historyID(meta.StartTime),
+		MigrationName: st.MigrationName,
+		Filename:      st.Filename,
+		Direction:     st.ParsedFilename.Direction.String(),
+		Status:        historyStatusSucceeded,
+		StartTime:     meta.StartTime,
+		EndTime:       endTime,
+		OSUser:        meta.OSUser,
+		Hostname:      meta.Hostname,
+		AppliedBy:     meta.AppliedBy,
+	}
+	if err != nil {
+		h.Status = historyStatusFailed
+		h.Error = truncate(err.Error(), maxHistoryErrorLength)
+	}
+	return h
+}
+
+// historyID returns a unique ID that starts with the formatted start time.
+func historyID(start time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%x", formatHistoryTime(start), b)
+}
+
+func formatHistoryTime(t time.Time) string {
+	return t.UTC().Format(historyTimeFormat)
+}
+
+func truncate(s string, maxRunes int) string {
+	r := []rune(s)
+	if len(r) <= maxRunes {
+		return s
+	}
+	return string(r[:maxRunes])
+}
+
+// Values returns the values of the historyColumns.
+func (o *HistoryEntry) Values() []interface{} {
+	return []interface{}{
+		o.ID, o.MigrationName, o.Filename, o.Direction, o.Status,
+		formatHistoryTime(o.StartTime), formatHistoryTime(o.EndTime), o.Error,
+		o.OSUser, o.Hostname, o.AppliedBy,
+	}
+}
+
+// newHistoryEntryFromValues is the inverse of HistoryEntry.Values.
+func newHistoryEntryFromValues(values []string) (*HistoryEntry, error) {
+	if len(values) != len(historyColumns) {
+		return nil, fmt.Errorf("invalid number of history columns: %d", len(values))
+	}
+	var times [2]time.Time
+	for i, s := range values[5:7] {
+		t, err := time.Parse(historyTimeFormat, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp in the history table: %q", s)
+		}
+		times[i] = t
+	}
+	return &HistoryEntry{
+		ID:            values[0],
+		MigrationName: values[1],
+		Filename:      values[2],
+		Direction:     values[3],
+		Status:        values[4],
+		StartTime:     times[0],
+		EndTime:       times[1],
+		Error:         values[7],
+		OSUser:        values[8],
+		Hostname:      values[9],
+		AppliedBy:     values[10],
+	}, nil
+}
+
+// sortHistory sorts the entries in chronological order.
+func sortHistory(entries []*HistoryEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+}
+
+// historyColumnDefs returns the column definitions of the history table for
+// CREATE TABLE statements. The error column has the longTextType.
+func historyColumnDefs(quote func(string) string, idType, textType, longTextType string) string {
+	defs := make([]string, len(historyColumns))
+	for i, c := range historyColumns {
+		typ := textType
+		switch c {
+		case "id":
+			typ = idType
+		case "error":
+			typ = longTextType
+		}
+		defs[i] = quote(c) + " " + typ
+	}
+	return strings.Join(defs, ", ")
+}
+
+// errNoHistoryTable is returned by HistoryRecorder.LoadHistory if the history
+// table doesn't exist. The read-only history command doesn't create it.
+var errNoHistoryTable = errors.New("the history table doesn't exist")
+
+// tableHistoryRecorder implements the HistoryRecorder interface for the
+// drivers that use database/sql.
+type tableHistoryRecorder struct {
+	db DB
+	// tableName is the quoted name of the history table.
+	tableName string
+	// migrationsTable is the quoted name of the migrations table. It is
+	// probed to detect the missing history table.
+	migrationsTable string
+	// createTable is the statement that creates the history table if it
+	// doesn't exist.
+	createTable string
+	placeholder func(n int) string
+	quote       func(string) string
+}
+
+func (o *tableHistoryRecorder) CreateHistoryTable() error {
+	if _, err := o.db.Exec(o.createTable); err != nil {
+		return fmt.Errorf("error creating history table: %s", err)
+	}
+	return nil
+}
+
+func (o *tableHistoryRecorder) RecordHistory(h *HistoryEntry) error {
+	columns := make([]string, len(historyColumns))
+	params := make([]string, len(historyColumns))
+	for i, c := range historyColumns {
+		columns[i] = o.quote(c)
+		params[i] = o.placeholder(i + 1)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", o.tableName, strings.Join(columns, ", "), strings.Join(params, ", "))
+	_, err := o.db.Exec(query, h.Values()...)
+	return err
+}
+
+func (o *tableHistoryRecorder) LoadHistory() ([]*HistoryEntry, error) {
+	columns := make([]string, len(historyColumns))
+	for i, c := range historyColumns {
+		columns[i] = o.quote(c)
+	}
+	rows, err := o.db.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), o.tableName))
+	if err != nil {
+		// The query fails if the history table doesn't exist. The migrations
+		// table is probed to tell it apart from other errors.
+		if probeTable(o.db, o.migrationsTable) == nil {
+			return nil, errNoHistoryTable
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*HistoryEntry
+	for rows.Next() {
+		values := make([]string, len(historyColumns))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &nullString{&values[i]}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("error scanning history result set: %s", err)
+		}
+		h, err := newHistoryEntryFromValues(values)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %s", err)
+	}
+	sortHistory(entries)
+	return entries, nil
+}
+
+// nullString scans NULL values as empty strings. Oracle stores empty
+// strings as NULL.
+type nullString struct {
+	s *string
+}
+
+func (o *nullString) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*o.s = ""
+	case string:
+		*o.s = v
+	case []byte:
+		*o.s = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T", src)
+	}
+	return nil
+}
+
+// recordHistory records the execution of a step if the driver implements the
+// HistoryRecorder interface.
+func recordHistory(d Driver, st *Step, meta *MigrationMetadata, execErr error) error {
+	return recordHistoryEntry(d, newHistoryEntry(st, meta, time.Now(), execErr))
+}
+
+func recordHistoryEntry(d Driver, h *HistoryEntry) error {
+	hr, ok := d.(HistoryRecorder)
+	if !ok {
+		return nil
+	}
+	if err := hr.RecordHistory(h); err != nil {
+		return fmt.Errorf("error recording the execution of %s in the history table: %s", h.Filename, err)
+	}
+	return nil
+}
+
+// parseHistoryTime parses the value of the -since and -until options of the
+// history command. The value can be an RFC3339 timestamp, a date (UTC) or a
+// duration before now (e.g.: 24h).
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected an RFC3339 timestamp, a date or a duration)", s)
+}
+
+// filterHistory returns the entries of the migration (name or filename) that
+// have been started in the [since, until) interval. Empty or zero filters
+// are ignored.
+func filterHistory(entries []*HistoryEntry, migration string, since, until time.Time) []*HistoryEntry {
+	var result []*HistoryEntry
+	for _, h := range entries {
+		if migration != "" && migration != h.MigrationName && migration != h.Filename {
+			continue
+		}
+		if !since.IsZero() && h.StartTime.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !h.StartTime.Before(until) {
+			continue
+		}
+		result = append(result, h)
+	}
+	return result
+}
+
+// String formats the entry for the history command.
+func (o *HistoryEntry) String() string {
+	s := fmt.Sprintf("%s %-8s %-9s %s (%s, %s@%s",
+		formatHistoryTime(o.StartTime), o.Direction, o.Status, o.Filename,
+		o.EndTime.Sub(o.StartTime), o.OSUser, o.Hostname)
+	if o.AppliedBy != "" {
+		s += ", applied by " + o.AppliedBy
+	}
+	s += ")"
+	if o.Error != "" {
+		s += "\n    error: " + strings.Replace(o.Error, "\n", "\n    ", -1)
+	}
+	return s
+}
@@ -0,0 +1,235 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// historyRecorderDriver is a mock driver that implements the optional
+// HistoryRecorder interface.
+type historyRecorderDriver struct {
+	*MockDriver
+	*MockHistoryRecorder
+}
+
+func TestHistoryEntry(t *testing.T) {
+	start := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	meta := *testMetadata
+	meta.StartTime = start
+	st := newTestStep("1_users.bw.sql")
+	st.MigrationName = "1_users"
+
+	t.Run("succeeded", func(t *testing.T) {
+		h := newHistoryEntry(st, &meta, start.Add(1500*time.Millisecond), nil)
+		assert.True(t, strings.HasPrefix(h.ID, "2020-01-02T03:04:05.000006Z-"))
+		assert.Equal(t, "backward", h.Direction)
+		assert.Equal(t, historyStatusSucceeded, h.Status)
+		assert.Equal(t, "2020-01-02T03:04:05.000006Z backward succeeded 1_users.bw.sql (1.5s, user@host, applied by applied_by)", h.String())
+
+		values := h.Values()
+		strValues := make([]string, len(values))
+		for i, v := range values {
+			strValues[i] = v.(string)
+		}
+		h2, err := newHistoryEntryFromValues(strValues)
+		require.NoError(t, err)
+		assert.Equal(t, h, h2)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		h := newHistoryEntry(st, &meta, start, errors.New("line 1\nline 2"))
+		assert.Equal(t, historyStatusFailed, h.Status)
+		assert.Equal(t, "line 1\nline 2", h.Error)
+		assert.True(t, strings.HasSuffix(h.String(), ")\n    error: line 1\n    line 2"))
+	})
+
+	t.Run("long error", func(t *testing.T) {
+		h := newHistoryEntry(st, &meta, start, errors.New(strings.Repeat("é", maxHistoryErrorLength+1)))
+		assert.Equal(t, strings.Repeat("é", maxHistoryErrorLength), h.Error)
+	})
+
+	t.Run("invalid timestamp", func(t *testing.T) {
+		values := make([]string, len(historyColumns))
+		_, err := newHistoryEntryFromValues(values)
+		assert.EqualError(t, err, `invalid timestamp in the history table: ""`)
+	})
+}
+
+func TestFilterHistory(t *testing.T) {
+	t0 := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	entries := []*HistoryEntry{
+		{MigrationName: "1", Filename: "1.fw.sql", StartTime: t0},
+		{MigrationName: "2", Filename: "2.fw.sql", StartTime: t0.Add(time.Hour)},
+		{MigrationName: "1", Filename: "1.bw.sql", StartTime: t0.Add(2 * time.Hour)},
+	}
+
+	assert.Equal(t, entries, filterHistory(entries, "", time.Time{}, time.Time{}))
+	assert.Equal(t, []*HistoryEntry{entries[0], entries[2]}, filterHistory(entries, "1", time.Time{}, time.Time{}))
+	assert.Equal(t, []*HistoryEntry{entries[2]}, filterHistory(entries, "1.bw.sql", time.Time{}, time.Time{}))
+	assert.Equal(t, []*HistoryEntry{entries[1]}, filterHistory(entries, "", t0.Add(time.Hour), t0.Add(2*time.Hour)))
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tc := range []struct {
+		s        string
+		expected time.Time
+	}{
+		{"", time.Time{}},
+		{"24h", now.Add(-24 * time.Hour)},
+		{"2020-01-01T10:00:00Z", time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{"2019-12-31", time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)},
+	} {
+		parsed, err := parseHistoryTime(tc.s, now)
+		require.NoError(t, err, tc.s)
+		assert.True(t, tc.expected.Equal(parsed), tc.s)
+	}
+
+	_, err := parseHistoryTime("yesterday", now)
+	assert.EqualError(t, err, `invalid time "yesterday" (expected an RFC3339 timestamp, a date or a duration)`)
+}
+
+func TestTableHistoryRecorder(t *testing.T) {
+	newRecorder := func(ctrl *gomock.Controller) (*tableHistoryRecorder, *MockDB) {
+		db := NewMockDB(ctrl)
+		return &tableHistoryRecorder{
+			db:              db,
+			tableName:       `"history"`,
+			migrationsTable: `"migrations"`,
+			createTable:     `CREATE TABLE "history"`,
+			placeholder:     postgresPlaceholder,
+			quote:           quoteTestIdentifier,
+		}, db
+	}
+
+	t.Run("CreateHistoryTable", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		r, db := newRecorder(ctrl)
+
+		db.EXPECT().Exec(`CREATE TABLE "history"`).Return(nil, errors.New("test"))
+
+		err := r.CreateHistoryTable()
+		assert.EqualError(t, err, "error creating history table: test")
+		ctrl.Finish()
+	})
+
+	t.Run("RecordHistory", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		r, db := newRecorder(ctrl)
+		h := &HistoryEntry{ID: "id"}
+
+		db.EXPECT().Exec(`INSERT INTO "history" ("id", "migration_name", "filename", "direction", "status", `+
+			`"started_at", "finished_at", "error", "os_user", "hostname", "applied_by") `+
+			`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`, h.Values()...)
+
+		err := r.RecordHistory(h)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("LoadHistory error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		r, db := newRecorder(ctrl)
+
+		gomock.InOrder(
+			db.EXPECT().Query(gomock.Any()).Return(nil, errors.New("test")),
+			db.EXPECT().Query(`SELECT 1 FROM "migrations" WHERE 1=0`).Return(nil, errors.New("no connection")),
+		)
+
+		_, err := r.LoadHistory()
+		assert.EqualError(t, err, "test")
+		ctrl.Finish()
+	})
+}
+
+func TestHistoryColumnDefs(t *testing.T) {
+	assert.Equal(t, `"id" TEXT PRIMARY KEY, "migration_name" TEXT, "filename" TEXT, "direction" TEXT, "status" TEXT, `+
+		`"started_at" TEXT, "finished_at" TEXT, "error" CLOB, "os_user" TEXT, "hostname" TEXT, "applied_by" TEXT`,
+		historyColumnDefs(quoteTestIdentifier, "TEXT PRIMARY KEY", "TEXT", "CLOB"))
+}
+
+func TestExecuteAndLogHistory(t *testing.T) {
+	const dir = "my/dir"
+	const query = "my sql query"
+	step := newTestStep("1.fw.sql")
+	step.MigrationName = "1"
+
+	newDriver := func(ctrl *gomock.Controller) (*MockDriver, *MockHistoryRecorder, Driver) {
+		d := NewMockDriver(ctrl)
+		hr := NewMockHistoryRecorder(ctrl)
+		return d, hr, historyRecorderDriver{d, hr}
+	}
+
+	t.Run("succeeded", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d, hr, driver := newDriver(ctrl)
+		printer := NewMockPrinter(ctrl)
+		fileReader := NewMockFileReader(ctrl)
+
+		gomock.InOrder(
+			printer.EXPECT().Print(gomock.Any()),
+			fileReader.EXPECT().ReadFile(gomock.Any()).Return([]byte(query), nil),
+			d.EXPECT().ExecuteStep(step, query, gomock.Any()),
+			hr.EXPECT().RecordHistory(gomock.Any()).Do(func(h *HistoryEntry) {
+				assert.Equal(t, "1.fw.sql", h.Filename)
+				assert.Equal(t, historyStatusSucceeded, h.Status)
+			}),
+			printer.EXPECT().Print("OK\n"),
+		)
+
+		err := step.ExecuteAndLog(dir, driver, fileReader, printer, testMetadata)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d, hr, driver := newDriver(ctrl)
+		printer := NewMockPrinter(ctrl)
+		fileReader := NewMockFileReader(ctrl)
+
+		gomock.InOrder(
+			printer.EXPECT().Print(gomock.Any()),
+			fileReader.EXPECT().ReadFile(gomock.Any()).Return([]byte(query), nil),
+			d.EXPECT().ExecuteStep(step, query, gomock.Any()).Return(errors.New("test")),
+			hr.EXPECT().RecordHistory(gomock.Any()).Do(func(h *HistoryEntry) {
+				assert.Equal(t, historyStatusFailed, h.Status)
+				assert.Equal(t, "test", h.Error)
+			}),
+			printer.EXPECT().Print("FAILED\n"),
+		)
+
+		err := step.ExecuteAndLog(dir, driver, fileReader, printer, testMetadata)
+		assert.EqualError(t, err, "test")
+		ctrl.Finish()
+	})
+
+	t.Run("history error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d, hr, driver := newDriver(ctrl)
+		printer := NewMockPrinter(ctrl)
+		fileReader := NewMockFileReader(ctrl)
+
+		gomock.InOrder(
+			printer.EXPECT().Print(gomock.Any()),
+			fileReader.EXPECT().ReadFile(gomock.Any()).Return([]byte(query), nil),
+			d.EXPECT().ExecuteStep(step, query, gomock.Any()),
+			hr.EXPECT().RecordHistory(gomock.Any()).Return(errors.New("test")),
+			printer.EXPECT().Print("OK\n"),
+		)
+
+		err := step.ExecuteAndLog(dir, driver, fileReader, printer, testMetadata)
+		assert.EqualError(t, err, "error recording the execution of 1.fw.sql in the history table: test")
+		ctrl.Finish()
+	})
+}
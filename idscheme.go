@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IDScheme defines the format, the order and the validation rules of the
+// migration IDs. It can be selected with the -id_scheme option.
+type IDScheme int
+
+const (
+	// IDSchemeSequential IDs are integers that start at 1 and increase by 1
+	// without gaps.
+	IDSchemeSequential IDScheme = iota
+	// IDSchemeTimestamp IDs are integers with gaps. They are typically UTC
+	// timestamps in YYYYMMDDhhmmss format.
+	IDSchemeTimestamp
+	// IDSchemeSemver IDs are Flyway style versions with a "V" prefix
+	// (e.g.: V1.2.3). Versions that differ only in trailing zeros
+	// (e.g.: V1.2 and V1.2.0) are equal.
+	IDSchemeSemver
+)
+
+// semverPrefix is the prefix of the IDs of the IDSchemeSemver.
+const semverPrefix = "V"
+
+var idSchemeNames = []string{
+	IDSchemeSequential: "sequential",
+	IDSchemeTimestamp:  "timestamp",
+	IDSchemeSemver:     "semver",
+}
+
+func (o IDScheme) String() string {
+	if o >= 0 && int(o) < len(idSchemeNames) {
+		return idSchemeNames[o]
+	}
+	return fmt.Sprintf("IDScheme(%v)", int(o))
+}
+
+func parseIDScheme(s string) (IDScheme, error) {
+	for i, name := range idSchemeNames {
+		if s == name {
+			return IDScheme(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid ID scheme %q (expected one of: %s)", s, strings.Join(idSchemeNames, ", "))
+}
+
+// parseID parses the ID prefix of a filename and returns the rest of it.
+func (o IDScheme) parseID(fn string, parsed *ParsedFilename) (rest string, err error) {
+	if o == IDSchemeSemver {
+		return parseSemverID(fn, parsed)
+	}
+
+	i := strings.IndexFunc(fn, func(c rune) bool {
+		return c < '0' || c > '9'
+	})
+
+	switch {
+	case fn == "" || i == 0:
+		return "", errors.New("missing numeric ID prefix")
+	case i < 0:
+		parsed.IDStr, fn = fn, ""
+	default:
+		parsed.IDStr, fn = fn[:i], fn[i:]
+	}
+
+	id, err := strconv.ParseInt(parsed.IDStr, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid ID: %s", err)
+	}
+	parsed.ID = id
+	return fn, nil
+}
+
+func parseSemverID(fn string, parsed *ParsedFilename) (rest string, err error) {
+	isDigit := func(i int) bool {
+		return i < len(fn) && fn[i] >= '0' && fn[i] <= '9'
+	}
+	if !strings.HasPrefix(fn, semverPrefix) || !isDigit(len(semverPrefix)) {
+		return "", fmt.Errorf("missing %q version ID prefix (e.g.: %s1.2.3)", semverPrefix, semverPrefix)
+	}
+
+	var version []int64
+	i := len(semverPrefix)
+	for {
+		j := i
+		for isDigit(j) {
+			j++
+		}
+		n, err := strconv.ParseInt(fn[i:j], 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid version ID: %s", err)
+		}
+		version = append(version, n)
+		if j < len(fn) && fn[j] == '.' && isDigit(j+1) {
+			i = j + 1
+			continue
+		}
+		parsed.IDStr = fn[:j]
+		parsed.Version = version
+		return fn[j:], nil
+	}
+}
+
+// migrationName returns the name that identifies the migration in the
+// migrations table. The sequential scheme normalises the ID to 4 digits.
+func (o IDScheme) migrationName(parsed *ParsedFilename) string {
+	if o == IDSchemeSequential {
+		return fmt.Sprintf("%04d%s", parsed.ID, parsed.Description)
+	}
+	return parsed.IDStr + parsed.Description
+}
+
+// less reports whether the ID of a is less than the ID of b.
+func (o IDScheme) less(a, b *ParsedFilename) bool {
+	if o == IDSchemeSemver {
+		return compareVersions(a.Version, b.Version) < 0
+	}
+	return a.ID < b.ID
+}
+
+// idNames returns the strings that can be used to refer to the migration
+// by its ID (e.g.: as the value of the -target option).
+func (o IDScheme) idNames(parsed *ParsedFilename) []string {
+	if o == IDSchemeSemver {
+		return []string{parsed.IDStr, strings.TrimPrefix(parsed.IDStr, semverPrefix), parsed.idKey()}
+	}
+	return []string{strconv.FormatInt(parsed.ID, 10), parsed.IDStr}
+}
+
+// idErrors checks the IDs of the sorted migrations and returns all problems.
+func (o IDScheme) idErrors(sorted []*Migration) []error {
+	if o != IDSchemeSequential || len(sorted) == 0 {
+		return nil
+	}
+	var errs []error
+	if sorted[0].Forward.ParsedFilename.ID != 1 {
+		errs = append(errs, fmt.Errorf("the first migration ID must be 1 but it is %v", sorted[0].Forward.ParsedFilename.ID))
+	}
+	for i, m := range sorted[1:] {
+		if m.Forward.ParsedFilename.ID != sorted[i].Forward.ParsedFilename.ID+1 {
+			errs = append(errs, fmt.Errorf("missing migration ID (gap): %v", sorted[i].Forward.ParsedFilename.ID+1))
+		}
+	}
+	return errs
+}
+
+// idKey is the same for the steps of a migration: the forward and backward
+// filenames can have differently formatted IDs (e.g.: 001 and 1).
+func (o *ParsedFilename) idKey() string {
+	if o.Version == nil {
+		return strconv.FormatInt(o.ID, 10)
+	}
+	v := o.Version
+	for len(v) > 1 && v[len(v)-1] == 0 {
+		v = v[:len(v)-1]
+	}
+	a := make([]string, len(v))
+	for i, n := range v {
+		a[i] = strconv.FormatInt(n, 10)
+	}
+	return strings.Join(a, ".")
+}
+
+// compareVersions returns -1, 0 or 1. Missing components are treated as zeros.
+func compareVersions(a, b []int64) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int64
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
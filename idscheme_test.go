@@ -0,0 +1,138 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIDScheme(t *testing.T) {
+	for _, scheme := range []IDScheme{IDSchemeSequential, IDSchemeTimestamp, IDSchemeSemver} {
+		parsed, err := parseIDScheme(scheme.String())
+		require.NoError(t, err)
+		assert.Equal(t, scheme, parsed)
+	}
+
+	_, err := parseIDScheme("woof")
+	assert.EqualError(t, err, `invalid ID scheme "woof" (expected one of: sequential, timestamp, semver)`)
+}
+
+func TestParseSemverFilename(t *testing.T) {
+	tests := []*struct {
+		filename string
+		parsed   ParsedFilename
+	}{
+		{
+			filename: "V1.nt.fw.sql",
+			parsed: ParsedFilename{
+				IDStr:     "V1",
+				Version:   []int64{1},
+				Direction: DirectionForward,
+				NoTx:      true,
+			},
+		},
+		{
+			filename: "V1.2.03__add_users.nt.bw.sql",
+			parsed: ParsedFilename{
+				IDStr:       "V1.2.03",
+				Version:     []int64{1, 2, 3},
+				Description: "__add_users",
+				Direction:   DirectionBackward,
+				NoTx:        true,
+			},
+		},
+		{
+			filename: "V2.fw.sql",
+			parsed: ParsedFilename{
+				IDStr:     "V2",
+				Version:   []int64{2},
+				Direction: DirectionForward,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			parsed, err := IDSchemeSemver.parseFilename(test.filename, ".fw", ".bw", ".nt", ".sql")
+			require.NoError(t, err)
+			assert.Equal(t, test.parsed, *parsed)
+		})
+	}
+
+	for _, fn := range []string{"1.fw.sql", "V.fw.sql", "v1.fw.sql", "V.1.fw.sql"} {
+		t.Run(fn, func(t *testing.T) {
+			_, err := IDSchemeSemver.parseFilename(fn, ".fw", ".bw", ".nt", ".sql")
+			assert.EqualError(t, err, `missing "V" version ID prefix (e.g.: V1.2.3)`)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions([]int64{1, 2}, []int64{1, 2, 0}))
+	assert.Equal(t, -1, compareVersions([]int64{1, 2}, []int64{1, 10}))
+	assert.Equal(t, 1, compareVersions([]int64{2}, []int64{1, 99}))
+	assert.Equal(t, -1, compareVersions([]int64{1}, []int64{1, 0, 1}))
+}
+
+func TestIDSchemes(t *testing.T) {
+	load := func(scheme IDScheme, filenames ...string) (*Migrations, error) {
+		return loadMigrationsDir("", scheme, "", ".back", ".notx", ".sql", func(string) []string {
+			return filenames
+		})
+	}
+
+	t.Run("timestamp", func(t *testing.T) {
+		ms, err := load(IDSchemeTimestamp, "20261016120000_b.sql", "20261015090000_a.sql", "20261015090000_a.back.sql")
+		require.NoError(t, err)
+		require.Len(t, ms.Sorted, 2)
+		assert.Equal(t, "20261015090000_a", ms.Sorted[0].Forward.MigrationName)
+		assert.Equal(t, "20261015090000_a", ms.Sorted[0].Backward.MigrationName)
+		assert.Equal(t, "20261016120000_b", ms.Sorted[1].Forward.MigrationName)
+		assert.Equal(t, map[string]int{
+			"20261015090000":       0,
+			"20261015090000_a":     0,
+			"20261015090000_a.sql": 0,
+			"20261016120000":       1,
+			"20261016120000_b":     1,
+			"20261016120000_b.sql": 1,
+		}, ms.Names)
+	})
+
+	t.Run("semver", func(t *testing.T) {
+		ms, err := load(IDSchemeSemver, "V1.10__c.sql", "V1.2__b.sql", "V1__a.sql", "V1.2.0__b.back.sql")
+		require.NoError(t, err)
+		require.Len(t, ms.Sorted, 3)
+		assert.Equal(t, "V1__a", ms.Sorted[0].Forward.MigrationName)
+		assert.Equal(t, "V1.2__b", ms.Sorted[1].Forward.MigrationName)
+		assert.Equal(t, "V1.2__b", ms.Sorted[1].Backward.MigrationName)
+		assert.Equal(t, "V1.10__c", ms.Sorted[2].Forward.MigrationName)
+		assert.Equal(t, map[string]int{
+			"V1":           0,
+			"1":            0,
+			"V1__a":        0,
+			"V1__a.sql":    0,
+			"V1.2":         1,
+			"1.2":          1,
+			"V1.2__b":      1,
+			"V1.2__b.sql":  1,
+			"V1.10":        2,
+			"1.10":         2,
+			"V1.10__c":     2,
+			"V1.10__c.sql": 2,
+		}, ms.Names)
+	})
+
+	t.Run("duplicate semver", func(t *testing.T) {
+		_, err := load(IDSchemeSemver, "V1.2__a.sql", "V1.2.0__b.sql")
+		assert.EqualError(t, err, `duplicate forward migration for ID 1.2: "V1.2__a.sql" and "V1.2.0__b.sql"`)
+	})
+
+	t.Run("sequential requires no gaps", func(t *testing.T) {
+		_, err := load(IDSchemeSequential, "20261016120000_b.sql", "20261015090000_a.sql")
+		assert.EqualError(t, err, `the first migration ID must be 1 but it is 20261015090000`)
+	})
+}
@@ -0,0 +1,105 @@
+//go:build (!custom && integration) || (custom && cassandra && integration)
+// +build !custom,integration custom,cassandra,integration
+
+package integrationtest
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/require"
+)
+
+// The shared tests can't be used with cassandra because they work with
+// database/sql and their migration files aren't valid CQL.
+func TestCassandra(t *testing.T) {
+	dsn := mustGetEnv(t, "CASSANDRA_DSN")
+	session := connectAndResetCassandra(t, dsn)
+	defer session.Close()
+
+	sqlMigrate := func(om outputMatcher, command string, args ...string) {
+		args = append([]string{command, "-driver", "cassandra", "-dsn", dsn,
+			"-migrations_table", migrationsTable}, args...)
+		runSQLMigrate(t, true, om, nil, args...)
+	}
+	dirArgs := []string{"-dir", "testdata/cassandra", "-ext", ".cql", "-no_driver_warnings"}
+
+	sqlMigrate(nil, "init")
+	sqlMigrate(outputLinesMatcher(
+		"Warning: the cassandra driver doesn't support transactional DDL. "+
+			"The following steps don't have the notx filename suffix but they are executed without transactions "+
+			"and they aren't rolled back on error: 0001_initial.cql, 0001_initial.back.cql, 0002.cql, 0002.back.cql",
+		"[ ] 0001_initial.cql",
+		"[ ] 0002.cql",
+	), "status", "-dir", "testdata/cassandra", "-ext", ".cql")
+	sqlMigrate(outputLinesMatcher(
+		"[ ] 0001_initial.cql",
+		"[ ] 0002.cql",
+	), "status", dirArgs...)
+
+	sqlMigrate(outputLinesMatcher(
+		"forward-migrate 0001_initial.cql ... OK",
+		"forward-migrate 0002.cql ... OK",
+	), "goto", append(dirArgs, "-target", "latest")...)
+	require.Equal(t, []string{"0001_initial", "0002"}, getCassandraForwardMigrated(t, session))
+	require.Equal(t, []string{"1", "2"}, getCassandraTestEvents(t, session))
+
+	var description string
+	err := session.Query(`SELECT description FROM test_items WHERE id=1`).Scan(&description)
+	require.NoError(t, err)
+	require.Equal(t, "uses the new column", description)
+
+	sqlMigrate(outputLinesMatcher(
+		"backward-migrate 0002.back.cql ... OK",
+		"backward-migrate 0001_initial.back.cql ... OK",
+	), "goto", append(dirArgs, "-target", "initial")...)
+	require.Empty(t, getCassandraForwardMigrated(t, session))
+	require.Equal(t, []string{"1", "2", "2.back", "1.back"}, getCassandraTestEvents(t, session))
+}
+
+func connectAndResetCassandra(t *testing.T, dsn string) *gocql.Session {
+	u, err := url.Parse(dsn)
+	require.NoError(t, err)
+	cluster := gocql.NewCluster(u.Host)
+	cluster.Keyspace = strings.TrimPrefix(u.Path, "/")
+	session, err := cluster.CreateSession()
+	require.NoError(t, err)
+
+	for _, query := range []string{
+		`DROP TABLE IF EXISTS test_items`,
+		`DROP TABLE IF EXISTS ` + migrationsTable,
+		`DROP TABLE IF EXISTS test_events`,
+		`CREATE TABLE test_events (p int, id timeuuid, event_name text, PRIMARY KEY (p, id))`,
+	} {
+		if err := session.Query(query).Exec(); err != nil {
+			session.Close()
+			require.NoError(t, err)
+		}
+	}
+	return session
+}
+
+func getCassandraTestEvents(t *testing.T, session *gocql.Session) []string {
+	return queryCassandraStrings(t, session, `SELECT event_name FROM test_events WHERE p=0`)
+}
+
+func getCassandraForwardMigrated(t *testing.T, session *gocql.Session) []string {
+	// The rows of different partitions aren't sorted by name.
+	names := queryCassandraStrings(t, session, `SELECT name FROM `+migrationsTable)
+	sort.Strings(names)
+	return names
+}
+
+func queryCassandraStrings(t *testing.T, session *gocql.Session, query string) []string {
+	var result []string
+	var s string
+	iter := session.Query(query).Iter()
+	for iter.Scan(&s) {
+		result = append(result, s)
+	}
+	require.NoError(t, iter.Close())
+	return result
+}
@@ -0,0 +1,97 @@
+//go:build (!custom && integration) || (custom && clickhouse && integration)
+// +build !custom,integration custom,clickhouse,integration
+
+package integrationtest
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClickHouse(t *testing.T) {
+	sdb := &clickHouseSharedTestDB{
+		driver: "clickhouse",
+		dsn:    mustGetEnv(t, "CLICKHOUSE_DSN"),
+	}
+
+	sharedTest(t, sdb)
+}
+
+// clickHouseSharedTestDB implements the sharedTestDB interface.
+type clickHouseSharedTestDB struct {
+	driver string
+	dsn    string
+}
+
+func (o *clickHouseSharedTestDB) DriverName() string {
+	return o.driver
+}
+
+func (o *clickHouseSharedTestDB) DSN() string {
+	return o.dsn
+}
+
+func (o *clickHouseSharedTestDB) ConnectAndResetDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("clickhouse", o.dsn)
+	require.NoError(t, err)
+	defer func() {
+		if t.Failed() {
+			db.Close()
+		}
+	}()
+
+	// ClickHouse can execute only one statement per query.
+	for _, query := range []string{
+		`DROP TABLE IF EXISTS ` + quoteClickHouseIdentifier(migrationsTable),
+		`CREATE TABLE IF NOT EXISTS test_events (
+			id DateTime64(9) DEFAULT now64(9),
+			event_name String
+		) ENGINE = MergeTree() ORDER BY id`,
+		`TRUNCATE TABLE test_events`,
+	} {
+		_, err = db.Exec(query)
+		require.NoError(t, err)
+	}
+	runSQLMigrate(t, true, nil, nil, "init", "-driver", "clickhouse", "-dsn", o.dsn, "-migrations_table", migrationsTable)
+	return db
+}
+
+func (o *clickHouseSharedTestDB) GetTestEvents(t *testing.T, db *sql.DB) []string {
+	var events []string
+	rows, err := db.Query(`SELECT event_name FROM test_events ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var e string
+		err := rows.Scan(&e)
+		require.NoError(t, err, "error scanning test_event result set")
+		events = append(events, e)
+	}
+	require.NoError(t, rows.Err())
+	return events
+}
+
+func (o *clickHouseSharedTestDB) GetForwardMigrated(t *testing.T, db *sql.DB) []string {
+	var migrationNames []string
+	rows, err := db.Query("SELECT name FROM " + quoteClickHouseIdentifier(migrationsTable) + " GROUP BY name HAVING argMax(applied, version) = 1 ORDER BY name")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		require.NoError(t, err, "error scanning migration result set")
+		migrationNames = append(migrationNames, name)
+	}
+	require.NoError(t, rows.Err())
+	return migrationNames
+}
+
+func quoteClickHouseIdentifier(s string) string {
+	return "`" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "`", "\\`", -1) + "`"
+}
@@ -0,0 +1,90 @@
+//go:build (!custom && integration) || (custom && cockroach && integration)
+// +build !custom,integration custom,cockroach,integration
+
+package integrationtest
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCockroach(t *testing.T) {
+	sdb := &cockroachSharedTestDB{
+		driver: "cockroach",
+		dsn:    mustGetEnv(t, "COCKROACH_DSN"),
+	}
+
+	sharedTest(t, sdb)
+}
+
+// cockroachSharedTestDB implements the sharedTestDB interface.
+type cockroachSharedTestDB struct {
+	driver string
+	dsn    string
+}
+
+func (o *cockroachSharedTestDB) DriverName() string {
+	return o.driver
+}
+
+func (o *cockroachSharedTestDB) DSN() string {
+	return o.dsn
+}
+
+func (o *cockroachSharedTestDB) ConnectAndResetDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("postgres", o.dsn)
+	require.NoError(t, err)
+	defer func() {
+		if t.Failed() {
+			db.Close()
+		}
+	}()
+
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS "` + migrationsTable + `";
+		CREATE SEQUENCE IF NOT EXISTS test_events_id_seq;
+		CREATE TABLE IF NOT EXISTS test_events (
+			id INT PRIMARY KEY DEFAULT nextval('test_events_id_seq'),
+			event_name TEXT NOT NULL
+		);
+		TRUNCATE TABLE test_events;`,
+	)
+	require.NoError(t, err)
+	runSQLMigrate(t, true, nil, nil, "init", "-driver", "cockroach", "-dsn", o.dsn, "-migrations_table", migrationsTable)
+	return db
+}
+
+func (o *cockroachSharedTestDB) GetTestEvents(t *testing.T, db *sql.DB) []string {
+	var events []string
+	rows, err := db.Query(`SELECT event_name FROM test_events ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var e string
+		err := rows.Scan(&e)
+		require.NoError(t, err, "error scanning test_event result set")
+		events = append(events, e)
+	}
+	require.NoError(t, rows.Err())
+	return events
+}
+
+func (o *cockroachSharedTestDB) GetForwardMigrated(t *testing.T, db *sql.DB) []string {
+	var migrationNames []string
+	rows, err := db.Query(`SELECT name FROM "` + migrationsTable + `" ORDER BY name`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		require.NoError(t, err, "error scanning migration result set")
+		migrationNames = append(migrationNames, name)
+	}
+	require.NoError(t, rows.Err())
+	return migrationNames
+}
@@ -0,0 +1,95 @@
+//go:build (!custom && integration) || (custom && mssql && integration)
+// +build !custom,integration custom,mssql,integration
+
+package integrationtest
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	_ "github.com/microsoft/go-mssqldb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMSSQL(t *testing.T) {
+	sdb := &mssqlSharedTestDB{
+		driver: "mssql",
+		dsn:    mustGetEnv(t, "MSSQL_DSN"),
+	}
+
+	sharedTest(t, sdb)
+}
+
+// mssqlSharedTestDB implements the sharedTestDB interface.
+type mssqlSharedTestDB struct {
+	driver string
+	dsn    string
+}
+
+func (o *mssqlSharedTestDB) DriverName() string {
+	return o.driver
+}
+
+func (o *mssqlSharedTestDB) DSN() string {
+	return o.dsn
+}
+
+func (o *mssqlSharedTestDB) ConnectAndResetDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlserver", o.dsn)
+	require.NoError(t, err)
+	defer func() {
+		if t.Failed() {
+			db.Close()
+		}
+	}()
+
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS ` + quoteMSSQLIdentifier(migrationsTable) + `;
+		IF OBJECT_ID(N'test_events', N'U') IS NULL
+		CREATE TABLE test_events (
+			id INT IDENTITY PRIMARY KEY,
+			event_name NVARCHAR(255) NOT NULL
+		);
+		TRUNCATE TABLE test_events;`,
+	)
+	require.NoError(t, err)
+	runSQLMigrate(t, true, nil, nil, "init", "-driver", "mssql", "-dsn", o.dsn, "-migrations_table", migrationsTable)
+	return db
+}
+
+func (o *mssqlSharedTestDB) GetTestEvents(t *testing.T, db *sql.DB) []string {
+	var events []string
+	rows, err := db.Query(`SELECT event_name FROM test_events ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var e string
+		err := rows.Scan(&e)
+		require.NoError(t, err, "error scanning test_event result set")
+		events = append(events, e)
+	}
+	require.NoError(t, rows.Err())
+	return events
+}
+
+func (o *mssqlSharedTestDB) GetForwardMigrated(t *testing.T, db *sql.DB) []string {
+	var migrationNames []string
+	rows, err := db.Query(`SELECT name FROM ` + quoteMSSQLIdentifier(migrationsTable) + ` ORDER BY name`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		require.NoError(t, err, "error scanning migration result set")
+		migrationNames = append(migrationNames, name)
+	}
+	require.NoError(t, rows.Err())
+	return migrationNames
+}
+
+func quoteMSSQLIdentifier(s string) string {
+	return "[" + strings.Replace(s, "]", "]]", -1) + "]"
+}
@@ -1,3 +1,4 @@
+//go:build (!custom && integration) || (custom && mysql && integration)
 // +build !custom,integration custom,mysql,integration
 
 package integrationtest
@@ -0,0 +1,113 @@
+//go:build (!custom && integration) || (custom && oracle && integration)
+// +build !custom,integration custom,oracle,integration
+
+package integrationtest
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	_ "github.com/sijms/go-ora/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOracle(t *testing.T) {
+	sdb := &oracleSharedTestDB{
+		driver: "oracle",
+		dsn:    mustGetEnv(t, "ORACLE_DSN"),
+	}
+
+	sharedTest(t, sdb)
+}
+
+// oracleSharedTestDB implements the sharedTestDB interface.
+type oracleSharedTestDB struct {
+	driver string
+	dsn    string
+}
+
+func (o *oracleSharedTestDB) DriverName() string {
+	return o.driver
+}
+
+func (o *oracleSharedTestDB) DSN() string {
+	return o.dsn
+}
+
+func (o *oracleSharedTestDB) ConnectAndResetDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("oracle", o.dsn)
+	require.NoError(t, err)
+	defer func() {
+		if t.Failed() {
+			db.Close()
+		}
+	}()
+
+	// Oracle can execute only one statement per Exec call.
+	// ORA-00942: table or view does not exist
+	// ORA-00955: name is already used by an existing object
+	for _, query := range []string{
+		`BEGIN
+			EXECUTE IMMEDIATE 'DROP TABLE ` + quoteOracleIdentifier(migrationsTable) + `';
+		EXCEPTION
+			WHEN OTHERS THEN
+				IF SQLCODE != -942 THEN
+					RAISE;
+				END IF;
+		END;`,
+		`BEGIN
+			EXECUTE IMMEDIATE 'CREATE TABLE test_events (
+				id NUMBER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+				event_name VARCHAR2(255) NOT NULL
+			)';
+		EXCEPTION
+			WHEN OTHERS THEN
+				IF SQLCODE != -955 THEN
+					RAISE;
+				END IF;
+		END;`,
+		`TRUNCATE TABLE test_events`,
+	} {
+		_, err = db.Exec(query)
+		require.NoError(t, err)
+	}
+	runSQLMigrate(t, true, nil, nil, "init", "-driver", "oracle", "-dsn", o.dsn, "-migrations_table", migrationsTable)
+	return db
+}
+
+func (o *oracleSharedTestDB) GetTestEvents(t *testing.T, db *sql.DB) []string {
+	var events []string
+	rows, err := db.Query(`SELECT event_name FROM test_events ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var e string
+		err := rows.Scan(&e)
+		require.NoError(t, err, "error scanning test_event result set")
+		events = append(events, e)
+	}
+	require.NoError(t, rows.Err())
+	return events
+}
+
+func (o *oracleSharedTestDB) GetForwardMigrated(t *testing.T, db *sql.DB) []string {
+	var migrationNames []string
+	rows, err := db.Query(`SELECT "name" FROM ` + quoteOracleIdentifier(migrationsTable) + ` ORDER BY "name"`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		require.NoError(t, err, "error scanning migration result set")
+		migrationNames = append(migrationNames, name)
+	}
+	require.NoError(t, rows.Err())
+	return migrationNames
+}
+
+func quoteOracleIdentifier(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
@@ -1,3 +1,4 @@
+//go:build (!custom && integration) || (custom && postgres && integration)
 // +build !custom,integration custom,postgres,integration
 
 package integrationtest
@@ -12,3 +12,39 @@ echo "+-------+"
 echo "| mysql |"
 echo "+-------+"
 ./run_mysql_tests.sh
+
+echo
+echo "+--------+"
+echo "| sqlite |"
+echo "+--------+"
+./run_sqlite_tests.sh
+
+echo
+echo "+-------+"
+echo "| mssql |"
+echo "+-------+"
+./run_mssql_tests.sh
+
+echo
+echo "+-----------+"
+echo "| cockroach |"
+echo "+-----------+"
+./run_cockroach_tests.sh
+
+echo
+echo "+------------+"
+echo "| clickhouse |"
+echo "+------------+"
+./run_clickhouse_tests.sh
+
+echo
+echo "+--------+"
+echo "| oracle |"
+echo "+--------+"
+./run_oracle_tests.sh
+
+echo
+echo "+-----------+"
+echo "| cassandra |"
+echo "+-----------+"
+./run_cassandra_tests.sh
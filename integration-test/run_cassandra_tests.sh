@@ -0,0 +1,61 @@
+#!/bin/bash
+set -euo pipefail
+cd "$( dirname "$0" )"
+
+PORT=5420
+KEYSPACE=sql_migrate_test
+DSN="cassandra://localhost:${PORT}/${KEYSPACE}"
+
+CONTAINER=sql-migrate_test_cassandra
+CONTAINER_CREATED=0
+
+main() {
+	cleanup() {
+		if [ "${CONTAINER_CREATED}" -eq 1 ]; then
+			docker rm -f "${CONTAINER}" &> /dev/null || true
+		fi
+	}
+	trap cleanup EXIT
+
+	create_container
+	wait_for_service_ready scylla 120 1 docker exec "${CONTAINER}" cqlsh -e "SELECT now() FROM system.local"
+
+	docker exec "${CONTAINER}" cqlsh -e "CREATE KEYSPACE ${KEYSPACE} WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}"
+
+	export SQL_MIGRATE_BINARY=./cassandra-migrate
+	go build -o "${SQL_MIGRATE_BINARY}" -tags="custom cassandra" github.com/pasztorpisti/sql-migrate
+	CASSANDRA_DSN="${DSN}" go test -tags="custom cassandra integration" -v github.com/pasztorpisti/sql-migrate/...
+}
+
+create_container() {
+	echo "Creating scylla container ..."
+
+	docker rm -f "${CONTAINER}" &> /dev/null || true
+	docker run -d \
+		--name "${CONTAINER}" \
+		-p ${PORT}:9042 \
+			scylladb/scylla:5.2 --smp 1 --memory 750M --overprovisioned 1 > /dev/null
+
+	CONTAINER_CREATED=1
+}
+
+wait_for_service_ready() {
+	local NAME=$1
+	local ATTEMPTS=$2
+	local DELAY_SECS=$3
+	shift 3
+
+	echo -n "Waiting for ${NAME} to become ready ..."
+	for I in `seq 0 ${ATTEMPTS}`; do
+		if [ ${I} -eq ${ATTEMPTS} ]; then
+			>&2 echo " Error waiting for ${NAME} to become ready."
+			exit 1
+		fi
+		"$@" &> /dev/null && break
+		sleep ${DELAY_SECS}
+		echo -n "."
+	done
+	echo " OK"
+}
+
+main
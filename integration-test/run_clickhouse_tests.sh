@@ -0,0 +1,58 @@
+#!/bin/bash
+set -euo pipefail
+cd "$( dirname "$0" )"
+
+PORT=5410
+DSN="clickhouse://default@localhost:${PORT}/default"
+
+CONTAINER=sql-migrate_test_clickhouse
+CONTAINER_CREATED=0
+
+main() {
+	cleanup() {
+		if [ "${CONTAINER_CREATED}" -eq 1 ]; then
+			docker rm -f "${CONTAINER}" &> /dev/null || true
+		fi
+	}
+	trap cleanup EXIT
+
+	create_container
+	wait_for_service_ready clickhouse 60 1 docker exec -it "${CONTAINER}" clickhouse-client --query "SELECT 1"
+
+	export SQL_MIGRATE_BINARY=./clickhouse-migrate
+	go build -o "${SQL_MIGRATE_BINARY}" -tags="custom clickhouse" github.com/pasztorpisti/sql-migrate
+	CLICKHOUSE_DSN="${DSN}" go test -tags="custom clickhouse integration" -v github.com/pasztorpisti/sql-migrate/...
+}
+
+create_container() {
+	echo "Creating clickhouse container ..."
+
+	docker rm -f "${CONTAINER}" &> /dev/null || true
+	docker run -d \
+		--name "${CONTAINER}" \
+		-p ${PORT}:9000 \
+			clickhouse/clickhouse-server:23.8 > /dev/null
+
+	CONTAINER_CREATED=1
+}
+
+wait_for_service_ready() {
+	local NAME=$1
+	local ATTEMPTS=$2
+	local DELAY_SECS=$3
+	shift 3
+
+	echo -n "Waiting for ${NAME} to become ready ..."
+	for I in `seq 0 ${ATTEMPTS}`; do
+		if [ ${I} -eq ${ATTEMPTS} ]; then
+			>&2 echo " Error waiting for ${NAME} to become ready."
+			exit 1
+		fi
+		"$@" &> /dev/null && break
+		sleep ${DELAY_SECS}
+		echo -n "."
+	done
+	echo " OK"
+}
+
+main
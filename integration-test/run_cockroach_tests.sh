@@ -0,0 +1,58 @@
+#!/bin/bash
+set -euo pipefail
+cd "$( dirname "$0" )"
+
+PORT=5409
+DSN="postgres://root@localhost:${PORT}/defaultdb?sslmode=disable"
+
+CONTAINER=sql-migrate_test_cockroach
+CONTAINER_CREATED=0
+
+main() {
+	cleanup() {
+		if [ "${CONTAINER_CREATED}" -eq 1 ]; then
+			docker rm -f "${CONTAINER}" &> /dev/null || true
+		fi
+	}
+	trap cleanup EXIT
+
+	create_container
+	wait_for_service_ready cockroach 60 1 docker exec -it "${CONTAINER}" ./cockroach sql --insecure -e "SELECT 1"
+
+	export SQL_MIGRATE_BINARY=./cockroach-migrate
+	go build -o "${SQL_MIGRATE_BINARY}" -tags="custom cockroach" github.com/pasztorpisti/sql-migrate
+	COCKROACH_DSN="${DSN}" go test -tags="custom cockroach integration" -v github.com/pasztorpisti/sql-migrate/...
+}
+
+create_container() {
+	echo "Creating cockroach container ..."
+
+	docker rm -f "${CONTAINER}" &> /dev/null || true
+	docker run -d \
+		--name "${CONTAINER}" \
+		-p ${PORT}:26257 \
+			cockroachdb/cockroach:v23.1.11 start-single-node --insecure > /dev/null
+
+	CONTAINER_CREATED=1
+}
+
+wait_for_service_ready() {
+	local NAME=$1
+	local ATTEMPTS=$2
+	local DELAY_SECS=$3
+	shift 3
+
+	echo -n "Waiting for ${NAME} to become ready ..."
+	for I in `seq 0 ${ATTEMPTS}`; do
+		if [ ${I} -eq ${ATTEMPTS} ]; then
+			>&2 echo " Error waiting for ${NAME} to become ready."
+			exit 1
+		fi
+		"$@" &> /dev/null && break
+		sleep ${DELAY_SECS}
+		echo -n "."
+	done
+	echo " OK"
+}
+
+main
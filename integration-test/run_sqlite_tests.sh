@@ -0,0 +1,25 @@
+#!/bin/bash
+set -euo pipefail
+cd "$( dirname "$0" )"
+
+DB_DIR=""
+
+main() {
+	cleanup() {
+		if [ -n "${DB_DIR}" ]; then
+			rm -rf "${DB_DIR}"
+		fi
+	}
+	trap cleanup EXIT
+
+	# SQLite doesn't need a server so instead of a docker container
+	# we create the database file in a temporary directory.
+	DB_DIR="$( mktemp -d -t sql-migrate_test_sqlite.XXXXXX )"
+	local DSN="file:${DB_DIR}/test.db"
+
+	export SQL_MIGRATE_BINARY=./sqlite-migrate
+	CGO_ENABLED=0 go build -o "${SQL_MIGRATE_BINARY}" -tags="custom sqlite" github.com/pasztorpisti/sql-migrate
+	SQLITE_DSN="${DSN}" go test -tags="custom sqlite integration" -v github.com/pasztorpisti/sql-migrate/...
+}
+
+main
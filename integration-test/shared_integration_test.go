@@ -1,3 +1,4 @@
+//go:build integration
 // +build integration
 
 package integrationtest
@@ -641,9 +642,11 @@ type migrateParams struct {
 }
 
 // migrate: command has to be "goto" or "plan".
+// The driver warnings are disabled because they depend on the driver
+// and the output matchers are shared by all drivers.
 func migrate(command string, fp *fixedParams, p *migrateParams) {
 	runSQLMigrate(fp.t, !p.expectError, p.output, p.extraArgs, command,
-		"-driver", fp.sdb.DriverName(), "-dsn", fp.sdb.DSN(),
+		"-driver", fp.sdb.DriverName(), "-dsn", fp.sdb.DSN(), "-no_driver_warnings",
 		"-dir", fp.migrationsDir, "-target", p.target, "-migrations_table", migrationsTable)
 	requireForwardMigrations(fp, p.forwardMigrated)
 	requireEvents(fp, p.testEvents)
@@ -659,7 +662,7 @@ type statusParams struct {
 
 func status(fp *fixedParams, p *statusParams) {
 	runSQLMigrate(fp.t, !p.expectError, p.output, p.extraArgs, "status",
-		"-driver", fp.sdb.DriverName(), "-dsn", fp.sdb.DSN(),
+		"-driver", fp.sdb.DriverName(), "-dsn", fp.sdb.DSN(), "-no_driver_warnings",
 		"-dir", fp.migrationsDir, "-migrations_table", migrationsTable)
 	requireForwardMigrations(fp, p.forwardMigrated)
 	requireEvents(fp, p.testEvents)
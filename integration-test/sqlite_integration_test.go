@@ -0,0 +1,94 @@
+//go:build (!custom && integration) || (custom && sqlite && integration)
+// +build !custom,integration custom,sqlite,integration
+
+package integrationtest
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLite(t *testing.T) {
+	sdb := &sqliteSharedTestDB{
+		driver: "sqlite",
+		dsn:    mustGetEnv(t, "SQLITE_DSN"),
+	}
+
+	sharedTest(t, sdb)
+}
+
+// sqliteSharedTestDB implements the sharedTestDB interface.
+type sqliteSharedTestDB struct {
+	driver string
+	dsn    string
+}
+
+func (o *sqliteSharedTestDB) DriverName() string {
+	return o.driver
+}
+
+func (o *sqliteSharedTestDB) DSN() string {
+	return o.dsn
+}
+
+func (o *sqliteSharedTestDB) ConnectAndResetDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", o.dsn)
+	require.NoError(t, err)
+	defer func() {
+		if t.Failed() {
+			db.Close()
+		}
+	}()
+
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS ` + quoteSQLiteIdentifier(migrationsTable) + `;
+		CREATE TABLE IF NOT EXISTS test_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			event_name TEXT NOT NULL
+		);
+		DELETE FROM test_events;`,
+	)
+	require.NoError(t, err)
+	runSQLMigrate(t, true, nil, nil, "init", "-driver", "sqlite", "-dsn", o.dsn, "-migrations_table", migrationsTable)
+	return db
+}
+
+func (o *sqliteSharedTestDB) GetTestEvents(t *testing.T, db *sql.DB) []string {
+	var events []string
+	rows, err := db.Query(`SELECT event_name FROM test_events ORDER BY id`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var e string
+		err := rows.Scan(&e)
+		require.NoError(t, err, "error scanning test_event result set")
+		events = append(events, e)
+	}
+	require.NoError(t, rows.Err())
+	return events
+}
+
+func (o *sqliteSharedTestDB) GetForwardMigrated(t *testing.T, db *sql.DB) []string {
+	var migrationNames []string
+	rows, err := db.Query(`SELECT name FROM ` + quoteSQLiteIdentifier(migrationsTable) + ` ORDER BY name`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		require.NoError(t, err, "error scanning migration result set")
+		migrationNames = append(migrationNames, name)
+	}
+	require.NoError(t, rows.Err())
+	return migrationNames
+}
+
+func quoteSQLiteIdentifier(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
@@ -11,12 +11,85 @@ import (
 )
 
 type Driver interface {
-	ExecuteStep(st *Step, contents string) error
+	// ExecuteStep executes a migration step and updates the migrations table.
+	// The meta of forward steps is stored in the migrations table.
+	ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error
 	CreateMigrationsTable() error
+	// UpgradeMigrationsTable upgrades an existing migrations table to the
+	// latest schema version. It is a no-op if the table is up to date.
+	UpgradeMigrationsTable() error
 	GetForwardMigratedNames() (map[string]struct{}, error)
 	Close()
 }
 
+// DriverCapabilities describes the features of a driver that can't be taken
+// for granted.
+type DriverCapabilities struct {
+	// TransactionalDDL is true if the migration steps are executed in
+	// transactions unless they have the notx filename suffix.
+	TransactionalDDL bool
+	// MultiStatementExec is true if a migration step can contain multiple
+	// statements.
+	MultiStatementExec bool
+	// AdvisoryLocking is true if the migration lock is an advisory lock that
+	// is released automatically when its holder dies. It is false for the
+	// lock rows that have to be released with the force-unlock command and
+	// for the drivers that don't support locking.
+	AdvisoryLocking bool
+}
+
+// CapabilityReporter is an optional interface of drivers. Drivers that don't
+// implement it are assumed to support everything.
+type CapabilityReporter interface {
+	Capabilities() DriverCapabilities
+}
+
+// Locker is an optional interface of drivers. The goto command holds the
+// migration lock while it plans and executes the migration steps so the
+// concurrent goto commands of the same database don't race.
+type Locker interface {
+	// TryLock tries to acquire the migration lock without waiting for it.
+	// It returns false if the lock is held by someone else.
+	TryLock() (bool, error)
+	Unlock() error
+	// LockStatus returns the description of the holder of the migration
+	// lock or an empty string if the lock isn't held.
+	LockStatus() (string, error)
+	// ForceUnlock releases the migration lock regardless of its holder.
+	ForceUnlock() error
+}
+
+// ChecksumLoader is an optional interface of drivers that store the
+// checksums of the forward migrated migrations. It is used to detect
+// migration files that have been modified after their execution.
+type ChecksumLoader interface {
+	// GetChecksums returns the checksums of the forward migrated migrations
+	// keyed by migration name. The checksum is empty or missing if it hasn't
+	// been recorded (e.g.: the migration had been forward migrated before the
+	// migrations table was upgraded).
+	GetChecksums() (map[string]string, error)
+}
+
+// HistoryRecorder is an optional interface of drivers that record the
+// executed migration steps in an append-only history table.
+type HistoryRecorder interface {
+	// CreateHistoryTable creates the history table if it doesn't exist.
+	CreateHistoryTable() error
+	RecordHistory(h *HistoryEntry) error
+	// LoadHistory returns the entries of the history table in chronological
+	// order. It returns errNoHistoryTable if the history table doesn't exist.
+	LoadHistory() ([]*HistoryEntry, error)
+}
+
+// StateMarker is an optional interface of drivers. The mark-applied and
+// mark-unapplied commands and the -fake option of the goto command use it to
+// update the migrations table without executing the migration steps.
+type StateMarker interface {
+	// MarkStep updates the migrations table as if the step had been
+	// executed. The meta of forward steps is stored in the migrations table.
+	MarkStep(st *Step, meta *MigrationMetadata) error
+}
+
 // The DB and TX interfaces are used instead of *sql.DB and *sql.Tx
 // in order to be able to use mock DB and TX implementations during testing.
 type DB interface {
@@ -40,6 +113,22 @@ type Querier interface {
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 }
 
+// CQLSession is used instead of *gocql.Session in order to be able to use
+// a mock session during testing.
+type CQLSession interface {
+	Exec(stmt string, values ...interface{}) error
+	// ExecCAS executes a lightweight transaction (a statement with an IF
+	// clause) and returns whether it has been applied.
+	ExecCAS(stmt string, values ...interface{}) (applied bool, err error)
+	// QueryStrings returns the first column of the result rows.
+	QueryStrings(stmt string, values ...interface{}) ([]string, error)
+	// QueryStringRows returns the result rows of a query that selects
+	// text columns.
+	QueryStringRows(stmt string, values ...interface{}) ([][]string, error)
+	AwaitSchemaAgreement() error
+	Close()
+}
+
 type Printer interface {
 	Print(string)
 }
@@ -89,3 +178,10 @@ type osExiter struct{}
 func (osExiter) Exit(code int) {
 	os.Exit(code)
 }
+
+// exiterFunc implements the Exiter interface.
+type exiterFunc func(int)
+
+func (o exiterFunc) Exit(code int) {
+	o(code)
+}
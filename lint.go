@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type lintSeverity string
+
+const (
+	lintError   lintSeverity = "error"
+	lintWarning lintSeverity = "warning"
+)
+
+// Exit codes of the lint command. Invalid options exit with 1 or 2 and
+// runtime errors exit with 1 like in the other commands so the problems found
+// in the migration files have distinct exit codes.
+const (
+	lintExitOK       = 0
+	lintExitWarnings = 3
+	lintExitErrors   = 4
+)
+
+// lintProblem is a problem found by the lint command. The JSON output of the
+// lint command contains these fields.
+type lintProblem struct {
+	Severity lintSeverity `json:"severity"`
+	// Check is the name of the check that found the problem.
+	Check string `json:"check"`
+	// File is empty if the problem isn't related to a specific file.
+	File    string `json:"file,omitempty"`
+	Message string `json:"message"`
+}
+
+func (o *lintProblem) String() string {
+	if o.File == "" {
+		return fmt.Sprintf("%s: %s [%s]", o.Severity, o.Message, o.Check)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", o.Severity, o.File, o.Message, o.Check)
+}
+
+// lintMigrations checks the migration files of a directory. Unlike
+// loadMigrationsDir it doesn't stop at the first problem. The driver
+// specific checks are skipped if caps is nil.
+func lintMigrations(dir string, filenames []string, scheme IDScheme, fwd, bwd, notx, ext string,
+	requireBackward bool, driverName string, caps *DriverCapabilities, r FileReader) []*lintProblem {
+	var problems []*lintProblem
+	report := func(severity lintSeverity, check, file, format string, args ...interface{}) {
+		problems = append(problems, &lintProblem{
+			Severity: severity,
+			Check:    check,
+			File:     file,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	var keys []string
+	idMap := make(map[string]*Migration, len(filenames))
+	for _, name := range filenames {
+		parsed, err := scheme.parseFilename(name, fwd, bwd, notx, ext)
+		if err != nil {
+			report(lintError, "filename", name, "error parsing filename: %s", err)
+			continue
+		}
+
+		key := parsed.idKey()
+		m, ok := idMap[key]
+		if !ok {
+			m = &Migration{}
+			idMap[key] = m
+			keys = append(keys, key)
+		}
+		p := &m.Forward
+		if parsed.Direction == DirectionBackward {
+			p = &m.Backward
+		}
+		if *p != nil {
+			report(lintError, "duplicate-id", name, "duplicate %s migration for ID %v (%q)", parsed.Direction, key, (*p).Filename)
+			continue
+		}
+		*p = &Step{
+			Filename:       name,
+			ParsedFilename: parsed,
+		}
+	}
+
+	sorted := make([]*Migration, 0, len(keys))
+	for _, key := range keys {
+		m := idMap[key]
+		if m.Forward == nil {
+			report(lintError, "missing-forward", m.Backward.Filename, "migration without forward step")
+			continue
+		}
+		if m.Backward != nil && m.Forward.ParsedFilename.Description != m.Backward.ParsedFilename.Description {
+			report(lintError, "description-mismatch", m.Backward.Filename, "the description %q differs from the description %q of the forward step %q",
+				m.Backward.ParsedFilename.Description, m.Forward.ParsedFilename.Description, m.Forward.Filename)
+		}
+		sorted = append(sorted, m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return scheme.less(sorted[i].Forward.ParsedFilename, sorted[j].Forward.ParsedFilename)
+	})
+	for _, err := range scheme.idErrors(sorted) {
+		report(lintError, "id-sequence", "", "%s", err)
+	}
+
+	for _, m := range sorted {
+		if m.Backward == nil {
+			severity := lintWarning
+			if requireBackward {
+				severity = lintError
+			}
+			report(severity, "missing-backward", m.Forward.Filename, "migration without backward step")
+		}
+		for _, st := range []*Step{m.Forward, m.Backward} {
+			if st == nil {
+				continue
+			}
+			contents, err := r.ReadFile(filepath.Join(dir, st.Filename))
+			if err != nil {
+				report(lintError, "read", st.Filename, "%s", err)
+			} else if strings.TrimSpace(string(contents)) == "" {
+				report(lintError, "empty-file", st.Filename, "empty migration step")
+			}
+			if caps != nil && !caps.TransactionalDDL && st.ParsedFilename.NoTx {
+				report(lintWarning, "notx-ignored", st.Filename, "the %s driver doesn't support transactional DDL so the %q suffix is ignored", driverName, notx)
+			}
+		}
+	}
+	return problems
+}
+
+// lintExitCode returns the exit code that reflects the most severe problem.
+func lintExitCode(problems []*lintProblem) int {
+	code := lintExitOK
+	for _, p := range problems {
+		switch p.Severity {
+		case lintError:
+			return lintExitErrors
+		case lintWarning:
+			code = lintExitWarnings
+		}
+	}
+	return code
+}
+
+// lintSummary returns the last line of the text output of the lint command.
+func lintSummary(problems []*lintProblem) string {
+	if len(problems) == 0 {
+		return "No problems found."
+	}
+	var numErrors, numWarnings int
+	for _, p := range problems {
+		if p.Severity == lintError {
+			numErrors++
+		} else {
+			numWarnings++
+		}
+	}
+	return fmt.Sprintf("%d error(s), %d warning(s)", numErrors, numWarnings)
+}
@@ -0,0 +1,101 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintMigrations(t *testing.T) {
+	const dir = "my/dir"
+
+	newFileReader := func(ctrl *gomock.Controller, files map[string]string) *MockFileReader {
+		fileReader := NewMockFileReader(ctrl)
+		for name, contents := range files {
+			if contents == "unreadable" {
+				fileReader.EXPECT().ReadFile(filepath.Join(dir, name)).Return(nil, errors.New("test"))
+			} else {
+				fileReader.EXPECT().ReadFile(filepath.Join(dir, name)).Return([]byte(contents), nil)
+			}
+		}
+		return fileReader
+	}
+
+	t.Run("no problems", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		files := map[string]string{
+			"1_a.fw.sql": "a", "1_a.bw.sql": "a",
+			"2.fw.sql": "b", "2.bw.nt.sql": "b",
+		}
+		problems := lintMigrations(dir, []string{"1_a.bw.sql", "1_a.fw.sql", "2.bw.nt.sql", "2.fw.sql"}, IDSchemeSequential,
+			".fw", ".bw", ".nt", ".sql", true, "postgres", &DriverCapabilities{TransactionalDDL: true}, newFileReader(ctrl, files))
+		assert.Empty(t, problems)
+		assert.Equal(t, lintExitOK, lintExitCode(problems))
+		assert.Equal(t, "No problems found.", lintSummary(problems))
+		ctrl.Finish()
+	})
+
+	t.Run("problems", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		files := map[string]string{
+			"1_a.fw.sql":  "a",
+			"1_b.bw.sql":  " \n",
+			"2.fw.nt.sql": "b",
+			"5.fw.sql":    "unreadable",
+		}
+		filenames := []string{"1_a.fw.sql", "1_b.bw.sql", "01_x.fw.sql", "2.fw.nt.sql", "5.fw.sql", "7_no_fwd.bw.sql", "README.md"}
+
+		problems := lintMigrations(dir, filenames, IDSchemeSequential, ".fw", ".bw", ".nt", ".sql",
+			false, "mysql", &DriverCapabilities{TransactionalDDL: false}, newFileReader(ctrl, files))
+		assert.Equal(t, []*lintProblem{
+			{lintError, "duplicate-id", "01_x.fw.sql", `duplicate forward migration for ID 1 ("1_a.fw.sql")`},
+			{lintError, "filename", "README.md", `error parsing filename: missing numeric ID prefix`},
+			{lintError, "description-mismatch", "1_b.bw.sql", `the description "_b" differs from the description "_a" of the forward step "1_a.fw.sql"`},
+			{lintError, "missing-forward", "7_no_fwd.bw.sql", `migration without forward step`},
+			{lintError, "id-sequence", "", `missing migration ID (gap): 3`},
+			{lintError, "empty-file", "1_b.bw.sql", `empty migration step`},
+			{lintWarning, "missing-backward", "2.fw.nt.sql", `migration without backward step`},
+			{lintWarning, "notx-ignored", "2.fw.nt.sql", `the mysql driver doesn't support transactional DDL so the ".nt" suffix is ignored`},
+			{lintWarning, "missing-backward", "5.fw.sql", `migration without backward step`},
+			{lintError, "read", "5.fw.sql", `test`},
+		}, problems)
+		assert.Equal(t, lintExitErrors, lintExitCode(problems))
+		assert.Equal(t, "7 error(s), 3 warning(s)", lintSummary(problems))
+		assert.Equal(t, `error: 1_b.bw.sql: empty migration step [empty-file]`, problems[5].String())
+		assert.Equal(t, `error: missing migration ID (gap): 3 [id-sequence]`, problems[4].String())
+		ctrl.Finish()
+	})
+
+	t.Run("require backward", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		fileReader := newFileReader(ctrl, map[string]string{"1.fw.nt.sql": "a"})
+
+		problems := lintMigrations(dir, []string{"1.fw.nt.sql"}, IDSchemeSequential, ".fw", ".bw", ".nt", ".sql",
+			false, "", nil, fileReader)
+		assert.Equal(t, []*lintProblem{
+			{lintWarning, "missing-backward", "1.fw.nt.sql", `migration without backward step`},
+		}, problems)
+		assert.Equal(t, lintExitWarnings, lintExitCode(problems))
+
+		fileReader = newFileReader(ctrl, map[string]string{"1.fw.nt.sql": "a"})
+		problems = lintMigrations(dir, []string{"1.fw.nt.sql"}, IDSchemeSequential, ".fw", ".bw", ".nt", ".sql",
+			true, "", nil, fileReader)
+		assert.Equal(t, lintExitErrors, lintExitCode(problems))
+		ctrl.Finish()
+	})
+}
+
+func TestDriverCapabilities(t *testing.T) {
+	for name := range drivers {
+		capsFunc, ok := driverCapabilities[name]
+		if assert.True(t, ok, name) {
+			assert.Equal(t, name == "mysql" || name == "postgres", capsFunc().AdvisoryLocking, name)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// lockRetryInterval is the delay between two attempts to acquire
+// the migration lock while it is held by someone else.
+const lockRetryInterval = time.Second
+
+// lockMigrations acquires the migration lock of the driver for the goto
+// command and returns a function that releases it. The returned function
+// can be called more than once. The warning about the missing lock can't be
+// disabled with the -no_driver_warnings option because the command runs
+// unprotected.
+func lockMigrations(driverName string, d Driver, timeout time.Duration) (unlock func(), err error) {
+	l, ok := d.(Locker)
+	if !ok {
+		log.Printf("Warning: the %s driver doesn't support locking. "+
+			"Concurrent commands may execute the same migration steps.", driverName)
+		return func() {}, nil
+	}
+	if err := acquireLock(l, timeout, time.Now, time.Sleep, stderrPrinter{}); err != nil {
+		return nil, err
+	}
+	return onceFunc(func() {
+		if err := l.Unlock(); err != nil {
+			log.Printf("Error releasing the migration lock: %s", err)
+		}
+	}), nil
+}
+
+// driverLocker returns the Locker of the driver. It exits with an error
+// if the driver doesn't support locking.
+func driverLocker(driverName string, d Driver) Locker {
+	l, ok := d.(Locker)
+	if !ok {
+		log.Printf("The %s driver doesn't support locking.", driverName)
+		os.Exit(1)
+	}
+	return l
+}
+
+// acquireLock tries to acquire the migration lock until it succeeds or the
+// timeout expires. It prints a message when it has to wait for the lock.
+func acquireLock(l Locker, timeout time.Duration, now func() time.Time, sleep func(time.Duration), p Printer) error {
+	deadline := now().Add(timeout)
+	waiting := false
+	for {
+		ok, err := l.TryLock()
+		if err != nil {
+			return fmt.Errorf("error acquiring the migration lock: %s", err)
+		}
+		if ok {
+			return nil
+		}
+
+		if !now().Before(deadline) {
+			return fmt.Errorf("timeout waiting for the migration lock held by %s "+
+				"(a stale lock can be examined with the lock-status command and released with the force-unlock command)",
+				lockHolder(l))
+		}
+		if !waiting {
+			waiting = true
+			p.Print(fmt.Sprintf("Waiting for the migration lock held by %s ...\n", lockHolder(l)))
+		}
+		sleep(lockRetryInterval)
+	}
+}
+
+// lockHolder returns the description of the holder of the migration lock
+// for error messages.
+func lockHolder(l Locker) string {
+	holder, err := l.LockStatus()
+	switch {
+	case err != nil:
+		return fmt.Sprintf("an unknown holder (error: %s)", err)
+	case holder == "":
+		return "an unknown holder"
+	default:
+		return holder
+	}
+}
+
+// onceFunc returns a function that calls f only the first time it is called.
+func onceFunc(f func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(f)
+	}
+}
+
+// lockKey returns a non-negative 64-bit key for the advisory lock functions
+// of the databases that identify locks with integers.
+func lockKey(s string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("sql-migrate:" + s))
+	return int64(h.Sum64() >> 1)
+}
+
+// lockOwner identifies this process in the lock table.
+func lockOwner(now time.Time) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown-host"
+	}
+	return fmt.Sprintf("%s (pid %d) since %s", hostname, os.Getpid(), now.UTC().Format(time.RFC3339))
+}
+
+// queryRow executes a query that returns at most one row and scans the row
+// into dest. It returns false if the result set is empty.
+// It is a replacement of the QueryRow method that isn't part of the Querier
+// interface.
+func queryRow(q Querier, dest []interface{}, query string, args ...interface{}) (bool, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return false, err
+	}
+	return true, rows.Close()
+}
+
+// tableLocker implements the Locker interface with a lock table that has at
+// most one row. It is used by the drivers of databases that don't have
+// advisory locks. Unlike advisory locks the lock row isn't released when the
+// process dies so a stale lock has to be released with force-unlock.
+type tableLocker struct {
+	db DB
+	// tableName is the quoted name of the lock table.
+	tableName string
+	// migrationsTable is the quoted name of the migrations table. It is
+	// probed to detect the missing lock table.
+	migrationsTable string
+	// createTable is the statement that creates the lock table if it doesn't
+	// exist. The table has an integer "id" primary key column and an "owner"
+	// string column.
+	createTable string
+	placeholder func(n int) string
+	quote       func(string) string
+	now         func() time.Time
+
+	tableCreated bool
+	owner        string
+}
+
+func newTableLocker(db DB, tableName, migrationsTable, createTable string, placeholder func(n int) string, quote func(string) string) *tableLocker {
+	return &tableLocker{
+		db:              db,
+		tableName:       tableName,
+		migrationsTable: migrationsTable,
+		createTable:     createTable,
+		placeholder:     placeholder,
+		quote:           quote,
+		now:             time.Now,
+	}
+}
+
+// createTableIfNeeded creates the lock table on demand
+// so the init command doesn't have to create it. Only TryLock creates it:
+// the lock isn't held if the lock table doesn't exist.
+func (o *tableLocker) createTableIfNeeded() error {
+	if o.tableCreated {
+		return nil
+	}
+	if _, err := o.db.Exec(o.createTable); err != nil {
+		return fmt.Errorf("error creating lock table: %s", err)
+	}
+	o.tableCreated = true
+	return nil
+}
+
+func (o *tableLocker) TryLock() (bool, error) {
+	if err := o.createTableIfNeeded(); err != nil {
+		return false, err
+	}
+
+	owner := lockOwner(o.now())
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES (1, %s)",
+		o.tableName, o.quote("id"), o.quote("owner"), o.placeholder(1))
+	_, insertErr := o.db.Exec(query, owner)
+	if insertErr == nil {
+		o.owner = owner
+		return true, nil
+	}
+
+	// The INSERT fails with a primary key violation if the lock is held by
+	// someone else. The error codes of primary key violations are database
+	// specific so we check the existence of the lock row instead.
+	holder, err := o.LockStatus()
+	if err != nil {
+		return false, err
+	}
+	if holder == "" {
+		return false, insertErr
+	}
+	return false, nil
+}
+
+func (o *tableLocker) Unlock() error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s=1 AND %s=%s",
+		o.tableName, o.quote("id"), o.quote("owner"), o.placeholder(1))
+	res, err := o.db.Exec(query, o.owner)
+	if err != nil {
+		return err
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if ra != 1 {
+		return fmt.Errorf("the migration lock of %s has been released by someone else", o.owner)
+	}
+	return nil
+}
+
+func (o *tableLocker) LockStatus() (string, error) {
+	var owner string
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s=1", o.quote("owner"), o.tableName, o.quote("id"))
+	if _, err := queryRow(o.db, []interface{}{&owner}, query); err != nil {
+		if !o.tableCreated && probeTable(o.db, o.migrationsTable) == nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return owner, nil
+}
+
+func (o *tableLocker) ForceUnlock() error {
+	_, err := o.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s=1", o.tableName, o.quote("id")))
+	return err
+}
@@ -0,0 +1,191 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLock(t *testing.T) {
+	const timeout = 3 * time.Second
+
+	// newClock returns a fake clock that is advanced only by sleep.
+	newClock := func() (now func() time.Time, sleep func(time.Duration)) {
+		current := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		now = func() time.Time {
+			return current
+		}
+		sleep = func(d time.Duration) {
+			current = current.Add(d)
+		}
+		return
+	}
+
+	t.Run("not held", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		locker := NewMockLocker(ctrl)
+		printer := NewMockPrinter(ctrl)
+		now, sleep := newClock()
+
+		locker.EXPECT().TryLock().Return(true, nil)
+
+		err := acquireLock(locker, timeout, now, sleep, printer)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("released while waiting", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		locker := NewMockLocker(ctrl)
+		printer := NewMockPrinter(ctrl)
+		now, sleep := newClock()
+
+		gomock.InOrder(
+			locker.EXPECT().TryLock().Return(false, nil),
+			locker.EXPECT().LockStatus().Return("host (pid 1)", nil),
+			printer.EXPECT().Print("Waiting for the migration lock held by host (pid 1) ...\n"),
+			locker.EXPECT().TryLock().Return(false, nil),
+			locker.EXPECT().TryLock().Return(true, nil),
+		)
+
+		err := acquireLock(locker, timeout, now, sleep, printer)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		locker := NewMockLocker(ctrl)
+		printer := NewMockPrinter(ctrl)
+		now, sleep := newClock()
+
+		locker.EXPECT().TryLock().Return(false, nil).Times(4)
+		locker.EXPECT().LockStatus().Return("", assert.AnError)
+		locker.EXPECT().LockStatus().Return("host (pid 1)", nil)
+		printer.EXPECT().Print(gomock.Any())
+
+		err := acquireLock(locker, timeout, now, sleep, printer)
+		assert.EqualError(t, err, "timeout waiting for the migration lock held by host (pid 1) "+
+			"(a stale lock can be examined with the lock-status command and released with the force-unlock command)")
+		ctrl.Finish()
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		locker := NewMockLocker(ctrl)
+		printer := NewMockPrinter(ctrl)
+		now, sleep := newClock()
+
+		locker.EXPECT().TryLock().Return(false, errors.New("test"))
+
+		err := acquireLock(locker, timeout, now, sleep, printer)
+		assert.EqualError(t, err, "error acquiring the migration lock: test")
+		ctrl.Finish()
+	})
+}
+
+func TestTableLocker(t *testing.T) {
+	const createTable = `CREATE TABLE "lock"`
+	lockTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	owner := lockOwner(lockTime)
+
+	newLocker := func(ctrl *gomock.Controller) (*tableLocker, *MockDB) {
+		db := NewMockDB(ctrl)
+		l := newTableLocker(db, `"lock"`, `"migrations"`, createTable,
+			func(n int) string { return "?" },
+			func(s string) string { return `"` + s + `"` },
+		)
+		l.now = func() time.Time { return lockTime }
+		return l, db
+	}
+
+	t.Run("lock and unlock", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		l, db := newLocker(ctrl)
+		res := NewMockResult(ctrl)
+
+		gomock.InOrder(
+			db.EXPECT().Exec(createTable),
+			db.EXPECT().Exec(`INSERT INTO "lock" ("id", "owner") VALUES (1, ?)`, owner),
+			db.EXPECT().Exec(`DELETE FROM "lock" WHERE "id"=1 AND "owner"=?`, owner).Return(res, nil),
+			res.EXPECT().RowsAffected().Return(int64(1), nil),
+		)
+
+		ok, err := l.TryLock()
+		require.NoError(t, err)
+		assert.True(t, ok)
+		err = l.Unlock()
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("create table error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		l, db := newLocker(ctrl)
+
+		db.EXPECT().Exec(createTable).Return(nil, errors.New("test"))
+
+		_, err := l.TryLock()
+		assert.EqualError(t, err, "error creating lock table: test")
+		ctrl.Finish()
+	})
+
+	t.Run("released by someone else", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		l, db := newLocker(ctrl)
+		l.owner = owner
+		res := NewMockResult(ctrl)
+
+		gomock.InOrder(
+			db.EXPECT().Exec(gomock.Any(), owner).Return(res, nil),
+			res.EXPECT().RowsAffected().Return(int64(0), nil),
+		)
+
+		err := l.Unlock()
+		assert.EqualError(t, err, "the migration lock of "+owner+" has been released by someone else")
+		ctrl.Finish()
+	})
+
+	t.Run("ForceUnlock", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		l, db := newLocker(ctrl)
+
+		db.EXPECT().Exec(`DELETE FROM "lock" WHERE "id"=1`)
+
+		err := l.ForceUnlock()
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("query errors", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		l, db := newLocker(ctrl)
+
+		gomock.InOrder(
+			db.EXPECT().Query(`SELECT "owner" FROM "lock" WHERE "id"=1`).Return(nil, errors.New("test")),
+			db.EXPECT().Query(`SELECT 1 FROM "migrations" WHERE 1=0`).Return(nil, errors.New("closed")),
+			db.EXPECT().Exec(`DELETE FROM "lock" WHERE "id"=1`).Return(nil, errors.New("test")),
+		)
+
+		// The lock table isn't created. The LockStatus error is returned
+		// because the migrations table can't be queried either.
+		_, err := l.LockStatus()
+		assert.EqualError(t, err, "test")
+		err = l.ForceUnlock()
+		assert.EqualError(t, err, "test")
+		ctrl.Finish()
+	})
+}
+
+func TestLockKey(t *testing.T) {
+	assert.Equal(t, lockKey("a"), lockKey("a"))
+	assert.NotEqual(t, lockKey("a"), lockKey("b"))
+	assert.True(t, lockKey("a") >= 0)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -16,26 +17,50 @@ import (
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 const usage = `Usage: sql-migrate <command> [command_options...]
 
 Commands:
-  init      Create the migrations table in the DB if not exists
-  status    Show info about the current state of the migrations
-  plan      Show the plan that would be executed by a goto command
-  goto      Migrate to a specific version of the DB schema
-  version   Show version info
+  init            Create the migrations table in the DB if not exists
+  status          Show info about the current state of the migrations
+  plan            Show the plan that would be executed by a goto command
+  goto            Migrate to a specific version of the DB schema
+  redo            Revert and forward migrate the last applied migrations
+  baseline        Mark the existing migrations of a legacy DB applied
+  mark-applied    Mark a migration forward migrated without executing it
+  mark-unapplied  Mark a migration unapplied without executing it
+  verify          Detect forward migrated migrations modified since their execution
+  history         Show the log of the executed migration steps
+  create          Create the files of a new migration
+  renumber        Resolve duplicate and gapped IDs of unapplied migrations
+  lint            Check the migration files without connecting to the DB
+  lock-status     Show the holder of the migration lock of the goto command
+  force-unlock    Release a stale migration lock
+  version         Show version info
 
 Run 'sql-migrate <command> -help' for more info.
 `
 
 var commands = map[string]func(args []string){
-	"init":    cmdInit,
-	"status":  cmdStatus,
-	"plan":    cmdPlan,
-	"goto":    cmdGoto,
-	"version": cmdVersion,
+	"init":     cmdInit,
+	"status":   cmdStatus,
+	"plan":     cmdPlan,
+	"goto":     cmdGoto,
+	"verify":   cmdVerify,
+	"history":  cmdHistory,
+	"create":   cmdCreate,
+	"renumber": cmdRenumber,
+	"lint":     cmdLint,
+	"version":  cmdVersion,
+
+	"lock-status":    cmdLockStatus,
+	"force-unlock":   cmdForceUnlock,
+	"redo":           cmdRedo,
+	"baseline":       cmdBaseline,
+	"mark-applied":   cmdMarkApplied,
+	"mark-unapplied": cmdMarkUnapplied,
 }
 
 func main() {
@@ -64,7 +89,8 @@ func main() {
 
 const initUsage = `Usage: sql-migrate init <options...>
 
-Creates the migration table if it hasn't yet been created.
+Creates the migration table if it hasn't yet been created and upgrades
+it to the latest version if it has been created by an older sql-migrate.
 Issuing an init command on an already initialised DB is a harmless no-op.
 
 Options:
@@ -73,7 +99,7 @@ Options:
 func cmdInit(args []string) {
 	fs := newFlagSet("init", initUsage)
 	driverName, dsn, table := addDriverFlags(fs)
-	fs.Parse(args)
+	parseFlags(fs, args)
 	expectNoArgs(fs)
 	driver := processDriverFlags(fs, driverName, dsn, table)
 	defer driver.Close()
@@ -81,6 +107,16 @@ func cmdInit(args []string) {
 		log.Print(err)
 		os.Exit(1)
 	}
+	if err := driver.UpgradeMigrationsTable(); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	if hr, ok := driver.(HistoryRecorder); ok {
+		if err := hr.CreateHistoryTable(); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+	}
 	fmt.Println("Init success.")
 }
 
@@ -94,135 +130,909 @@ Options:
 func cmdStatus(args []string) {
 	fs := newFlagSet("status", statusUsage)
 	driverName, dsn, table := addDriverFlags(fs)
-	dir, fwd, bwd, notx, ext := addDirFlags(fs)
-	fs.Parse(args)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	noDriverWarnings := addNoDriverWarningsFlag(fs)
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
+	driver := processDriverFlags(fs, driverName, dsn, table)
+	defer driver.Close()
+
+	forwardMigrated, err := driver.GetForwardMigratedNames()
+	if err != nil {
+		log.Printf("Error loading migration status from the migrations table: %s", err)
+		os.Exit(1)
+	}
+
+	// Like plan and goto, warn only about the steps that haven't been
+	// executed yet.
+	if !*noDriverWarnings {
+		var pending []*Step
+		for _, m := range migrations.Sorted {
+			if _, applied := forwardMigrated[m.Forward.MigrationName]; !applied {
+				pending = append(pending, m.Forward)
+			}
+		}
+		printDriverWarnings(*driverName, driver, pending, *dir)
+	}
+
+	checkbox := func(checked bool) string {
+		if checked {
+			return "[X]"
+		}
+		return "[ ]"
+	}
+	for _, m := range migrations.Sorted {
+		_, applied := forwardMigrated[m.Forward.MigrationName]
+		s := checkbox(applied) + " " + m.Forward.Filename
+		if m.Forward.ParsedFilename.NoTx {
+			s += " [no-forward-transaction]"
+		}
+		if m.Backward == nil {
+			s += " [no-backward-migration]"
+		} else if m.Backward.ParsedFilename.NoTx {
+			s += " [no-backward-transaction]"
+		}
+		fmt.Println(s)
+	}
+
+	allSet := make(map[string]struct{}, len(migrations.Sorted))
+	for _, m := range migrations.Sorted {
+		allSet[m.Forward.MigrationName] = struct{}{}
+	}
+	var invalidForwardMigrated []string
+	for name := range forwardMigrated {
+		if _, ok := allSet[name]; !ok {
+			invalidForwardMigrated = append(invalidForwardMigrated, name)
+		}
+	}
+	sort.Strings(invalidForwardMigrated)
+	for _, migrationName := range invalidForwardMigrated {
+		fmt.Println(" !  Entry in the migration table without migration files: " + migrationName)
+	}
+
+	if len(migrations.Sorted) == 0 && len(invalidForwardMigrated) == 0 {
+		fmt.Println("There are no migrations.")
+	}
+}
+
+const planUsage = `Usage: sql-migrate plan <options...>
+
+Show a plan without modifying the database.
+
+This command has the same options as the goto command.
+The plan lists the steps that would be performed
+by a goto with the same commandline parameters.
+Like goto it fails if a forward migrated migration has been modified
+since its execution.
+
+Options:
+`
+
+func cmdPlan(args []string) {
+	fs := newFlagSet("plan", planUsage)
+	driverName, dsn, table := addDriverFlags(fs)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	target := addTargetFlag(fs)
+	noDriverWarnings := addNoDriverWarningsFlag(fs)
+	allowModified := addAllowModifiedFlag(fs)
+	allowOutOfOrder := addAllowOutOfOrderFlag(fs)
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	processTargetFlag(target)
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
+	driver := processDriverFlags(fs, driverName, dsn, table)
+	defer driver.Close()
+
+	steps, forwardMigrated, err := loadStateAndCreatePlan(*target, migrations, driver, *allowOutOfOrder)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	err = checkModifiedMigrations(*driverName, driver, migrations, *dir, ioutilFileReader{}, *allowModified, *noDriverWarnings)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	if !*noDriverWarnings {
+		printDriverWarnings(*driverName, driver, steps, *dir)
+	}
+	outOfOrder := outOfOrderSteps(steps, migrations, forwardMigrated)
+	for _, st := range steps {
+		if outOfOrder[st] {
+			fmt.Println(st.String() + " [out-of-order]")
+		} else {
+			fmt.Println(st)
+		}
+	}
+	if len(steps) == 0 {
+		fmt.Println("Nothing to migrate.")
+	}
+}
+
+const gotoUsage = `Usage: sql-migrate goto <options...>
+
+Go to the specified version of the database schema by going to the
+migration specified by the -target parameter.
+
+- Migrations that are newer the target and have been forward migrated
+  are reverted by executing their backward steps in descending order.
+- The target migration along with the older migrations are forward
+  migrated in ascending order by executing the forward steps of those
+  that haven't yet been forward migrated.
+
+The goto command holds the migration lock while it plans and executes
+the migration steps. Concurrent goto commands wait for the lock.
+
+The migrations table is upgraded to the latest version before executing
+the migration steps. The checksum and the duration of the executed forward
+steps are stored in the migrations table along with the sql-migrate version,
+the OS user, the hostname and the value of the -applied_by option.
+
+The goto command fails without executing any steps if the forward step
+of a forward migrated migration has been modified since its execution.
+The -allow_modified option turns this error into a warning.
+
+The goto command fails if an unapplied migration precedes an applied one
+(e.g.: a hotfix branch has added a migration with a lower ID). The
+-allow_out_of_order option forward migrates these migrations without
+reverting the later applied ones. The plan command marks their steps with
+[out-of-order].
+
+The -fake option updates the migrations table as if the steps of the plan
+had been executed without executing them. It shows the plan and asks for
+confirmation unless the -yes option is specified.
+
+Options:
+`
+
+func cmdGoto(args []string) {
+	fs := newFlagSet("goto", gotoUsage)
+	driverName, dsn, table := addDriverFlags(fs)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	target := addTargetFlag(fs)
+	noDriverWarnings := addNoDriverWarningsFlag(fs)
+	allowModified := addAllowModifiedFlag(fs)
+	allowOutOfOrder := addAllowOutOfOrderFlag(fs)
+	lockTimeout := fs.Duration("lock_timeout", time.Minute, "The maximum time to wait for the migration lock held by another goto command.")
+	appliedBy := addAppliedByFlag(fs)
+	fake := fs.Bool("fake", false, "Update the migrations table without executing the migration steps.")
+	yes := addYesFlag(fs)
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	processTargetFlag(target)
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
+	driver := processDriverFlags(fs, driverName, dsn, table)
+	defer driver.Close()
+	if *fake {
+		driverStateMarker(*driverName, driver)
+	}
+
+	unlock, err := lockMigrations(*driverName, driver, *lockTimeout)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	defer unlock()
+	// os.Exit doesn't execute the deferred calls.
+	exit := func(code int) {
+		unlock()
+		os.Exit(code)
+	}
+
+	steps, _, err := loadStateAndCreatePlan(*target, migrations, driver, *allowOutOfOrder)
+	if err != nil {
+		log.Print(err)
+		exit(1)
+	}
+	err = checkModifiedMigrations(*driverName, driver, migrations, *dir, ioutilFileReader{}, *allowModified, *noDriverWarnings)
+	if err != nil {
+		log.Print(err)
+		exit(1)
+	}
+	if !*noDriverWarnings && !*fake {
+		printDriverWarnings(*driverName, driver, steps, *dir)
+	}
+	if *fake && len(steps) != 0 && !*yes && !confirmSteps(steps, os.Stdin, stdoutPrinter{}) {
+		fmt.Println("Aborted.")
+		exit(1)
+	}
+	if len(steps) != 0 {
+		if err := driver.UpgradeMigrationsTable(); err != nil {
+			log.Print(err)
+			exit(1)
+		}
+		if hr, ok := driver.(HistoryRecorder); ok {
+			if err := hr.CreateHistoryTable(); err != nil {
+				log.Print(err)
+				exit(1)
+			}
+		}
+	}
+
+	id, idCancel := newInterruptDetector(exiterFunc(exit), stderrPrinter{})
+	defer idCancel()
+
+	meta := newMigrationMetadata(*appliedBy)
+	for _, st := range steps {
+		execute := st.ExecuteAndLog
+		if *fake {
+			execute = st.MarkAndLog
+		}
+		if err := execute(*dir, driver, ioutilFileReader{}, stdoutPrinter{}, meta); err != nil {
+			log.Print(err)
+			exit(1)
+		}
+		id.ExitIfInterrupted()
+	}
+	if len(steps) == 0 {
+		fmt.Println("Nothing to migrate.")
+	}
+}
+
+const redoUsage = `Usage: sql-migrate redo <options...>
+
+Revert the last -n forward migrated migrations by executing their backward
+steps in descending order and forward migrate them again in ascending order.
+The plan of the steps is shown before executing them.
+
+The redone migrations may have been modified since their execution. The
+other forward migrated migrations are checked the same way as the goto
+command checks them. The command holds the migration lock of the goto
+command.
+
+Options:
+`
+
+func cmdRedo(args []string) {
+	fs := newFlagSet("redo", redoUsage)
+	driverName, dsn, table := addDriverFlags(fs)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	n := fs.Int("n", 1, "The number of migrations to redo.")
+	noDriverWarnings := addNoDriverWarningsFlag(fs)
+	allowModified := addAllowModifiedFlag(fs)
+	lockTimeout := fs.Duration("lock_timeout", time.Minute, "The maximum time to wait for the migration lock held by a goto command.")
+	appliedBy := addAppliedByFlag(fs)
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	if *n < 1 {
+		log.Print("The -n option must be at least 1.")
+		os.Exit(1)
+	}
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
+	driver := processDriverFlags(fs, driverName, dsn, table)
+	defer driver.Close()
+
+	unlock, err := lockMigrations(*driverName, driver, *lockTimeout)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	defer unlock()
+	exit := func(code int) {
+		unlock()
+		os.Exit(code)
+	}
+
+	forwardMigrated, err := driver.GetForwardMigratedNames()
+	if err != nil {
+		log.Printf("Error loading migration status from the migrations table: %s", err)
+		exit(1)
+	}
+	steps, err := redoPlan(*n, migrations, forwardMigrated)
+	if err != nil {
+		log.Print(err)
+		exit(1)
+	}
+	err = checkModifiedMigrations(*driverName, driver, withoutRedoneMigrations(migrations, steps), *dir, ioutilFileReader{}, *allowModified, *noDriverWarnings)
+	if err != nil {
+		log.Print(err)
+		exit(1)
+	}
+	if !*noDriverWarnings {
+		printDriverWarnings(*driverName, driver, steps, *dir)
+	}
+	for _, st := range steps {
+		fmt.Println(st)
+	}
+	fmt.Println()
+
+	if err := driver.UpgradeMigrationsTable(); err != nil {
+		log.Print(err)
+		exit(1)
+	}
+	if hr, ok := driver.(HistoryRecorder); ok {
+		if err := hr.CreateHistoryTable(); err != nil {
+			log.Print(err)
+			exit(1)
+		}
+	}
+
+	id, idCancel := newInterruptDetector(exiterFunc(exit), stderrPrinter{})
+	defer idCancel()
+
+	meta := newMigrationMetadata(*appliedBy)
+	for _, st := range steps {
+		if err := st.ExecuteAndLog(*dir, driver, ioutilFileReader{}, stdoutPrinter{}, meta); err != nil {
+			log.Print(err)
+			exit(1)
+		}
+		id.ExitIfInterrupted()
+	}
+}
+
+const baselineUsage = `Usage: sql-migrate baseline <options...>
+
+Adopt sql-migrate on an existing database whose schema already matches the
+target migration. The command creates the migrations table and marks the
+target migration along with the older migrations forward migrated without
+executing them. The checksums of their forward steps are stored in the
+migrations table.
+
+The command fails if the migrations table already has entries. The -force
+option marks the unapplied migrations up to the target anyway.
+
+Options:
+`
+
+func cmdBaseline(args []string) {
+	fs := newFlagSet("baseline", baselineUsage)
+	driverName, dsn, table := addDriverFlags(fs)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	target := addTargetFlag(fs)
+	lockTimeout := fs.Duration("lock_timeout", time.Minute, "The maximum time to wait for the migration lock held by a goto command.")
+	appliedBy := addAppliedByFlag(fs)
+	force := fs.Bool("force", false, "Mark the unapplied migrations even if the migrations table already has entries.")
+	parseFlags(fs, args)
 
 	expectNoArgs(fs)
-	migrations := processDirFlag(dir, fwd, bwd, notx, ext)
+	processTargetFlag(target)
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
 	driver := processDriverFlags(fs, driverName, dsn, table)
 	defer driver.Close()
+	driverStateMarker(*driverName, driver)
+
+	if err := driver.CreateMigrationsTable(); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	if err := driver.UpgradeMigrationsTable(); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	if hr, ok := driver.(HistoryRecorder); ok {
+		if err := hr.CreateHistoryTable(); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+	}
+
+	unlock, err := lockMigrations(*driverName, driver, *lockTimeout)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	defer unlock()
+	exit := func(code int) {
+		unlock()
+		os.Exit(code)
+	}
 
 	forwardMigrated, err := driver.GetForwardMigratedNames()
 	if err != nil {
 		log.Printf("Error loading migration status from the migrations table: %s", err)
+		exit(1)
+	}
+	steps, err := baselineSteps(*target, migrations, forwardMigrated, *force)
+	if err != nil {
+		log.Print(err)
+		exit(1)
+	}
+
+	id, idCancel := newInterruptDetector(exiterFunc(exit), stderrPrinter{})
+	defer idCancel()
+
+	meta := newMigrationMetadata(*appliedBy)
+	for _, st := range steps {
+		if err := st.MarkAndLog(*dir, driver, ioutilFileReader{}, stdoutPrinter{}, meta); err != nil {
+			log.Print(err)
+			exit(1)
+		}
+		id.ExitIfInterrupted()
+	}
+	if len(steps) == 0 {
+		fmt.Println("Nothing to mark.")
+	}
+}
+
+const markAppliedUsage = `Usage: sql-migrate mark-applied <options...> <target>
+
+Mark the target migration forward migrated without executing its forward
+step. The checksum of the forward step is stored in the migrations table.
+The target is the ID or name of a migration file.
+
+The command shows the step and asks for confirmation unless the -yes option
+is specified. It holds the migration lock of the goto command.
+
+Options:
+`
+
+func cmdMarkApplied(args []string) {
+	markCommand("mark-applied", markAppliedUsage, DirectionForward, args)
+}
+
+const markUnappliedUsage = `Usage: sql-migrate mark-unapplied <options...> <target>
+
+Mark the target migration unapplied without executing its backward step.
+The target is the ID or name of a migration file or the name of a migrations
+table entry without migration files. The migration doesn't need a backward
+step.
+
+The command shows the step and asks for confirmation unless the -yes option
+is specified. It holds the migration lock of the goto command.
+
+Options:
+`
+
+func cmdMarkUnapplied(args []string) {
+	markCommand("mark-unapplied", markUnappliedUsage, DirectionBackward, args)
+}
+
+func markCommand(name, usage string, direction Direction, args []string) {
+	fs := newFlagSet(name, usage)
+	driverName, dsn, table := addDriverFlags(fs)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	lockTimeout := fs.Duration("lock_timeout", time.Minute, "The maximum time to wait for the migration lock held by a goto command.")
+	appliedBy := addAppliedByFlag(fs)
+	yes := addYesFlag(fs)
+	parseFlags(fs, args)
+
+	if fs.NArg() != 1 {
+		log.Print("Expected exactly one target argument.")
+		fs.Usage()
+		os.Exit(1)
+	}
+	target := fs.Arg(0)
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
+	driver := processDriverFlags(fs, driverName, dsn, table)
+	defer driver.Close()
+	driverStateMarker(*driverName, driver)
+
+	unlock, err := lockMigrations(*driverName, driver, *lockTimeout)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	defer unlock()
+	exit := func(code int) {
+		unlock()
+		os.Exit(code)
+	}
+
+	forwardMigrated, err := driver.GetForwardMigratedNames()
+	if err != nil {
+		log.Printf("Error loading migration status from the migrations table: %s", err)
+		exit(1)
+	}
+	st, err := markTargetStep(target, migrations, forwardMigrated, direction)
+	if err != nil {
+		log.Print(err)
+		exit(1)
+	}
+	if !*yes && !confirmSteps([]*Step{st}, os.Stdin, stdoutPrinter{}) {
+		fmt.Println("Aborted.")
+		exit(1)
+	}
+	if err := driver.UpgradeMigrationsTable(); err != nil {
+		log.Print(err)
+		exit(1)
+	}
+	if hr, ok := driver.(HistoryRecorder); ok {
+		if err := hr.CreateHistoryTable(); err != nil {
+			log.Print(err)
+			exit(1)
+		}
+	}
+	if err := st.MarkAndLog(*dir, driver, ioutilFileReader{}, stdoutPrinter{}, newMigrationMetadata(*appliedBy)); err != nil {
+		log.Print(err)
+		exit(1)
+	}
+}
+
+const verifyUsage = `Usage: sql-migrate verify <options...>
+
+Compare the checksums stored in the migrations table with the current
+contents of the forward migrated migration files.
+
+The command fails if a forward migrated migration has been modified since
+its execution. Migrations forward migrated before the migrations table had
+checksum support can't be verified.
+
+Options:
+`
+
+func cmdVerify(args []string) {
+	fs := newFlagSet("verify", verifyUsage)
+	driverName, dsn, table := addDriverFlags(fs)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	allowModified := addAllowModifiedFlag(fs)
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
+	driver := processDriverFlags(fs, driverName, dsn, table)
+	defer driver.Close()
+
+	forwardMigrated, err := driver.GetForwardMigratedNames()
+	if err != nil {
+		log.Printf("Error loading migration status from the migrations table: %s", err)
+		os.Exit(1)
+	}
+	checksums, err := driverChecksumLoader(*driverName, driver).GetChecksums()
+	if err != nil {
+		log.Printf("Error loading checksums from the migrations table: %s", err)
+		os.Exit(1)
+	}
+	for name := range forwardMigrated {
+		if _, ok := checksums[name]; !ok {
+			checksums[name] = ""
+		}
+	}
+
+	steps, err := verifyChecksums(migrations, checksums, *dir, ioutilFileReader{})
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	for _, vs := range steps {
+		fmt.Printf("%-8s %s\n", vs.Status, vs.Step.Filename)
+	}
+	if len(steps) == 0 {
+		fmt.Println("There are no forward migrated migrations.")
+		return
+	}
+
+	if n := len(modifiedFilenames(steps)); n != 0 {
+		msg := fmt.Sprintf("%d forward migrated migration(s) have been modified since their execution.", n)
+		if *allowModified {
+			log.Print("Warning: " + msg)
+			return
+		}
+		log.Print(msg)
+		os.Exit(1)
+	}
+}
+
+const historyUsage = `Usage: sql-migrate history <options...>
+
+Show the log of the migration steps executed by goto commands including the
+failed ones. Unlike the migrations table the history table is append-only:
+it keeps the entries of the reverted migrations.
+
+The -since and -until options accept RFC3339 timestamps (2006-01-02T15:04:05Z),
+dates (2006-01-02, UTC) and durations before now (e.g.: 24h).
+
+Options:
+`
+
+func cmdHistory(args []string) {
+	fs := newFlagSet("history", historyUsage)
+	driverName, dsn, table := addDriverFlags(fs)
+	migration := fs.String("migration", "", "Show only the entries of the specified migration (name or filename).")
+	since := fs.String("since", "", "Show only the steps started at or after the specified time.")
+	until := fs.String("until", "", "Show only the steps started before the specified time.")
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	now := time.Now()
+	sinceTime, err := parseHistoryTime(*since, now)
+	if err != nil {
+		log.Printf("Invalid -since option: %s", err)
+		os.Exit(1)
+	}
+	untilTime, err := parseHistoryTime(*until, now)
+	if err != nil {
+		log.Printf("Invalid -until option: %s", err)
+		os.Exit(1)
+	}
+	driver := processDriverFlags(fs, driverName, dsn, table)
+	defer driver.Close()
+
+	hr, ok := driver.(HistoryRecorder)
+	if !ok {
+		log.Printf("The %s driver doesn't support history.", *driverName)
+		os.Exit(1)
+	}
+	entries, err := hr.LoadHistory()
+	if err == errNoHistoryTable {
+		fmt.Println("There is no history: the history table is created by the first command that executes migration steps.")
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading the history table: %s", err)
+		os.Exit(1)
+	}
+
+	entries = filterHistory(entries, *migration, sinceTime, untilTime)
+	for _, h := range entries {
+		fmt.Println(h)
+	}
+	if len(entries) == 0 {
+		fmt.Println("There are no history entries.")
+	}
+}
+
+const createUsage = `Usage: sql-migrate create <options...>
+
+Create the empty forward and backward step files of a new migration in the
+directory specified by the -dir option.
+
+The ID of the new migration depends on the -id_scheme option: the ID of the
+latest migration plus one with the zero-padding width of the latest ID
+(sequential), the current UTC time (timestamp) or the latest version with
+its last component incremented (semver). The filenames are built with the
+-fwd, -bwd, -notx and -ext suffixes. E.g.: with the default options
+"sql-migrate create -dir migrations -desc add_users" creates the
+0001_add_users.sql and 0001_add_users.back.sql files in an empty directory.
+
+The -no_tx option creates steps with the notx suffix. It isn't called -notx
+because the -notx option sets the suffix like in the other commands.
+
+Options:
+`
+
+func cmdCreate(args []string) {
+	fs := newFlagSet("create", createUsage)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	desc := fs.String("desc", "", "The optional description of the migration. It is appended to the ID with a leading underscore.")
+	noBackward := fs.Bool("no_backward", false, "Don't create a backward step.")
+	noTx := fs.Bool("no_tx", false, "Add the -notx suffix to the filenames of the steps.")
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	migrations := processDirFlag(dir, fwd, bwd, notx, ext, idScheme)
+
+	paths, err := createMigrationFiles(*dir, migrations, *desc, !*noBackward, *noTx, *fwd, *bwd, *notx, *ext)
+	for _, path := range paths {
+		fmt.Printf("Created %s\n", path)
+	}
+	if err != nil {
+		log.Printf("Error creating migration files: %s", err)
+		os.Exit(1)
+	}
+}
+
+const renumberUsage = `Usage: sql-migrate renumber <options...>
+
+Renumber the migrations that haven't been applied to make their IDs
+sequential. It resolves the duplicate IDs created by branches that have
+added migrations with the same ID (e.g.: 0042_users.sql and
+0042_orders.sql) and the gaps left by deleted migrations.
+
+The applied migrations keep their IDs: they are loaded from the migrations
+table (-driver and -dsn options) or they are the migrations with IDs not
+greater than the -base option. The -base option overrides the -driver and
+-dsn values of the environment variables and the config file but it can't
+be used together with the -driver and -dsn options of the command line.
+The applied migrations must have the IDs
+1..N. The rest of the migrations get the subsequent IDs in the order of
+their current IDs and descriptions. The forward and backward files of a
+migration are renamed together keeping their descriptions and suffixes.
+
+Only the sequential ID scheme is supported.
+
+Options:
+`
+
+func cmdRenumber(args []string) {
+	fs := newFlagSet("renumber", renumberUsage)
+	driverName, dsn, table := addDriverFlags(fs)
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	base := fs.Int64("base", -1, "The ID of the latest applied migration. It can be used instead of the -driver and -dsn options and it overrides their values set by environment variables or the config file.")
+	dryRun := fs.Bool("dry_run", false, "Print the renames without renaming the files.")
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	if scheme := validateDirFlags(dir, fwd, bwd, notx, ext, idScheme); scheme != IDSchemeSequential {
+		log.Printf("The renumber command doesn't support the %s ID scheme.", scheme)
+		os.Exit(1)
+	}
+	useBase, err := useRenumberBase(*base, *driverName, *dsn, cmdLineFlags[fs])
+	if err != nil {
+		log.Print(err)
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	groups, err := loadRenumberGroups(listMigrationsDir(*dir), *fwd, *bwd, *notx, *ext)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+
+	if useBase {
+		markBaseGroups(groups, *base)
+	} else {
+		driver := processDriverFlags(fs, driverName, dsn, table)
+		forwardMigrated, err := driver.GetForwardMigratedNames()
+		driver.Close()
+		if err != nil {
+			log.Printf("Error loading migration status from the migrations table: %s", err)
+			os.Exit(1)
+		}
+		if err := markAppliedGroups(groups, forwardMigrated); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+	}
+
+	renames, err := planRenumber(groups)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	if len(renames) == 0 {
+		fmt.Println("Nothing to renumber.")
+		return
+	}
+	for _, r := range renames {
+		fmt.Printf("%s -> %s\n", r.From, r.To)
+	}
+	if *dryRun {
+		return
+	}
+	if err := renameFiles(*dir, renames); err != nil {
+		log.Printf("Error renaming migration files: %s", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Renamed %d files.\n", len(renames))
+}
+
+const lintUsage = `Usage: sql-migrate lint <options...>
+
+Check the migration files without connecting to the database and report
+every problem: unparseable filenames, duplicate and missing IDs, backward
+steps without forward steps, forward and backward steps with different
+descriptions, empty steps, migrations without backward steps (a warning
+unless -require_backward is used) and notx suffixes ignored by the driver
+specified with the optional -driver option.
+
+Exit codes:
+  0  no problems
+  1  runtime error (e.g.: unreadable migrations directory) or invalid options
+  2  invalid command line syntax
+  3  only warnings
+  4  errors found in the migration files
+
+Options:
+`
+
+func cmdLint(args []string) {
+	fs := newFlagSet("lint", lintUsage)
+	driverName := fs.String("driver", "", "Optional driver name for the driver specific checks. Valid values: "+strings.Join(driverNames(), ", "))
+	bindEnvVars(fs, "driver")
+	for _, addFlags := range driverFlags {
+		addFlags(fs)
+	}
+	dir, fwd, bwd, notx, ext, idScheme := addDirFlags(fs)
+	requireBackward := fs.Bool("require_backward", false, "Report migrations without backward steps as errors instead of warnings.")
+	format := fs.String("format", "text", "The output format: text or json.")
+	parseFlags(fs, args)
+
+	expectNoArgs(fs)
+	scheme := validateDirFlags(dir, fwd, bwd, notx, ext, idScheme)
+	if *format != "text" && *format != "json" {
+		log.Printf("Invalid -format option: %q", *format)
 		os.Exit(1)
 	}
-
-	checkbox := func(checked bool) string {
-		if checked {
-			return "[X]"
+	var caps *DriverCapabilities
+	if *driverName != "" {
+		capsFunc, ok := driverCapabilities[*driverName]
+		if !ok {
+			log.Print("Invalid driver: " + *driverName)
+			os.Exit(1)
 		}
-		return "[ ]"
+		c := capsFunc()
+		caps = &c
 	}
-	for _, m := range migrations.Sorted {
-		_, applied := forwardMigrated[m.Forward.MigrationName]
-		s := checkbox(applied) + " " + m.Forward.Filename
-		if m.Forward.ParsedFilename.NoTx {
-			s += " [no-forward-transaction]"
+
+	problems := lintMigrations(*dir, listMigrationsDir(*dir), scheme, *fwd, *bwd, *notx, *ext,
+		*requireBackward, *driverName, caps, ioutilFileReader{})
+
+	if *format == "json" {
+		if problems == nil {
+			problems = []*lintProblem{}
 		}
-		if m.Backward == nil {
-			s += " [no-backward-migration]"
-		} else if m.Backward.ParsedFilename.NoTx {
-			s += " [no-backward-transaction]"
+		b, err := json.MarshalIndent(struct {
+			Problems []*lintProblem `json:"problems"`
+		}{problems}, "", "  ")
+		if err != nil {
+			log.Print(err)
+			os.Exit(1)
 		}
-		fmt.Println(s)
-	}
-
-	allSet := make(map[string]struct{}, len(migrations.Sorted))
-	for _, m := range migrations.Sorted {
-		allSet[m.Forward.MigrationName] = struct{}{}
-	}
-	var invalidForwardMigrated []string
-	for name := range forwardMigrated {
-		if _, ok := allSet[name]; !ok {
-			invalidForwardMigrated = append(invalidForwardMigrated, name)
+		fmt.Println(string(b))
+	} else {
+		for _, p := range problems {
+			fmt.Println(p)
 		}
+		fmt.Println(lintSummary(problems))
 	}
-	sort.Strings(invalidForwardMigrated)
-	for _, migrationName := range invalidForwardMigrated {
-		fmt.Println(" !  Entry in the migration table without migration files: " + migrationName)
-	}
-
-	if len(migrations.Sorted) == 0 && len(invalidForwardMigrated) == 0 {
-		fmt.Println("There are no migrations.")
-	}
+	os.Exit(lintExitCode(problems))
 }
 
-const planUsage = `Usage: sql-migrate plan <options...>
-
-Show a plan without modifying the database.
+const lockStatusUsage = `Usage: sql-migrate lock-status <options...>
 
-This command has the same options as the goto command.
-The plan lists the steps that would be performed
-by a goto with the same commandline parameters.
+Show the holder of the migration lock of the goto command.
 
 Options:
 `
 
-func cmdPlan(args []string) {
-	fs := newFlagSet("plan", planUsage)
+func cmdLockStatus(args []string) {
+	fs := newFlagSet("lock-status", lockStatusUsage)
 	driverName, dsn, table := addDriverFlags(fs)
-	dir, fwd, bwd, notx, ext := addDirFlags(fs)
-	target := addTargetFlag(fs)
-	fs.Parse(args)
+	parseFlags(fs, args)
 
 	expectNoArgs(fs)
-	processTargetFlag(target)
-	migrations := processDirFlag(dir, fwd, bwd, notx, ext)
 	driver := processDriverFlags(fs, driverName, dsn, table)
 	defer driver.Close()
 
-	steps := loadStateAndCreatePlan(*target, migrations, driver)
-	for _, st := range steps {
-		fmt.Println(st)
+	holder, err := driverLocker(*driverName, driver).LockStatus()
+	if err != nil {
+		log.Printf("Error querying the migration lock: %s", err)
+		os.Exit(1)
 	}
-	if len(steps) == 0 {
-		fmt.Println("Nothing to migrate.")
+	if holder == "" {
+		fmt.Println("The migration lock isn't held.")
+		return
+	}
+	fmt.Printf("The migration lock is held by %s.\n", holder)
+	if cr, ok := driver.(CapabilityReporter); ok && !cr.Capabilities().AdvisoryLocking {
+		fmt.Println("The lock isn't released automatically if its holder dies: " +
+			"release a stale lock with the force-unlock command.")
 	}
 }
 
-const gotoUsage = `Usage: sql-migrate goto <options...>
+const forceUnlockUsage = `Usage: sql-migrate force-unlock <options...>
 
-Go to the specified version of the database schema by going to the
-migration specified by the -target parameter.
+Release the migration lock regardless of its holder.
 
-- Migrations that are newer the target and have been forward migrated
-  are reverted by executing their backward steps in descending order.
-- The target migration along with the older migrations are forward
-  migrated in ascending order by executing the forward steps of those
-  that haven't yet been forward migrated.
+Use this command only when the holder of the lock is known to be dead
+(e.g.: a goto command killed while holding a lock row). Releasing the lock
+of a running goto command allows other goto commands to run concurrently
+with it. With postgres and mysql the lock is released by terminating the
+database session of its holder.
 
 Options:
 `
 
-func cmdGoto(args []string) {
-	fs := newFlagSet("goto", gotoUsage)
+func cmdForceUnlock(args []string) {
+	fs := newFlagSet("force-unlock", forceUnlockUsage)
 	driverName, dsn, table := addDriverFlags(fs)
-	dir, fwd, bwd, notx, ext := addDirFlags(fs)
-	target := addTargetFlag(fs)
-	fs.Parse(args)
+	parseFlags(fs, args)
 
 	expectNoArgs(fs)
-	processTargetFlag(target)
-	migrations := processDirFlag(dir, fwd, bwd, notx, ext)
 	driver := processDriverFlags(fs, driverName, dsn, table)
 	defer driver.Close()
 
-	steps := loadStateAndCreatePlan(*target, migrations, driver)
-
-	id, idCancel := newInterruptDetector(osExiter{}, stderrPrinter{})
-	defer idCancel()
-
-	for _, st := range steps {
-		if err := st.ExecuteAndLog(*dir, driver, ioutilFileReader{}, stdoutPrinter{}); err != nil {
-			log.Print(err)
-			os.Exit(1)
-		}
-		id.ExitIfInterrupted()
+	locker := driverLocker(*driverName, driver)
+	holder, err := locker.LockStatus()
+	if err != nil {
+		log.Printf("Error querying the migration lock: %s", err)
+		os.Exit(1)
 	}
-	if len(steps) == 0 {
-		fmt.Println("Nothing to migrate.")
+	if holder == "" {
+		fmt.Println("The migration lock isn't held.")
+		return
+	}
+	if err := locker.ForceUnlock(); err != nil {
+		log.Printf("Error releasing the migration lock: %s", err)
+		os.Exit(1)
 	}
+	fmt.Printf("Released the migration lock held by %s.\n", holder)
 }
 
 const versionUsage = `Usage: sql-migrate version
@@ -239,13 +1049,10 @@ var buildDate string
 
 func cmdVersion(args []string) {
 	fs := newFlagSet("version", versionUsage)
-	fs.Parse(args)
+	parseFlags(fs, args)
 	expectNoArgs(fs)
 
-	if version == "" {
-		version = "dev"
-	}
-	fmt.Printf("version     : %s\n", version)
+	fmt.Printf("version     : %s\n", versionString())
 	if buildDate != "" {
 		fmt.Printf("build date  : %s\n", buildDate)
 	}
@@ -258,6 +1065,13 @@ func cmdVersion(args []string) {
 	fmt.Printf("db drivers  : %s\n", strings.Join(driverNames(), ", "))
 }
 
+func versionString() string {
+	if version == "" {
+		return "dev"
+	}
+	return version
+}
+
 func newFlagSet(name, usage string) *flag.FlagSet {
 	fs := flag.NewFlagSet(name, flag.ExitOnError)
 	fs.Usage = func() {
@@ -268,12 +1082,31 @@ func newFlagSet(name, usage string) *flag.FlagSet {
 }
 
 func addDriverFlags(fs *flag.FlagSet) (driverName, dsn, table *string) {
-	driverName = fs.String("driver", "", "Driver name. Valid values: "+strings.Join(driverNames(), ", "))
+	driverName = fs.String("driver", "", "Driver name. Valid values: "+strings.Join(driverNames(), ", ")+" or "+execDriverPrefix+"<path_to_driver_plugin>")
 	dsn = fs.String("dsn", "", "Driver specific data source name.")
 	table = fs.String("migrations_table", "migrations", "The name of the table that stores the migration state.")
+	bindEnvVars(fs, "driver", "dsn", "migrations_table")
+	before := flagNames(fs)
+	for _, addFlags := range driverFlags {
+		addFlags(fs)
+	}
+	for name := range flagNames(fs) {
+		if !before[name] {
+			bindEnvVars(fs, name)
+		}
+	}
+	addConfigFlags(fs)
 	return
 }
 
+func flagNames(fs *flag.FlagSet) map[string]bool {
+	names := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) {
+		names[f.Name] = true
+	})
+	return names
+}
+
 func processDriverFlags(fs *flag.FlagSet, driverName, dsn, table *string) Driver {
 	if *table == "" {
 		log.Print("The -migrations_table option can't be an empty string.")
@@ -286,11 +1119,21 @@ func processDriverFlags(fs *flag.FlagSet, driverName, dsn, table *string) Driver
 	}
 
 	driverFactory, ok := drivers[*driverName]
+	if strings.HasPrefix(*driverName, execDriverPrefix) {
+		driverFactory, ok = newExecDriverFactory(strings.TrimPrefix(*driverName, execDriverPrefix)), true
+	}
 	if !ok {
 		log.Print("Invalid driver: " + *driverName)
 		os.Exit(1)
 	}
-	driver, err := driverFactory(*dsn, *table)
+	// The unexpanded DSN is logged because the environment variables can
+	// contain secrets.
+	expandedDSN, err := expandEnvVars(*dsn, os.LookupEnv)
+	if err != nil {
+		log.Printf("Invalid -dsn option: %s", err)
+		os.Exit(1)
+	}
+	driver, err := driverFactory(expandedDSN, *table)
 	if err != nil {
 		log.Printf("Error initialising DB driver %q with DSN=%q: %s", *driverName, *dsn, err)
 		os.Exit(1)
@@ -298,16 +1141,31 @@ func processDriverFlags(fs *flag.FlagSet, driverName, dsn, table *string) Driver
 	return driver
 }
 
-func addDirFlags(fs *flag.FlagSet) (dir, fwd, bwd, notx, ext *string) {
+func addDirFlags(fs *flag.FlagSet) (dir, fwd, bwd, notx, ext, idScheme *string) {
 	dir = fs.String("dir", "", "The directory containing the migration files.")
 	fwd = fs.String("fwd", "", "The filename suffix that marks the file as a forward migration.")
 	bwd = fs.String("bwd", ".back", "The filename suffix that marks the file as a backward migration.")
 	notx = fs.String("notx", ".notx", "The filename suffix that doesn't allow the execution of the migration step in a transaction.")
 	ext = fs.String("ext", ".sql", "The expected extension of migration files.")
+	idScheme = fs.String("id_scheme", IDSchemeSequential.String(), "The format of the migration IDs: sequential (1, 2, 3...), timestamp (e.g.: 20261016120000 with gaps) or semver (e.g.: V1.2.3).")
+	bindEnvVars(fs, "dir", "fwd", "bwd", "notx", "ext", "id_scheme")
+	addConfigFlags(fs)
 	return
 }
 
-func processDirFlag(dir, fwd, bwd, notx, ext *string) *Migrations {
+func processDirFlag(dir, fwd, bwd, notx, ext, idScheme *string) *Migrations {
+	scheme := validateDirFlags(dir, fwd, bwd, notx, ext, idScheme)
+	ms, err := loadMigrationsDir(*dir, scheme, *fwd, *bwd, *notx, *ext, listMigrationsDir)
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	return ms
+}
+
+// validateDirFlags checks the options added by addDirFlags and returns the
+// parsed ID scheme.
+func validateDirFlags(dir, fwd, bwd, notx, ext, idScheme *string) IDScheme {
 	if *dir == "" {
 		log.Print("The -dir option can't be an empty string.")
 		os.Exit(1)
@@ -321,29 +1179,53 @@ func processDirFlag(dir, fwd, bwd, notx, ext *string) *Migrations {
 		os.Exit(1)
 	}
 
-	ms, err := loadMigrationsDir(*dir, *fwd, *bwd, *notx, *ext, func(dir string) []string {
-		entries, err := ioutil.ReadDir(dir)
-		if err != nil {
-			log.Printf("Error loading migrations dir %q: %s", dir, err)
-			os.Exit(1)
-		}
-		a := make([]string, 0, len(entries))
-		for _, fi := range entries {
-			if !fi.IsDir() {
-				a = append(a, fi.Name())
-			}
-		}
-		return a
-	})
+	scheme, err := parseIDScheme(*idScheme)
 	if err != nil {
-		log.Print(err)
+		log.Printf("Invalid -id_scheme option: %s", err)
 		os.Exit(1)
 	}
-	return ms
+	return scheme
+}
+
+func listMigrationsDir(dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Printf("Error loading migrations dir %q: %s", dir, err)
+		os.Exit(1)
+	}
+	a := make([]string, 0, len(entries))
+	for _, fi := range entries {
+		if !fi.IsDir() {
+			a = append(a, fi.Name())
+		}
+	}
+	return a
+}
+
+func addNoDriverWarningsFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("no_driver_warnings", false, "Don't warn about migration steps that use features ignored by the driver (e.g.: transactions with databases that don't support transactional DDL).")
+}
+
+func addAllowModifiedFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("allow_modified", false, "Don't fail if a forward migrated migration has been modified since its execution.")
+}
+
+func addAllowOutOfOrderFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("allow_out_of_order", false, "Forward migrate the unapplied migrations that precede applied ones instead of failing.")
+}
+
+func addAppliedByFlag(fs *flag.FlagSet) *string {
+	return fs.String("applied_by", "", "An optional label (e.g.: the name of a CI job) stored in the migrations table with the forward migrated migrations.")
+}
+
+func addYesFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("yes", false, "Don't ask for confirmation.")
 }
 
 func addTargetFlag(fs *flag.FlagSet) *string {
-	return fs.String("target", "", `The numeric ID or name of the target migration file. It can also be one of the "initial" and "latest" constants.`)
+	target := fs.String("target", "", `The ID or name of the target migration file. It can also be one of the "initial", "latest", "current", "next" and "previous" constants or a number of migrations relative to the current one (e.g.: +1, -2).`)
+	bindEnvVars(fs, "target")
+	return target
 }
 
 func processTargetFlag(target *string) {
@@ -410,6 +1292,17 @@ func (o *interruptDetector) waitForSignal() {
 
 var drivers = map[string]func(dsn, tableName string) (Driver, error){}
 
+// driverFlags can be used by drivers to add driver specific options to the
+// commands that receive the -driver and -dsn options. The drivers register
+// these functions in their init() and store the option values in their own
+// package level variables.
+var driverFlags []func(fs *flag.FlagSet)
+
+// driverCapabilities returns the capabilities of the drivers without
+// connecting to a database. It is used by the commands that don't receive
+// the -dsn option. The drivers register these functions in their init().
+var driverCapabilities = map[string]func() DriverCapabilities{}
+
 func driverNames() []string {
 	names := make([]string, 0, len(drivers))
 	for name := range drivers {
@@ -420,8 +1313,21 @@ func driverNames() []string {
 }
 
 type Migrations struct {
-	Sorted []*Migration
-	Names  map[string]int
+	Sorted   []*Migration
+	Names    map[string]int
+	IDScheme IDScheme
+}
+
+// Steps returns the forward and backward steps of all migrations.
+func (o *Migrations) Steps() []*Step {
+	var steps []*Step
+	for _, m := range o.Sorted {
+		steps = append(steps, m.Forward)
+		if m.Backward != nil {
+			steps = append(steps, m.Backward)
+		}
+	}
+	return steps
 }
 
 type Migration struct {
@@ -435,7 +1341,7 @@ type Step struct {
 	ParsedFilename *ParsedFilename
 }
 
-func (o *Step) ExecuteAndLog(dir string, d Driver, r FileReader, p Printer) error {
+func (o *Step) ExecuteAndLog(dir string, d Driver, r FileReader, p Printer, meta *MigrationMetadata) error {
 	p.Print(o.String() + " ... ")
 
 	contents, err := r.ReadFile(filepath.Join(dir, o.Filename))
@@ -443,12 +1349,63 @@ func (o *Step) ExecuteAndLog(dir string, d Driver, r FileReader, p Printer) erro
 		p.Print("FAILED\n")
 		return err
 	}
-	if err := d.ExecuteStep(o, string(contents)); err != nil {
+	stepMeta := meta.forStep(contents)
+	err = d.ExecuteStep(o, string(contents), stepMeta)
+	historyErr := recordHistory(d, o, stepMeta, err)
+	if err != nil {
 		p.Print("FAILED\n")
+		if historyErr != nil {
+			return fmt.Errorf("%s (%s)", err, historyErr)
+		}
 		return err
 	}
 	p.Print("OK\n")
-	return nil
+	return historyErr
+}
+
+// MarkAndLog updates the migrations table as if the step had been executed
+// without executing it. The checksum of forward steps is calculated from the
+// contents of their files.
+func (o *Step) MarkAndLog(dir string, d Driver, r FileReader, p Printer, meta *MigrationMetadata) error {
+	p.Print(o.markString() + " ... ")
+
+	var contents []byte
+	if o.ParsedFilename.Direction == DirectionForward {
+		var err error
+		contents, err = r.ReadFile(filepath.Join(dir, o.Filename))
+		if err != nil {
+			p.Print("FAILED\n")
+			return err
+		}
+	}
+	stepMeta := meta.forStep(contents)
+	sm, ok := d.(StateMarker)
+	if !ok {
+		p.Print("FAILED\n")
+		return errors.New("the driver doesn't support marking migrations without executing them")
+	}
+	err := sm.MarkStep(o, stepMeta)
+	h := newHistoryEntry(o, stepMeta, time.Now(), err)
+	if err == nil {
+		h.Status = historyStatusMarked
+	}
+	historyErr := recordHistoryEntry(d, h)
+	if err != nil {
+		p.Print("FAILED\n")
+		if historyErr != nil {
+			return fmt.Errorf("%s (%s)", err, historyErr)
+		}
+		return err
+	}
+	p.Print("OK\n")
+	return historyErr
+}
+
+func (o *Step) markString() string {
+	if o.ParsedFilename.Direction == DirectionBackward {
+		return "mark-unapplied " + o.Filename
+	}
+	return "mark-applied " + o.Filename
 }
 
 func (o *Step) String() string {
@@ -465,26 +1422,27 @@ func (o *Step) String() string {
 
 type listDirFunc func(dir string) []string
 
-func loadMigrationsDir(migrationsDir, fwd, bwd, notx, ext string, f listDirFunc) (*Migrations, error) {
+func loadMigrationsDir(migrationsDir string, scheme IDScheme, fwd, bwd, notx, ext string, f listDirFunc) (*Migrations, error) {
 	entries := f(migrationsDir)
-	idMap := make(map[int64]*Migration, len(entries))
+	idMap := make(map[string]*Migration, len(entries))
 	for _, name := range entries {
-		parsed, err := parseFilename(name, fwd, bwd, notx, ext)
+		parsed, err := scheme.parseFilename(name, fwd, bwd, notx, ext)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing filename %q: %s", name, err)
 		}
 
-		m, ok := idMap[parsed.ID]
+		key := parsed.idKey()
+		m, ok := idMap[key]
 		if !ok {
 			m = &Migration{}
-			idMap[parsed.ID] = m
+			idMap[key] = m
 		}
 		p := &m.Forward
 		if parsed.Direction == DirectionBackward {
 			p = &m.Backward
 		}
 		if *p != nil {
-			return nil, fmt.Errorf("duplicate %s migration for ID %v: %q and %q", parsed.Direction, parsed.ID, (*p).Filename, name)
+			return nil, fmt.Errorf("duplicate %s migration for ID %v: %q and %q", parsed.Direction, key, (*p).Filename, name)
 		}
 		*p = &Step{
 			Filename:       name,
@@ -492,13 +1450,14 @@ func loadMigrationsDir(migrationsDir, fwd, bwd, notx, ext string, f listDirFunc)
 		}
 	}
 
-	return sortAndIndexMigrations(idMap)
+	return sortAndIndexMigrations(scheme, idMap)
 }
 
-func sortAndIndexMigrations(idMap map[int64]*Migration) (*Migrations, error) {
+func sortAndIndexMigrations(scheme IDScheme, idMap map[string]*Migration) (*Migrations, error) {
 	ms := &Migrations{
-		Sorted: make([]*Migration, 0, len(idMap)),
-		Names:  make(map[string]int, len(idMap)*4),
+		Sorted:   make([]*Migration, 0, len(idMap)),
+		Names:    make(map[string]int, len(idMap)*4),
+		IDScheme: scheme,
 	}
 
 	for _, m := range idMap {
@@ -507,7 +1466,7 @@ func sortAndIndexMigrations(idMap map[int64]*Migration) (*Migrations, error) {
 		}
 		ms.Sorted = append(ms.Sorted, m)
 
-		name := fmt.Sprintf("%04d%s", m.Forward.ParsedFilename.ID, m.Forward.ParsedFilename.Description)
+		name := scheme.migrationName(m.Forward.ParsedFilename)
 		m.Forward.MigrationName = name
 		if m.Backward != nil {
 			m.Backward.MigrationName = name
@@ -518,26 +1477,19 @@ func sortAndIndexMigrations(idMap map[int64]*Migration) (*Migrations, error) {
 		}
 	}
 	sort.Slice(ms.Sorted, func(i, j int) bool {
-		return ms.Sorted[i].Forward.ParsedFilename.ID < ms.Sorted[j].Forward.ParsedFilename.ID
+		return scheme.less(ms.Sorted[i].Forward.ParsedFilename, ms.Sorted[j].Forward.ParsedFilename)
 	})
 
 	for i, m := range ms.Sorted {
-		ms.Names[strconv.FormatInt(m.Forward.ParsedFilename.ID, 10)] = i
-		ms.Names[m.Forward.ParsedFilename.IDStr] = i
+		for _, idName := range scheme.idNames(m.Forward.ParsedFilename) {
+			ms.Names[idName] = i
+		}
 		ms.Names[m.Forward.MigrationName] = i
 		ms.Names[m.Forward.Filename] = i
 	}
 
-	if len(ms.Sorted) == 0 {
-		return ms, nil
-	}
-	if ms.Sorted[0].Forward.ParsedFilename.ID != 1 {
-		return nil, fmt.Errorf("the first migration ID must be 1 but it is %v", ms.Sorted[0].Forward.ParsedFilename.ID)
-	}
-	for i, m := range ms.Sorted[1:] {
-		if m.Forward.ParsedFilename.ID != ms.Sorted[i].Forward.ParsedFilename.ID+1 {
-			return nil, fmt.Errorf("missing migration ID (gap): %v", ms.Sorted[i].Forward.ParsedFilename.ID+1)
-		}
+	if errs := scheme.idErrors(ms.Sorted); len(errs) != 0 {
+		return nil, errs[0]
 	}
 	return ms, nil
 }
@@ -562,34 +1514,28 @@ func (o Direction) String() string {
 }
 
 type ParsedFilename struct {
-	ID          int64
-	IDStr       string // IDStr retains leading zeros (if any)
+	ID    int64
+	IDStr string // IDStr retains leading zeros (if any)
+	// Version is the parsed IDStr of the IDSchemeSemver. It is nil with
+	// numeric IDs.
+	Version     []int64
 	Description string
 	Direction   Direction
 	NoTx        bool
 }
 
+// parseFilename parses a filename with a numeric ID.
 func parseFilename(fn, fwd, bwd, notx, ext string) (*ParsedFilename, error) {
-	var parsed ParsedFilename
-
-	i := strings.IndexFunc(fn, func(c rune) bool {
-		return c < '0' || c > '9'
-	})
+	return IDSchemeSequential.parseFilename(fn, fwd, bwd, notx, ext)
+}
 
-	switch {
-	case fn == "" || i == 0:
-		return nil, errors.New("missing numeric ID prefix")
-	case i < 0:
-		parsed.IDStr, fn = fn, ""
-	default:
-		parsed.IDStr, fn = fn[:i], fn[i:]
-	}
+func (o IDScheme) parseFilename(fn, fwd, bwd, notx, ext string) (*ParsedFilename, error) {
+	var parsed ParsedFilename
 
-	id, err := strconv.ParseInt(parsed.IDStr, 10, 64)
+	fn, err := o.parseID(fn, &parsed)
 	if err != nil {
-		return nil, fmt.Errorf("invalid ID: %s", err)
+		return nil, err
 	}
-	parsed.ID = id
 
 	if !strings.HasSuffix(fn, ext) {
 		return nil, fmt.Errorf("missing %q extension", ext)
@@ -640,48 +1586,49 @@ loop:
 	return &parsed, nil
 }
 
-func loadStateAndCreatePlan(target string, ms *Migrations, d Driver) []*Step {
-	forwardMigrated, err := d.GetForwardMigratedNames()
-	if err != nil {
-		log.Printf("Error loading migration status from the migrations table: %s", err)
-		os.Exit(1)
+// checkMissingMigrationFiles returns an error if the migrations table has an
+// entry without migration files.
+func checkMissingMigrationFiles(ms *Migrations, forwardMigrated map[string]struct{}) error {
+	allSet := make(map[string]struct{}, len(ms.Sorted))
+	for _, m := range ms.Sorted {
+		allSet[m.Forward.MigrationName] = struct{}{}
 	}
-	steps, err := createPlan(target, ms, forwardMigrated)
+	for entry := range forwardMigrated {
+		if _, ok := allSet[entry]; !ok {
+			return fmt.Errorf("there is at least one entry in the migrations table without an existing migration file (examine it with the status command and remove it with the mark-unapplied command) - entry=%q", entry)
+		}
+	}
+	return nil
+}
+
+func loadStateAndCreatePlan(target string, ms *Migrations, d Driver, allowOutOfOrder bool) ([]*Step, map[string]struct{}, error) {
+	forwardMigrated, err := d.GetForwardMigratedNames()
 	if err != nil {
-		log.Print(err)
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("Error loading migration status from the migrations table: %s", err)
 	}
-	return steps
+	steps, err := createPlan(target, ms, forwardMigrated, allowOutOfOrder)
+	return steps, forwardMigrated, err
 }
 
-func createPlan(target string, ms *Migrations, forwardMigrated map[string]struct{}) ([]*Step, error) {
-	allSet := make(map[string]struct{}, len(ms.Sorted))
+// createPlan returns the steps that migrate the database to the target. If
+// allowOutOfOrder is true then the unapplied migrations before applied ones
+// are forward migrated without reverting the later applied migrations.
+func createPlan(target string, ms *Migrations, forwardMigrated map[string]struct{}, allowOutOfOrder bool) ([]*Step, error) {
 	seenUnapplied := false
 	for _, m := range ms.Sorted {
-		allSet[m.Forward.MigrationName] = struct{}{}
 		_, applied := forwardMigrated[m.Forward.MigrationName]
-		if applied && seenUnapplied {
-			return nil, fmt.Errorf("there is at least one unapplied migration before applied migration %q (examine it with the status command and fix it manually)", m.Forward.Filename)
+		if applied && seenUnapplied && !allowOutOfOrder {
+			return nil, fmt.Errorf("there is at least one unapplied migration before applied migration %q (examine it with the status command and fix it manually or use the -allow_out_of_order option)", m.Forward.Filename)
 		}
 		seenUnapplied = seenUnapplied || !applied
 	}
-	for entry := range forwardMigrated {
-		if _, ok := allSet[entry]; !ok {
-			return nil, fmt.Errorf("there is at least one entry in the migrations table without an existing migration file (examine it with the status command and fix it manually) - entry=%q", entry)
-		}
+	if err := checkMissingMigrationFiles(ms, forwardMigrated); err != nil {
+		return nil, err
 	}
 
-	targetIdx := -1
-	switch target {
-	case "initial":
-	case "latest":
-		targetIdx = len(ms.Sorted) - 1
-	default:
-		if idx, ok := ms.Names[target]; ok {
-			targetIdx = idx
-		} else {
-			return nil, fmt.Errorf("invalid target migration - %q", target)
-		}
+	targetIdx, err := resolveTarget(target, ms, forwardMigrated)
+	if err != nil {
+		return nil, err
 	}
 
 	var steps []*Step
@@ -701,3 +1648,133 @@ func createPlan(target string, ms *Migrations, forwardMigrated map[string]struct
 	}
 	return steps, nil
 }
+
+// resolveTarget returns the index of the target migration in ms.Sorted or -1
+// if the target is the initial state. The target can be:
+//   - "initial" or "latest"
+//   - a name or ID in ms.Names
+//   - "current": the last forward migrated migration
+//   - "next" and "previous": the same as +1 and -1
+//   - +N and -N: relative to the current migration
+func resolveTarget(target string, ms *Migrations, forwardMigrated map[string]struct{}) (int, error) {
+	switch target {
+	case "initial":
+		return -1, nil
+	case "latest":
+		return len(ms.Sorted) - 1, nil
+	}
+	if idx, ok := ms.Names[target]; ok {
+		return idx, nil
+	}
+
+	var offset int
+	switch target {
+	case "current":
+	case "next":
+		offset = 1
+	case "previous":
+		offset = -1
+	default:
+		if len(target) < 2 || (target[0] != '+' && target[0] != '-') {
+			return 0, fmt.Errorf("invalid target migration - %q", target)
+		}
+		n, err := strconv.Atoi(target)
+		if err != nil {
+			return 0, fmt.Errorf("invalid target migration - %q", target)
+		}
+		offset = n
+	}
+
+	current := -1
+	for i, m := range ms.Sorted {
+		if _, ok := forwardMigrated[m.Forward.MigrationName]; ok {
+			current = i
+		}
+	}
+	idx := current + offset
+	if idx < -1 || idx >= len(ms.Sorted) {
+		return 0, fmt.Errorf("the relative target %q is out of range (%d of the %d migrations have been forward migrated)", target, current+1, len(ms.Sorted))
+	}
+	return idx, nil
+}
+
+// outOfOrderSteps returns the forward steps of the plan that are executed
+// after a later migration has been forward migrated. The later migrations
+// reverted by the plan don't count.
+func outOfOrderSteps(steps []*Step, ms *Migrations, forwardMigrated map[string]struct{}) map[*Step]bool {
+	reverted := make(map[string]struct{}, len(steps))
+	for _, st := range steps {
+		if st.ParsedFilename.Direction == DirectionBackward {
+			reverted[st.MigrationName] = struct{}{}
+		}
+	}
+	lastApplied := -1
+	for i, m := range ms.Sorted {
+		_, applied := forwardMigrated[m.Forward.MigrationName]
+		_, isReverted := reverted[m.Forward.MigrationName]
+		if applied && !isReverted {
+			lastApplied = i
+		}
+	}
+
+	outOfOrder := make(map[*Step]bool)
+	for _, st := range steps {
+		if st.ParsedFilename.Direction == DirectionForward && ms.Names[st.Filename] < lastApplied {
+			outOfOrder[st] = true
+		}
+	}
+	return outOfOrder
+}
+
+// multiStatementSplitter is used only to detect migration steps that contain
+// multiple statements. It doesn't have to be accurate with every database.
+var multiStatementSplitter = &sqlSplitter{
+	LineComments: []string{"--"},
+	QuoteChars:   "'\"`",
+}
+
+// driverWarnings returns warnings about the steps that use features which
+// are silently ignored by the driver.
+func driverWarnings(driverName string, d Driver, steps []*Step, dir string, r FileReader) []string {
+	cr, ok := d.(CapabilityReporter)
+	if !ok {
+		return nil
+	}
+	caps := cr.Capabilities()
+
+	var warnings []string
+	if !caps.TransactionalDDL {
+		var filenames []string
+		for _, st := range steps {
+			if !st.ParsedFilename.NoTx {
+				filenames = append(filenames, st.Filename)
+			}
+		}
+		if len(filenames) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Warning: the %s driver doesn't support transactional DDL. "+
+				"The following steps don't have the notx filename suffix but they are executed without transactions "+
+				"and they aren't rolled back on error: %s", driverName, strings.Join(filenames, ", ")))
+		}
+	}
+	if !caps.MultiStatementExec {
+		var filenames []string
+		for _, st := range steps {
+			// Unreadable files are reported by the commands that execute them.
+			contents, err := r.ReadFile(filepath.Join(dir, st.Filename))
+			if err == nil && len(multiStatementSplitter.Split(string(contents))) > 1 {
+				filenames = append(filenames, st.Filename)
+			}
+		}
+		if len(filenames) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Warning: the %s driver may not be able to execute multiple statements in one step. "+
+				"The following steps contain multiple statements: %s", driverName, strings.Join(filenames, ", ")))
+		}
+	}
+	return warnings
+}
+
+func printDriverWarnings(driverName string, d Driver, steps []*Step, dir string) {
+	for _, w := range driverWarnings(driverName, d, steps, dir, ioutilFileReader{}) {
+		log.Print(w)
+	}
+}
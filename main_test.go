@@ -1,3 +1,4 @@
+//go:build !integration
 // +build !integration
 
 package main
@@ -317,20 +318,20 @@ func newTestMigrationWithName(fwName, bwName, name string) *Migration {
 	return m
 }
 
-func newTestIDMap(a []*Migration) map[int64]*Migration {
-	idMap := make(map[int64]*Migration, len(a))
+func newTestIDMap(a []*Migration) map[string]*Migration {
+	idMap := make(map[string]*Migration, len(a))
 	for _, m := range a {
 		if m.Forward != nil {
-			idMap[m.Forward.ParsedFilename.ID] = m
+			idMap[m.Forward.ParsedFilename.idKey()] = m
 		} else {
-			idMap[m.Backward.ParsedFilename.ID] = m
+			idMap[m.Backward.ParsedFilename.idKey()] = m
 		}
 	}
 	return idMap
 }
 
 func indexTestMigrations(a []*Migration) *Migrations {
-	ms, err := sortAndIndexMigrations(newTestIDMap(a))
+	ms, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 	if err != nil {
 		panic(err)
 	}
@@ -354,7 +355,7 @@ func TestCreatePlan(t *testing.T) {
 			t.Run(test.target, func(t *testing.T) {
 				ms := indexTestMigrations(nil)
 				forwardMigrated := map[string]struct{}{}
-				steps, err := createPlan(test.target, ms, forwardMigrated)
+				steps, err := createPlan(test.target, ms, forwardMigrated, false)
 				if test.error == "" {
 					require.NoError(t, err)
 					assert.Nil(t, steps)
@@ -418,7 +419,7 @@ func TestCreatePlan(t *testing.T) {
 			for _, test := range tests {
 				t.Run(test.target, func(t *testing.T) {
 					forwardMigrated := map[string]struct{}{}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					require.NoError(t, err)
 					assert.Equal(t, test.steps, steps)
 				})
@@ -469,7 +470,7 @@ func TestCreatePlan(t *testing.T) {
 					forwardMigrated := map[string]struct{}{
 						ms[0].Forward.MigrationName: struct{}{},
 					}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					require.NoError(t, err)
 					assert.Equal(t, test.steps, steps)
 				})
@@ -521,7 +522,7 @@ func TestCreatePlan(t *testing.T) {
 						ms[0].Forward.MigrationName: struct{}{},
 						ms[1].Forward.MigrationName: struct{}{},
 					}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					require.NoError(t, err)
 					assert.Equal(t, test.steps, steps)
 				})
@@ -574,7 +575,7 @@ func TestCreatePlan(t *testing.T) {
 						ms[1].Forward.MigrationName: struct{}{},
 						ms[2].Forward.MigrationName: struct{}{},
 					}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					require.NoError(t, err)
 					assert.Equal(t, test.steps, steps)
 				})
@@ -628,7 +629,7 @@ func TestCreatePlan(t *testing.T) {
 			for _, test := range tests {
 				t.Run(test.target, func(t *testing.T) {
 					forwardMigrated := map[string]struct{}{}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					require.NoError(t, err)
 					assert.Equal(t, test.steps, steps)
 				})
@@ -671,7 +672,7 @@ func TestCreatePlan(t *testing.T) {
 					forwardMigrated := map[string]struct{}{
 						ms[0].Forward.MigrationName: struct{}{},
 					}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					require.NoError(t, err)
 					assert.Equal(t, test.steps, steps)
 				})
@@ -716,7 +717,7 @@ func TestCreatePlan(t *testing.T) {
 						ms[0].Forward.MigrationName: struct{}{},
 						ms[1].Forward.MigrationName: struct{}{},
 					}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					if test.error {
 						require.Error(t, err)
 					} else {
@@ -766,7 +767,7 @@ func TestCreatePlan(t *testing.T) {
 						ms[1].Forward.MigrationName: struct{}{},
 						ms[2].Forward.MigrationName: struct{}{},
 					}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					if test.error {
 						require.Error(t, err)
 					} else {
@@ -817,7 +818,7 @@ func TestCreatePlan(t *testing.T) {
 						ms[2].Forward.MigrationName: struct{}{},
 						ms[3].Forward.MigrationName: struct{}{},
 					}
-					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated)
+					steps, err := createPlan(test.target, createTestMigrations(), forwardMigrated, false)
 					if test.error {
 						require.Error(t, err)
 					} else {
@@ -849,8 +850,67 @@ func TestCreatePlan(t *testing.T) {
 					ms[2].Forward.MigrationName: struct{}{},
 					ms[3].Forward.MigrationName: struct{}{},
 				}
-				_, err := createPlan(target, createTestMigrations(), forwardMigrated)
-				require.EqualError(t, err, `there is at least one unapplied migration before applied migration "003.fw.sql" (examine it with the status command and fix it manually)`)
+				_, err := createPlan(target, createTestMigrations(), forwardMigrated, false)
+				require.EqualError(t, err, `there is at least one unapplied migration before applied migration "003.fw.sql" (examine it with the status command and fix it manually or use the -allow_out_of_order option)`)
+			})
+		}
+	})
+
+	t.Run("allow out of order", func(t *testing.T) {
+		createTestMigrations := func() *Migrations {
+			return indexTestMigrations([]*Migration{
+				newTestMigration("001.fw.sql", "001.bw.sql"),
+				newTestMigration("002.fw.sql", "002.bw.sql"),
+				newTestMigration("003.fw.sql", "003.bw.sql"),
+				newTestMigration("004.fw.sql", "004.bw.sql"),
+			})
+		}
+
+		ms := createTestMigrations().Sorted
+
+		tests := []*struct {
+			target     string
+			steps      []*Step
+			outOfOrder []*Step
+		}{
+			{
+				target:     "latest",
+				steps:      []*Step{ms[1].Forward},
+				outOfOrder: []*Step{ms[1].Forward},
+			},
+			{
+				target:     "3",
+				steps:      []*Step{ms[3].Backward, ms[1].Forward},
+				outOfOrder: []*Step{ms[1].Forward},
+			},
+			{
+				target: "2",
+				steps:  []*Step{ms[3].Backward, ms[2].Backward, ms[1].Forward},
+			},
+			{
+				target: "initial",
+				steps:  []*Step{ms[3].Backward, ms[2].Backward, ms[0].Backward},
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.target, func(t *testing.T) {
+				forwardMigrated := map[string]struct{}{
+					ms[0].Forward.MigrationName: struct{}{},
+					// out of order: index 1 hasn't been applied
+					ms[2].Forward.MigrationName: struct{}{},
+					ms[3].Forward.MigrationName: struct{}{},
+				}
+				migrations := createTestMigrations()
+				steps, err := createPlan(test.target, migrations, forwardMigrated, true)
+				require.NoError(t, err)
+				assert.Equal(t, test.steps, steps)
+
+				var outOfOrder []*Step
+				for st := range outOfOrderSteps(steps, migrations, forwardMigrated) {
+					outOfOrder = append(outOfOrder, st)
+				}
+				assert.Equal(t, test.outOfOrder, outOfOrder)
 			})
 		}
 	})
@@ -866,7 +926,7 @@ func TestCreatePlan(t *testing.T) {
 		}
 
 		forwardMigrated := map[string]struct{}{}
-		_, err := createPlan("9", createTestMigrations(), forwardMigrated)
+		_, err := createPlan("9", createTestMigrations(), forwardMigrated, false)
 		require.EqualError(t, err, `invalid target migration - "9"`)
 	})
 
@@ -885,8 +945,8 @@ func TestCreatePlan(t *testing.T) {
 					ms[0].Forward.MigrationName: struct{}{},
 					"0002_missing":              struct{}{},
 				}
-				_, err := createPlan(target, createTestMigrations(), forwardMigrated)
-				require.EqualError(t, err, `there is at least one entry in the migrations table without an existing migration file (examine it with the status command and fix it manually) - entry="0002_missing"`)
+				_, err := createPlan(target, createTestMigrations(), forwardMigrated, false)
+				require.EqualError(t, err, `there is at least one entry in the migrations table without an existing migration file (examine it with the status command and remove it with the mark-unapplied command) - entry="0002_missing"`)
 			})
 		}
 	})
@@ -903,11 +963,63 @@ func TestCreatePlan(t *testing.T) {
 		forwardMigrated := map[string]struct{}{
 			ms[0].Forward.MigrationName: struct{}{},
 		}
-		_, err := createPlan("initial", createTestMigrations(), forwardMigrated)
+		_, err := createPlan("initial", createTestMigrations(), forwardMigrated, false)
 		require.EqualError(t, err, `migration "001.fw.sql" doesn't have a backward step`)
 	})
 }
 
+func TestResolveTarget(t *testing.T) {
+	ms := indexTestMigrations([]*Migration{
+		newTestMigration("001.fw.sql", "001.bw.sql"),
+		newTestMigration("002.fw.sql", "002.bw.sql"),
+		newTestMigration("003.fw.sql", "003.bw.sql"),
+		newTestMigration("004.fw.sql", "004.bw.sql"),
+	})
+	forwardMigrated := map[string]struct{}{"0001": {}, "0002": {}}
+
+	for _, test := range []*struct {
+		target string
+		idx    int
+		error  string
+	}{
+		{"initial", -1, ""},
+		{"latest", 3, ""},
+		{"3", 2, ""},
+		{"current", 1, ""},
+		{"next", 2, ""},
+		{"previous", 0, ""},
+		{"+2", 3, ""},
+		{"-2", -1, ""},
+		{"+0", 1, ""},
+		{"+3", 0, `the relative target "+3" is out of range (2 of the 4 migrations have been forward migrated)`},
+		{"-3", 0, `the relative target "-3" is out of range (2 of the 4 migrations have been forward migrated)`},
+		{"+", 0, `invalid target migration - "+"`},
+		{"+x", 0, `invalid target migration - "+x"`},
+		{"-1.5", 0, `invalid target migration - "-1.5"`},
+	} {
+		t.Run(test.target, func(t *testing.T) {
+			idx, err := resolveTarget(test.target, ms, forwardMigrated)
+			if test.error == "" {
+				require.NoError(t, err)
+				assert.Equal(t, test.idx, idx)
+			} else {
+				assert.EqualError(t, err, test.error)
+			}
+		})
+	}
+
+	t.Run("no applied migrations", func(t *testing.T) {
+		idx, err := resolveTarget("current", ms, map[string]struct{}{})
+		require.NoError(t, err)
+		assert.Equal(t, -1, idx)
+		idx, err = resolveTarget("next", ms, map[string]struct{}{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, idx)
+		_, err = resolveTarget("previous", ms, map[string]struct{}{})
+		assert.EqualError(t, err, `the relative target "previous" is out of range (0 of the 4 migrations have been forward migrated)`)
+	})
+}
+
 func TestLoadMigrationsDir(t *testing.T) {
 	const testMigrationsDir = "my/dir"
 
@@ -941,7 +1053,7 @@ func TestLoadMigrationsDir(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		t.Run("no migrations", func(t *testing.T) {
 			listDir, called := newDirLister(nil)
-			ms, err := loadMigrationsDir(testMigrationsDir, ".fw", ".bw", ".nt", ".sql", listDir)
+			ms, err := loadMigrationsDir(testMigrationsDir, IDSchemeSequential, ".fw", ".bw", ".nt", ".sql", listDir)
 			require.NoError(t, err)
 			assert.Equal(t, indexTestMigrations(nil), ms)
 			assert.True(t, *called)
@@ -959,7 +1071,7 @@ func TestLoadMigrationsDir(t *testing.T) {
 				return indexTestMigrations(migrationList)
 			}
 
-			ms, err := loadMigrationsDir(testMigrationsDir, ".fw", ".bw", ".nt", ".sql", listDir)
+			ms, err := loadMigrationsDir(testMigrationsDir, IDSchemeSequential, ".fw", ".bw", ".nt", ".sql", listDir)
 			require.NoError(t, err)
 			assert.Equal(t, createTestMigrations(), ms)
 			assert.True(t, *called)
@@ -975,7 +1087,7 @@ func TestLoadMigrationsDir(t *testing.T) {
 		}
 		listDir, _ := newDirLister(migrationList)
 
-		_, err := loadMigrationsDir(testMigrationsDir, ".fw", ".bw", ".nt", ".sql", listDir)
+		_, err := loadMigrationsDir(testMigrationsDir, IDSchemeSequential, ".fw", ".bw", ".nt", ".sql", listDir)
 		assertErrorWithPrefix(t, err, "duplicate forward migration for ID 1:")
 	})
 
@@ -988,7 +1100,7 @@ func TestLoadMigrationsDir(t *testing.T) {
 		}
 		listDir, _ := newDirLister(migrationList)
 
-		_, err := loadMigrationsDir(testMigrationsDir, ".fw", ".bw", ".nt", ".sql", listDir)
+		_, err := loadMigrationsDir(testMigrationsDir, IDSchemeSequential, ".fw", ".bw", ".nt", ".sql", listDir)
 		assertErrorWithPrefix(t, err, "duplicate backward migration for ID 1:")
 	})
 }
@@ -997,7 +1109,7 @@ func TestSortAndIndexMigrations(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		t.Run("no migrations", func(t *testing.T) {
 			a := []*Migration{}
-			ms, err := sortAndIndexMigrations(newTestIDMap(a))
+			ms, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 			require.NoError(t, err)
 			assert.Equal(t, &Migrations{
 				Sorted: []*Migration{},
@@ -1011,7 +1123,7 @@ func TestSortAndIndexMigrations(t *testing.T) {
 				newTestMigration("00003.fw.sql", "00003.bw.sql"),
 				newTestMigration("2_woof.fw.sql", "2_woof.bw.sql"),
 			}
-			ms, err := sortAndIndexMigrations(newTestIDMap(a))
+			ms, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 			require.NoError(t, err)
 			assert.Equal(t, &Migrations{
 				Sorted: []*Migration{
@@ -1041,7 +1153,7 @@ func TestSortAndIndexMigrations(t *testing.T) {
 			newTestMigration("001.fw.sql", "001.bw.sql"),
 			newTestMigration("", "2_meow.bw.nt.sql"),
 		}
-		_, err := sortAndIndexMigrations(newTestIDMap(a))
+		_, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 		require.EqualError(t, err, `migration without forward step - "2_meow.bw.nt.sql"`)
 	})
 
@@ -1049,7 +1161,7 @@ func TestSortAndIndexMigrations(t *testing.T) {
 		a := []*Migration{
 			newTestMigration("001_woof.fw.sql", "001_meow.bw.sql"),
 		}
-		_, err := sortAndIndexMigrations(newTestIDMap(a))
+		_, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 		require.EqualError(t, err, `forward and backward migrations ("001_woof.fw.sql" and "001_meow.bw.sql") have different description ("_woof" and "_meow")`)
 	})
 
@@ -1060,7 +1172,7 @@ func TestSortAndIndexMigrations(t *testing.T) {
 				newTestMigration("001.fw.sql", ""),
 				newTestMigration("2_woof.fw.sql", "2_woof.bw.sql"),
 			}
-			_, err := sortAndIndexMigrations(newTestIDMap(a))
+			_, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 			require.EqualError(t, err, `the first migration ID must be 1 but it is 0`)
 		})
 
@@ -1070,7 +1182,7 @@ func TestSortAndIndexMigrations(t *testing.T) {
 				newTestMigration("003.fw.sql", ""),
 				newTestMigration("4_woof.fw.sql", "4_woof.bw.sql"),
 			}
-			_, err := sortAndIndexMigrations(newTestIDMap(a))
+			_, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 			require.EqualError(t, err, `the first migration ID must be 1 but it is 2`)
 		})
 	})
@@ -1081,7 +1193,7 @@ func TestSortAndIndexMigrations(t *testing.T) {
 			newTestMigration("003.fw.sql", ""),
 			newTestMigration("4_woof.fw.sql", "4_woof.bw.sql"),
 		}
-		_, err := sortAndIndexMigrations(newTestIDMap(a))
+		_, err := sortAndIndexMigrations(IDSchemeSequential, newTestIDMap(a))
 		require.EqualError(t, err, `missing migration ID (gap): 2`)
 	})
 }
@@ -1107,11 +1219,14 @@ func TestStep(t *testing.T) {
 			gomock.InOrder(
 				printer.EXPECT().Print(step.String()+" ... "),
 				fileReader.EXPECT().ReadFile(path).Return([]byte(query), nil),
-				driver.EXPECT().ExecuteStep(step, query),
+				driver.EXPECT().ExecuteStep(step, query, gomock.Any()).Do(func(st *Step, contents string, meta *MigrationMetadata) {
+					assert.Equal(t, checksum([]byte(query)), meta.Checksum)
+					assert.Equal(t, testMetadata.AppliedBy, meta.AppliedBy)
+				}),
 				printer.EXPECT().Print("OK\n"),
 			)
 
-			err := step.ExecuteAndLog(dir, driver, fileReader, printer)
+			err := step.ExecuteAndLog(dir, driver, fileReader, printer, testMetadata)
 			require.NoError(t, err)
 			ctrl.Finish()
 		})
@@ -1137,7 +1252,7 @@ func TestStep(t *testing.T) {
 				printer.EXPECT().Print("FAILED\n"),
 			)
 
-			err := step.ExecuteAndLog(dir, driver, fileReader, printer)
+			err := step.ExecuteAndLog(dir, driver, fileReader, printer, testMetadata)
 			require.Error(t, err)
 			ctrl.Finish()
 		})
@@ -1161,17 +1276,95 @@ func TestStep(t *testing.T) {
 			gomock.InOrder(
 				printer.EXPECT().Print(step.String()+" ... "),
 				fileReader.EXPECT().ReadFile(path).Return([]byte(query), nil),
-				driver.EXPECT().ExecuteStep(step, query).Return(assert.AnError),
+				driver.EXPECT().ExecuteStep(step, query, gomock.Any()).Return(assert.AnError),
 				printer.EXPECT().Print("FAILED\n"),
 			)
 
-			err := step.ExecuteAndLog(dir, driver, fileReader, printer)
+			err := step.ExecuteAndLog(dir, driver, fileReader, printer, testMetadata)
 			require.Error(t, err)
 			ctrl.Finish()
 		})
 	})
 }
 
+// capabilityReporterDriver is a mock driver that implements the optional
+// CapabilityReporter interface.
+type capabilityReporterDriver struct {
+	*MockDriver
+	*MockCapabilityReporter
+}
+
+func TestDriverWarnings(t *testing.T) {
+	const dir = "my/dir"
+	steps := []*Step{
+		newTestStep("1.fw.sql"),
+		newTestStep("1.bw.nt.sql"),
+		newTestStep("2.fw.sql"),
+	}
+
+	newDriver := func(ctrl *gomock.Controller, caps DriverCapabilities) Driver {
+		cr := NewMockCapabilityReporter(ctrl)
+		cr.EXPECT().Capabilities().Return(caps)
+		return capabilityReporterDriver{NewMockDriver(ctrl), cr}
+	}
+
+	t.Run("driver without capabilities", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		warnings := driverWarnings("my_driver", NewMockDriver(ctrl), steps, dir, NewMockFileReader(ctrl))
+		assert.Empty(t, warnings)
+		ctrl.Finish()
+	})
+
+	t.Run("driver that supports everything", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver := newDriver(ctrl, DriverCapabilities{
+			TransactionalDDL:   true,
+			MultiStatementExec: true,
+			AdvisoryLocking:    true,
+		})
+		warnings := driverWarnings("my_driver", driver, steps, dir, NewMockFileReader(ctrl))
+		assert.Empty(t, warnings)
+		ctrl.Finish()
+	})
+
+	t.Run("no transactional DDL", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver := newDriver(ctrl, DriverCapabilities{MultiStatementExec: true})
+		warnings := driverWarnings("my_driver", driver, steps, dir, NewMockFileReader(ctrl))
+		assert.Equal(t, []string{
+			"Warning: the my_driver driver doesn't support transactional DDL. " +
+				"The following steps don't have the notx filename suffix but they are executed without transactions " +
+				"and they aren't rolled back on error: 1.fw.sql, 2.fw.sql",
+		}, warnings)
+		ctrl.Finish()
+	})
+
+	t.Run("no transactional DDL with notx steps", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver := newDriver(ctrl, DriverCapabilities{MultiStatementExec: true})
+		warnings := driverWarnings("my_driver", driver, steps[1:2], dir, NewMockFileReader(ctrl))
+		assert.Empty(t, warnings)
+		ctrl.Finish()
+	})
+
+	t.Run("no multi-statement exec", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver := newDriver(ctrl, DriverCapabilities{TransactionalDDL: true})
+		fileReader := NewMockFileReader(ctrl)
+		gomock.InOrder(
+			fileReader.EXPECT().ReadFile(filepath.Join(dir, "1.fw.sql")).Return([]byte("SELECT ';';\n-- comment;\n"), nil),
+			fileReader.EXPECT().ReadFile(filepath.Join(dir, "1.bw.nt.sql")).Return([]byte("SELECT 1; SELECT 2;"), nil),
+			fileReader.EXPECT().ReadFile(filepath.Join(dir, "2.fw.sql")).Return(nil, assert.AnError),
+		)
+		warnings := driverWarnings("my_driver", driver, steps, dir, fileReader)
+		assert.Equal(t, []string{
+			"Warning: the my_driver driver may not be able to execute multiple statements in one step. " +
+				"The following steps contain multiple statements: 1.bw.nt.sql",
+		}, warnings)
+		ctrl.Finish()
+	})
+}
+
 func TestInterruptDetector(t *testing.T) {
 	newDetector := func(t *testing.T) (_ *gomock.Controller, _ *MockExiter, _ *MockPrinter, _ *interruptDetector, cancel func(), ch chan<- os.Signal) {
 		ctrl := gomock.NewController(t)
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// driverStateMarker returns the StateMarker of the driver. It exits with an
+// error if the driver doesn't support marking migrations.
+func driverStateMarker(driverName string, d Driver) StateMarker {
+	sm, ok := d.(StateMarker)
+	if !ok {
+		log.Printf("The %s driver doesn't support marking migrations without executing them.", driverName)
+		os.Exit(1)
+	}
+	return sm
+}
+
+// markTargetStep returns the step that marks the target migration as applied
+// (forward direction) or unapplied (backward direction). The target can be
+// anything accepted by Migrations.Names. Marking a migration unapplied
+// doesn't require a backward step: the target can even be the name of a
+// migrations table entry without migration files.
+func markTargetStep(target string, ms *Migrations, forwardMigrated map[string]struct{}, direction Direction) (*Step, error) {
+	idx, ok := ms.Names[target]
+	if !ok {
+		if _, applied := forwardMigrated[target]; applied && direction == DirectionBackward {
+			return &Step{
+				Filename:       target,
+				MigrationName:  target,
+				ParsedFilename: &ParsedFilename{Direction: DirectionBackward},
+			}, nil
+		}
+		return nil, fmt.Errorf("invalid target migration - %q", target)
+	}
+
+	m := ms.Sorted[idx]
+	_, applied := forwardMigrated[m.Forward.MigrationName]
+	if direction == DirectionForward {
+		if applied {
+			return nil, fmt.Errorf("migration %q has already been forward migrated", m.Forward.Filename)
+		}
+		return m.Forward, nil
+	}
+
+	if !applied {
+		return nil, fmt.Errorf("migration %q hasn't been forward migrated", m.Forward.Filename)
+	}
+	if m.Backward != nil {
+		return m.Backward, nil
+	}
+	parsed := *m.Forward.ParsedFilename
+	parsed.Direction = DirectionBackward
+	return &Step{
+		Filename:       m.Forward.Filename,
+		MigrationName:  m.Forward.MigrationName,
+		ParsedFilename: &parsed,
+	}, nil
+}
+
+// baselineSteps returns the forward steps that mark the migrations up to
+// and including the target applied. It fails if the migrations table isn't
+// empty unless force is true. The target is resolved by resolveTarget.
+func baselineSteps(target string, ms *Migrations, forwardMigrated map[string]struct{}, force bool) ([]*Step, error) {
+	if len(forwardMigrated) != 0 && !force {
+		return nil, fmt.Errorf("the migrations table already has %d entries (use the -force option to mark the unapplied migrations up to the target anyway)", len(forwardMigrated))
+	}
+
+	targetIdx, err := resolveTarget(target, ms, forwardMigrated)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []*Step
+	for _, m := range ms.Sorted[:targetIdx+1] {
+		if _, ok := forwardMigrated[m.Forward.MigrationName]; !ok {
+			steps = append(steps, m.Forward)
+		}
+	}
+	return steps, nil
+}
+
+// confirmSteps prints the steps that will be marked and asks for
+// confirmation.
+func confirmSteps(steps []*Step, r io.Reader, p Printer) bool {
+	p.Print("The following steps will update the migrations table without executing the migration files:\n")
+	for _, st := range steps {
+		p.Print("  " + st.markString() + "\n")
+	}
+	return confirm(r, p, "Continue?")
+}
+
+// confirm asks a yes/no question. The default answer is no.
+func confirm(r io.Reader, p Printer, question string) bool {
+	p.Print(question + " [y/N] ")
+	line, _ := bufio.NewReader(r).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
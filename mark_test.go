@@ -0,0 +1,187 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stateMarkerDriver is a mock driver that implements the optional
+// StateMarker and HistoryRecorder interfaces.
+type stateMarkerDriver struct {
+	*MockDriver
+	*MockStateMarker
+	*MockHistoryRecorder
+}
+
+func TestMarkTargetStep(t *testing.T) {
+	ms, err := loadMigrationsDir("", IDSchemeSequential, ".fw", ".bw", ".nt", ".sql", func(string) []string {
+		return []string{"1.fw.sql", "1.bw.sql", "2_x.fw.sql"}
+	})
+	require.NoError(t, err)
+	forwardMigrated := map[string]struct{}{"0001": {}, "0002_x": {}, "0003_missing": {}}
+
+	t.Run("forward", func(t *testing.T) {
+		st, err := markTargetStep("2", ms, map[string]struct{}{}, DirectionForward)
+		require.NoError(t, err)
+		assert.Equal(t, ms.Sorted[1].Forward, st)
+
+		_, err = markTargetStep("2", ms, forwardMigrated, DirectionForward)
+		assert.EqualError(t, err, `migration "2_x.fw.sql" has already been forward migrated`)
+		_, err = markTargetStep("3", ms, forwardMigrated, DirectionForward)
+		assert.EqualError(t, err, `invalid target migration - "3"`)
+		_, err = markTargetStep("0003_missing", ms, forwardMigrated, DirectionForward)
+		assert.EqualError(t, err, `invalid target migration - "0003_missing"`)
+	})
+
+	t.Run("backward", func(t *testing.T) {
+		st, err := markTargetStep("1", ms, forwardMigrated, DirectionBackward)
+		require.NoError(t, err)
+		assert.Equal(t, ms.Sorted[0].Backward, st)
+
+		// The migration doesn't have a backward step.
+		st, err = markTargetStep("0002_x", ms, forwardMigrated, DirectionBackward)
+		require.NoError(t, err)
+		assert.Equal(t, "2_x.fw.sql", st.Filename)
+		assert.Equal(t, "0002_x", st.MigrationName)
+		assert.Equal(t, DirectionBackward, st.ParsedFilename.Direction)
+		assert.Equal(t, DirectionForward, ms.Sorted[1].Forward.ParsedFilename.Direction)
+
+		// Migrations table entry without migration files.
+		st, err = markTargetStep("0003_missing", ms, forwardMigrated, DirectionBackward)
+		require.NoError(t, err)
+		assert.Equal(t, "0003_missing", st.MigrationName)
+		assert.Equal(t, "mark-unapplied 0003_missing", st.markString())
+
+		_, err = markTargetStep("1", ms, map[string]struct{}{}, DirectionBackward)
+		assert.EqualError(t, err, `migration "1.fw.sql" hasn't been forward migrated`)
+		_, err = markTargetStep("0004", ms, forwardMigrated, DirectionBackward)
+		assert.EqualError(t, err, `invalid target migration - "0004"`)
+	})
+}
+
+func TestConfirm(t *testing.T) {
+	for input, expected := range map[string]bool{
+		"y\n":    true,
+		" YES\n": true,
+		"yes":    true,
+		"n\n":    false,
+		"\n":     false,
+		"":       false,
+		"yep\n":  false,
+	} {
+		ctrl := gomock.NewController(t)
+		printer := NewMockPrinter(ctrl)
+		printer.EXPECT().Print("Continue? [y/N] ")
+		assert.Equal(t, expected, confirm(strings.NewReader(input), printer, "Continue?"), "input=%q", input)
+		ctrl.Finish()
+	}
+}
+
+func TestMarkAndLog(t *testing.T) {
+	const dir = "my/dir"
+	const query = "my sql query"
+
+	newDriver := func(ctrl *gomock.Controller) (*MockStateMarker, *MockHistoryRecorder, Driver) {
+		sm := NewMockStateMarker(ctrl)
+		hr := NewMockHistoryRecorder(ctrl)
+		return sm, hr, stateMarkerDriver{NewMockDriver(ctrl), sm, hr}
+	}
+
+	t.Run("forward", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		sm, hr, driver := newDriver(ctrl)
+		printer := NewMockPrinter(ctrl)
+		fileReader := NewMockFileReader(ctrl)
+		step := newTestStep("1.fw.sql")
+
+		gomock.InOrder(
+			printer.EXPECT().Print("mark-applied 1.fw.sql ... "),
+			fileReader.EXPECT().ReadFile("my/dir/1.fw.sql").Return([]byte(query), nil),
+			sm.EXPECT().MarkStep(step, gomock.Any()).Do(func(st *Step, meta *MigrationMetadata) {
+				assert.Equal(t, checksum([]byte(query)), meta.Checksum)
+				assert.Equal(t, testMetadata.AppliedBy, meta.AppliedBy)
+			}),
+			hr.EXPECT().RecordHistory(gomock.Any()).Do(func(h *HistoryEntry) {
+				assert.Equal(t, "1.fw.sql", h.Filename)
+				assert.Equal(t, historyStatusMarked, h.Status)
+			}),
+			printer.EXPECT().Print("OK\n"),
+		)
+
+		err := step.MarkAndLog(dir, driver, fileReader, printer, testMetadata)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("backward", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		sm, hr, driver := newDriver(ctrl)
+		printer := NewMockPrinter(ctrl)
+		fileReader := NewMockFileReader(ctrl)
+		step := newTestStep("1.bw.sql")
+
+		gomock.InOrder(
+			printer.EXPECT().Print("mark-unapplied 1.bw.sql ... "),
+			sm.EXPECT().MarkStep(step, gomock.Any()).Return(errors.New("test")),
+			hr.EXPECT().RecordHistory(gomock.Any()).Do(func(h *HistoryEntry) {
+				assert.Equal(t, historyStatusFailed, h.Status)
+				assert.Equal(t, "test", h.Error)
+			}),
+			printer.EXPECT().Print("FAILED\n"),
+		)
+
+		err := step.MarkAndLog(dir, driver, fileReader, printer, testMetadata)
+		assert.EqualError(t, err, "test")
+		ctrl.Finish()
+	})
+
+	t.Run("unsupported driver", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		printer := NewMockPrinter(ctrl)
+		fileReader := NewMockFileReader(ctrl)
+		step := newTestStep("1.bw.sql")
+
+		gomock.InOrder(
+			printer.EXPECT().Print("mark-unapplied 1.bw.sql ... "),
+			printer.EXPECT().Print("FAILED\n"),
+		)
+
+		err := step.MarkAndLog(dir, NewMockDriver(ctrl), fileReader, printer, testMetadata)
+		assert.EqualError(t, err, "the driver doesn't support marking migrations without executing them")
+		ctrl.Finish()
+	})
+}
+
+func TestBaselineSteps(t *testing.T) {
+	ms, err := loadMigrationsDir("", IDSchemeSequential, ".fw", ".bw", ".nt", ".sql", func(string) []string {
+		return []string{"1.fw.sql", "2_x.fw.sql", "2_x.bw.sql", "3.fw.sql"}
+	})
+	require.NoError(t, err)
+
+	steps, err := baselineSteps("2", ms, map[string]struct{}{}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []*Step{ms.Sorted[0].Forward, ms.Sorted[1].Forward}, steps)
+
+	steps, err = baselineSteps("latest", ms, map[string]struct{}{}, false)
+	require.NoError(t, err)
+	assert.Len(t, steps, 3)
+
+	_, err = baselineSteps("4", ms, map[string]struct{}{}, false)
+	assert.EqualError(t, err, `invalid target migration - "4"`)
+
+	forwardMigrated := map[string]struct{}{"0002_x": {}}
+	_, err = baselineSteps("3", ms, forwardMigrated, false)
+	assert.EqualError(t, err, "the migrations table already has 1 entries (use the -force option to mark the unapplied migrations up to the target anyway)")
+
+	steps, err = baselineSteps("3", ms, forwardMigrated, true)
+	require.NoError(t, err)
+	assert.Equal(t, []*Step{ms.Sorted[0].Forward, ms.Sorted[2].Forward}, steps)
+}
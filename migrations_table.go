@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// migrationsTableVersion is the latest version of the schema of the
+// migrations table. Version 1 has the "name" and "time" columns created by
+// CreateMigrationsTable. Version 2 adds the metadataColumns.
+//
+// The version of a migrations table is stored in its version table
+// (<migrations_table>_schema_version) that has a row for every upgrade.
+// Migrations tables without version rows have version 1.
+const migrationsTableVersion = 2
+
+// migrationsTableColumn is a column added to the migrations table
+// by an upgrade.
+type migrationsTableColumn struct {
+	Name    string
+	Integer bool
+}
+
+// metadataColumns store the MigrationMetadata of the forward migrated
+// migrations. They are added by version 2 of the migrations table.
+var metadataColumns = []migrationsTableColumn{
+	{Name: "checksum"},
+	{Name: "duration_ms", Integer: true},
+	{Name: "sql_migrate_version"},
+	{Name: "os_user"},
+	{Name: "hostname"},
+	{Name: "applied_by"},
+}
+
+// MigrationMetadata is stored in the migrations table along with the name
+// of a migration when it is forward migrated.
+type MigrationMetadata struct {
+	// Checksum is the hex encoded SHA-256 checksum of the executed step.
+	Checksum string
+	// StartTime is the start of the execution of the step. The drivers store
+	// the duration of the execution in milliseconds.
+	StartTime time.Time
+	// Version is the version of sql-migrate.
+	Version   string
+	OSUser    string
+	Hostname  string
+	AppliedBy string
+}
+
+// newMigrationMetadata returns the metadata that is the same for all steps
+// executed by this process.
+func newMigrationMetadata(appliedBy string) *MigrationMetadata {
+	hostname, _ := os.Hostname()
+	return &MigrationMetadata{
+		Version:   versionString(),
+		OSUser:    osUser(),
+		Hostname:  hostname,
+		AppliedBy: appliedBy,
+	}
+}
+
+func osUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if s := os.Getenv("USER"); s != "" {
+		return s
+	}
+	return os.Getenv("USERNAME")
+}
+
+// forStep returns a copy of the metadata for the execution of a step that
+// starts now.
+func (o *MigrationMetadata) forStep(contents []byte) *MigrationMetadata {
+	meta := *o
+	meta.Checksum = checksum(contents)
+	meta.StartTime = time.Now()
+	return &meta
+}
+
+// DurationMS returns the milliseconds elapsed since StartTime.
+func (o *MigrationMetadata) DurationMS() int64 {
+	return int64(time.Since(o.StartTime) / time.Millisecond)
+}
+
+// Values returns the values of the metadataColumns.
+func (o *MigrationMetadata) Values() []interface{} {
+	return []interface{}{o.Checksum, o.DurationMS(), o.Version, o.OSUser, o.Hostname, o.AppliedBy}
+}
+
+func checksum(contents []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(contents))
+}
+
+// insertMigrationQuery returns an INSERT statement for the migrations table
+// that sets the name (first parameter) and the metadataColumns.
+func insertMigrationQuery(tableName string, quote func(string) string, placeholder func(n int) string) string {
+	columns := []string{quote("name")}
+	params := []string{placeholder(1)}
+	for i, c := range metadataColumns {
+		columns = append(columns, quote(c.Name))
+		params = append(params, placeholder(i+2))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", tableName, strings.Join(columns, ", "), strings.Join(params, ", "))
+}
+
+// insertMigrationArgs returns the parameters of insertMigrationQuery.
+func insertMigrationArgs(migrationName string, meta *MigrationMetadata) []interface{} {
+	return append([]interface{}{migrationName}, meta.Values()...)
+}
+
+// upgradeStatements returns the statements that upgrade the migrations table
+// from version-1 to version.
+func upgradeStatements(version int, addColumn addColumnFunc) []string {
+	var statements []string
+	switch version {
+	case 2:
+		for _, c := range metadataColumns {
+			statements = append(statements, addColumn(c))
+		}
+	}
+	return statements
+}
+
+// addColumnFunc returns an ALTER TABLE statement that adds a column
+// to the migrations table.
+type addColumnFunc func(c migrationsTableColumn) string
+
+// sqlAddColumn returns an addColumnFunc for databases that support the
+// standard ALTER TABLE <table> ADD <column> <type> syntax.
+func sqlAddColumn(tableName string, quote func(string) string, textType, integerType string) addColumnFunc {
+	return func(c migrationsTableColumn) string {
+		typ := textType
+		if c.Integer {
+			typ = integerType
+		}
+		return "ALTER TABLE " + tableName + " ADD " + quote(c.Name) + " " + typ
+	}
+}
+
+// migrationsTableUpgrader implements the UpgradeMigrationsTable method and
+// the ChecksumLoader interface of the drivers that use database/sql.
+type migrationsTableUpgrader struct {
+	db DB
+	// tableName is the quoted name of the migrations table.
+	tableName string
+	// versionTable is the quoted name of the version table.
+	versionTable string
+	// createVersionTable is the statement that creates the version table if
+	// it doesn't exist. The table has an integer "version" primary key column.
+	createVersionTable string
+	addColumn          addColumnFunc
+	placeholder        func(n int) string
+	quote              func(string) string
+	// transactionalDDL is true if an upgrade can be executed in a
+	// transaction.
+	transactionalDDL bool
+}
+
+func (o *migrationsTableUpgrader) UpgradeMigrationsTable() error {
+	if _, err := o.db.Exec(o.createVersionTable); err != nil {
+		return fmt.Errorf("error creating the version table of the migrations table: %s", err)
+	}
+	current, err := o.loadVersion()
+	if err != nil {
+		return err
+	}
+	for v := current + 1; v <= migrationsTableVersion; v++ {
+		if err := o.upgrade(v); err != nil {
+			return fmt.Errorf("error upgrading the migrations table to version %d: %s", v, err)
+		}
+	}
+	return nil
+}
+
+// loadVersion returns the version of the migrations table without modifying
+// the database. The version table is created by UpgradeMigrationsTable so
+// a missing version table means version 1.
+func (o *migrationsTableUpgrader) loadVersion() (int, error) {
+	var version sql.NullInt64
+	query := fmt.Sprintf("SELECT MAX(%s) FROM %s", o.quote("version"), o.versionTable)
+	if _, err := queryRow(o.db, []interface{}{&version}, query); err != nil {
+		// The query fails if the version table doesn't exist. The migrations
+		// table is probed to tell it apart from other errors (e.g.: connection
+		// errors) without database specific catalog queries.
+		if probeErr := probeTable(o.db, o.tableName); probeErr != nil {
+			return 0, fmt.Errorf("error loading the version of the migrations table: %s", err)
+		}
+		return 1, nil
+	}
+	if version.Int64 < 1 {
+		return 1, nil
+	}
+	return int(version.Int64), nil
+}
+
+func (o *migrationsTableUpgrader) GetChecksums() (map[string]string, error) {
+	query := fmt.Sprintf("SELECT %s, %s FROM %s", o.quote("name"), o.quote("checksum"), o.tableName)
+	return loadChecksums(o.db, o.loadVersion, query)
+}
+
+// probeTable returns an error if the table can't be queried (e.g.: it
+// doesn't exist).
+func probeTable(q Querier, tableName string) error {
+	_, err := queryRow(q, nil, "SELECT 1 FROM "+tableName+" WHERE 1=0")
+	return err
+}
+
+// loadChecksums executes a query that returns the names and the checksums
+// of the forward migrated migrations. Migrations tables older than version 2
+// don't have checksums.
+func loadChecksums(q Querier, loadVersion func() (int, error), query string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	version, err := loadVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version < 2 {
+		return checksums, nil
+	}
+
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var sum sql.NullString
+		if err := rows.Scan(&name, &sum); err != nil {
+			return nil, fmt.Errorf("error scanning checksum result set: %s", err)
+		}
+		checksums[name] = sum.String
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row error: %s", err)
+	}
+	return checksums, nil
+}
+
+func (o *migrationsTableUpgrader) upgrade(version int) error {
+	perform := func(e Execer) error {
+		for _, statement := range upgradeStatements(version, o.addColumn) {
+			if _, err := e.Exec(statement); err != nil {
+				return err
+			}
+		}
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", o.versionTable, o.quote("version"), o.placeholder(1))
+		_, err := e.Exec(query, version)
+		return err
+	}
+
+	if !o.transactionalDDL {
+		if err := perform(o.db); err != nil {
+			return fmt.Errorf("%s (the upgrade may have been partially executed: examine the migrations table and fix it manually)", err)
+		}
+		return nil
+	}
+
+	tx, err := o.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := perform(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,164 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMetadata is the metadata passed to the ExecuteStep and
+// SetMigrationState methods of the drivers in the tests.
+var testMetadata = &MigrationMetadata{
+	Checksum:  "checksum",
+	StartTime: time.Now(),
+	Version:   "version",
+	OSUser:    "user",
+	Hostname:  "host",
+	AppliedBy: "applied_by",
+}
+
+// testMetadataArgs returns the expected query arguments of insertMigrationQuery
+// for testMetadata. The duration is matched by gomock.Any.
+func testMetadataArgs(migrationName string) []interface{} {
+	return []interface{}{migrationName, "checksum", gomock.Any(), "version", "user", "host", "applied_by"}
+}
+
+func quoteTestIdentifier(s string) string {
+	return `"` + s + `"`
+}
+
+func TestMigrationMetadata(t *testing.T) {
+	meta := newMigrationMetadata("ci")
+	assert.Equal(t, versionString(), meta.Version)
+	assert.Equal(t, "ci", meta.AppliedBy)
+
+	stepMeta := meta.forStep([]byte("test"))
+	assert.Equal(t, "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", stepMeta.Checksum)
+	assert.False(t, stepMeta.StartTime.IsZero())
+	assert.Empty(t, meta.Checksum, "forStep has to return a copy")
+	assert.True(t, stepMeta.DurationMS() >= 0)
+}
+
+func TestInsertMigrationQuery(t *testing.T) {
+	query := insertMigrationQuery(`"migrations"`, quoteTestIdentifier, postgresPlaceholder)
+	assert.Equal(t, `INSERT INTO "migrations" ("name", "checksum", "duration_ms", "sql_migrate_version", "os_user", "hostname", "applied_by") `+
+		`VALUES ($1, $2, $3, $4, $5, $6, $7)`, query)
+
+	args := insertMigrationArgs("0001", testMetadata)
+	require.Len(t, args, 7)
+	assert.Equal(t, "0001", args[0])
+	assert.Equal(t, "checksum", args[1])
+	assert.Equal(t, "applied_by", args[6])
+}
+
+func TestUpgradeStatements(t *testing.T) {
+	addColumn := sqlAddColumn(`"migrations"`, quoteTestIdentifier, "TEXT", "BIGINT")
+	assert.Equal(t, []string{
+		`ALTER TABLE "migrations" ADD "checksum" TEXT`,
+		`ALTER TABLE "migrations" ADD "duration_ms" BIGINT`,
+		`ALTER TABLE "migrations" ADD "sql_migrate_version" TEXT`,
+		`ALTER TABLE "migrations" ADD "os_user" TEXT`,
+		`ALTER TABLE "migrations" ADD "hostname" TEXT`,
+		`ALTER TABLE "migrations" ADD "applied_by" TEXT`,
+	}, upgradeStatements(2, addColumn))
+	assert.Empty(t, upgradeStatements(migrationsTableVersion+1, addColumn))
+}
+
+func TestMigrationsTableUpgrader(t *testing.T) {
+	const createVersionTable = `CREATE TABLE "migrations_schema_version"`
+
+	newUpgrader := func(ctrl *gomock.Controller) (*migrationsTableUpgrader, *MockDB) {
+		db := NewMockDB(ctrl)
+		return &migrationsTableUpgrader{
+			db:                 db,
+			tableName:          `"migrations"`,
+			versionTable:       `"migrations_schema_version"`,
+			createVersionTable: createVersionTable,
+			addColumn:          sqlAddColumn(`"migrations"`, quoteTestIdentifier, "TEXT", "BIGINT"),
+			placeholder:        postgresPlaceholder,
+			quote:              quoteTestIdentifier,
+		}, db
+	}
+
+	t.Run("create version table error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		upgrader, db := newUpgrader(ctrl)
+
+		db.EXPECT().Exec(createVersionTable).Return(nil, errors.New("test"))
+
+		err := upgrader.UpgradeMigrationsTable()
+		assert.EqualError(t, err, "error creating the version table of the migrations table: test")
+		ctrl.Finish()
+	})
+
+	t.Run("load version error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		upgrader, db := newUpgrader(ctrl)
+
+		// The version table isn't created by the read-only GetChecksums.
+		gomock.InOrder(
+			db.EXPECT().Query(`SELECT MAX("version") FROM "migrations_schema_version"`).Return(nil, errors.New("test")),
+			db.EXPECT().Query(`SELECT 1 FROM "migrations" WHERE 1=0`).Return(nil, errors.New("no connection")),
+		)
+
+		_, err := upgrader.GetChecksums()
+		assert.EqualError(t, err, "error loading the version of the migrations table: test")
+		ctrl.Finish()
+	})
+
+	t.Run("upgrade error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		upgrader, db := newUpgrader(ctrl)
+
+		gomock.InOrder(
+			db.EXPECT().Exec(`ALTER TABLE "migrations" ADD "checksum" TEXT`),
+			db.EXPECT().Exec(`ALTER TABLE "migrations" ADD "duration_ms" BIGINT`).Return(nil, errors.New("test")),
+		)
+
+		err := upgrader.upgrade(2)
+		assert.EqualError(t, err, "test (the upgrade may have been partially executed: examine the migrations table and fix it manually)")
+		ctrl.Finish()
+	})
+
+	t.Run("transactional upgrade", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		upgrader, db := newUpgrader(ctrl)
+		upgrader.transactionalDDL = true
+		tx := NewMockTX(ctrl)
+
+		gomock.InOrder(
+			db.EXPECT().Begin().Return(tx, nil),
+			tx.EXPECT().Exec(gomock.Any()).Times(len(metadataColumns)),
+			tx.EXPECT().Exec(`INSERT INTO "migrations_schema_version" ("version") VALUES ($1)`, 2),
+			tx.EXPECT().Commit(),
+		)
+
+		err := upgrader.upgrade(2)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("transactional upgrade error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		upgrader, db := newUpgrader(ctrl)
+		upgrader.transactionalDDL = true
+		tx := NewMockTX(ctrl)
+
+		gomock.InOrder(
+			db.EXPECT().Begin().Return(tx, nil),
+			tx.EXPECT().Exec(gomock.Any()).Return(nil, errors.New("test")),
+			tx.EXPECT().Rollback(),
+		)
+
+		err := upgrader.upgrade(2)
+		assert.EqualError(t, err, "test")
+		ctrl.Finish()
+	})
+}
@@ -34,15 +34,15 @@ func (m *MockDriver) EXPECT() *MockDriverMockRecorder {
 }
 
 // ExecuteStep mocks base method
-func (m *MockDriver) ExecuteStep(st *Step, contents string) error {
-	ret := m.ctrl.Call(m, "ExecuteStep", st, contents)
+func (m *MockDriver) ExecuteStep(st *Step, contents string, meta *MigrationMetadata) error {
+	ret := m.ctrl.Call(m, "ExecuteStep", st, contents, meta)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // ExecuteStep indicates an expected call of ExecuteStep
-func (mr *MockDriverMockRecorder) ExecuteStep(st, contents interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteStep", reflect.TypeOf((*MockDriver)(nil).ExecuteStep), st, contents)
+func (mr *MockDriverMockRecorder) ExecuteStep(st, contents, meta interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecuteStep", reflect.TypeOf((*MockDriver)(nil).ExecuteStep), st, contents, meta)
 }
 
 // CreateMigrationsTable mocks base method
@@ -57,6 +57,18 @@ func (mr *MockDriverMockRecorder) CreateMigrationsTable() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMigrationsTable", reflect.TypeOf((*MockDriver)(nil).CreateMigrationsTable))
 }
 
+// UpgradeMigrationsTable mocks base method
+func (m *MockDriver) UpgradeMigrationsTable() error {
+	ret := m.ctrl.Call(m, "UpgradeMigrationsTable")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpgradeMigrationsTable indicates an expected call of UpgradeMigrationsTable
+func (mr *MockDriverMockRecorder) UpgradeMigrationsTable() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpgradeMigrationsTable", reflect.TypeOf((*MockDriver)(nil).UpgradeMigrationsTable))
+}
+
 // GetForwardMigratedNames mocks base method
 func (m *MockDriver) GetForwardMigratedNames() (map[string]struct{}, error) {
 	ret := m.ctrl.Call(m, "GetForwardMigratedNames")
@@ -80,6 +92,245 @@ func (mr *MockDriverMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockDriver)(nil).Close))
 }
 
+// MockCapabilityReporter is a mock of CapabilityReporter interface
+type MockCapabilityReporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockCapabilityReporterMockRecorder
+}
+
+// MockCapabilityReporterMockRecorder is the mock recorder for MockCapabilityReporter
+type MockCapabilityReporterMockRecorder struct {
+	mock *MockCapabilityReporter
+}
+
+// NewMockCapabilityReporter creates a new mock instance
+func NewMockCapabilityReporter(ctrl *gomock.Controller) *MockCapabilityReporter {
+	mock := &MockCapabilityReporter{ctrl: ctrl}
+	mock.recorder = &MockCapabilityReporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCapabilityReporter) EXPECT() *MockCapabilityReporterMockRecorder {
+	return m.recorder
+}
+
+// Capabilities mocks base method
+func (m *MockCapabilityReporter) Capabilities() DriverCapabilities {
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].(DriverCapabilities)
+	return ret0
+}
+
+// Capabilities indicates an expected call of Capabilities
+func (mr *MockCapabilityReporterMockRecorder) Capabilities() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockCapabilityReporter)(nil).Capabilities))
+}
+
+// MockLocker is a mock of Locker interface
+type MockLocker struct {
+	ctrl     *gomock.Controller
+	recorder *MockLockerMockRecorder
+}
+
+// MockLockerMockRecorder is the mock recorder for MockLocker
+type MockLockerMockRecorder struct {
+	mock *MockLocker
+}
+
+// NewMockLocker creates a new mock instance
+func NewMockLocker(ctrl *gomock.Controller) *MockLocker {
+	mock := &MockLocker{ctrl: ctrl}
+	mock.recorder = &MockLockerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockLocker) EXPECT() *MockLockerMockRecorder {
+	return m.recorder
+}
+
+// TryLock mocks base method
+func (m *MockLocker) TryLock() (bool, error) {
+	ret := m.ctrl.Call(m, "TryLock")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TryLock indicates an expected call of TryLock
+func (mr *MockLockerMockRecorder) TryLock() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryLock", reflect.TypeOf((*MockLocker)(nil).TryLock))
+}
+
+// Unlock mocks base method
+func (m *MockLocker) Unlock() error {
+	ret := m.ctrl.Call(m, "Unlock")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unlock indicates an expected call of Unlock
+func (mr *MockLockerMockRecorder) Unlock() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockLocker)(nil).Unlock))
+}
+
+// LockStatus mocks base method
+func (m *MockLocker) LockStatus() (string, error) {
+	ret := m.ctrl.Call(m, "LockStatus")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LockStatus indicates an expected call of LockStatus
+func (mr *MockLockerMockRecorder) LockStatus() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockStatus", reflect.TypeOf((*MockLocker)(nil).LockStatus))
+}
+
+// ForceUnlock mocks base method
+func (m *MockLocker) ForceUnlock() error {
+	ret := m.ctrl.Call(m, "ForceUnlock")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForceUnlock indicates an expected call of ForceUnlock
+func (mr *MockLockerMockRecorder) ForceUnlock() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceUnlock", reflect.TypeOf((*MockLocker)(nil).ForceUnlock))
+}
+
+// MockChecksumLoader is a mock of ChecksumLoader interface
+type MockChecksumLoader struct {
+	ctrl     *gomock.Controller
+	recorder *MockChecksumLoaderMockRecorder
+}
+
+// MockChecksumLoaderMockRecorder is the mock recorder for MockChecksumLoader
+type MockChecksumLoaderMockRecorder struct {
+	mock *MockChecksumLoader
+}
+
+// NewMockChecksumLoader creates a new mock instance
+func NewMockChecksumLoader(ctrl *gomock.Controller) *MockChecksumLoader {
+	mock := &MockChecksumLoader{ctrl: ctrl}
+	mock.recorder = &MockChecksumLoaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockChecksumLoader) EXPECT() *MockChecksumLoaderMockRecorder {
+	return m.recorder
+}
+
+// GetChecksums mocks base method
+func (m *MockChecksumLoader) GetChecksums() (map[string]string, error) {
+	ret := m.ctrl.Call(m, "GetChecksums")
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChecksums indicates an expected call of GetChecksums
+func (mr *MockChecksumLoaderMockRecorder) GetChecksums() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChecksums", reflect.TypeOf((*MockChecksumLoader)(nil).GetChecksums))
+}
+
+// MockHistoryRecorder is a mock of HistoryRecorder interface
+type MockHistoryRecorder struct {
+	ctrl     *gomock.Controller
+	recorder *MockHistoryRecorderMockRecorder
+}
+
+// MockHistoryRecorderMockRecorder is the mock recorder for MockHistoryRecorder
+type MockHistoryRecorderMockRecorder struct {
+	mock *MockHistoryRecorder
+}
+
+// NewMockHistoryRecorder creates a new mock instance
+func NewMockHistoryRecorder(ctrl *gomock.Controller) *MockHistoryRecorder {
+	mock := &MockHistoryRecorder{ctrl: ctrl}
+	mock.recorder = &MockHistoryRecorderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockHistoryRecorder) EXPECT() *MockHistoryRecorderMockRecorder {
+	return m.recorder
+}
+
+// CreateHistoryTable mocks base method
+func (m *MockHistoryRecorder) CreateHistoryTable() error {
+	ret := m.ctrl.Call(m, "CreateHistoryTable")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateHistoryTable indicates an expected call of CreateHistoryTable
+func (mr *MockHistoryRecorderMockRecorder) CreateHistoryTable() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateHistoryTable", reflect.TypeOf((*MockHistoryRecorder)(nil).CreateHistoryTable))
+}
+
+// RecordHistory mocks base method
+func (m *MockHistoryRecorder) RecordHistory(h *HistoryEntry) error {
+	ret := m.ctrl.Call(m, "RecordHistory", h)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordHistory indicates an expected call of RecordHistory
+func (mr *MockHistoryRecorderMockRecorder) RecordHistory(h interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordHistory", reflect.TypeOf((*MockHistoryRecorder)(nil).RecordHistory), h)
+}
+
+// LoadHistory mocks base method
+func (m *MockHistoryRecorder) LoadHistory() ([]*HistoryEntry, error) {
+	ret := m.ctrl.Call(m, "LoadHistory")
+	ret0, _ := ret[0].([]*HistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoadHistory indicates an expected call of LoadHistory
+func (mr *MockHistoryRecorderMockRecorder) LoadHistory() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadHistory", reflect.TypeOf((*MockHistoryRecorder)(nil).LoadHistory))
+}
+
+// MockStateMarker is a mock of StateMarker interface
+type MockStateMarker struct {
+	ctrl     *gomock.Controller
+	recorder *MockStateMarkerMockRecorder
+}
+
+// MockStateMarkerMockRecorder is the mock recorder for MockStateMarker
+type MockStateMarkerMockRecorder struct {
+	mock *MockStateMarker
+}
+
+// NewMockStateMarker creates a new mock instance
+func NewMockStateMarker(ctrl *gomock.Controller) *MockStateMarker {
+	mock := &MockStateMarker{ctrl: ctrl}
+	mock.recorder = &MockStateMarkerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockStateMarker) EXPECT() *MockStateMarkerMockRecorder {
+	return m.recorder
+}
+
+// MarkStep mocks base method
+func (m *MockStateMarker) MarkStep(st *Step, meta *MigrationMetadata) error {
+	ret := m.ctrl.Call(m, "MarkStep", st, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkStep indicates an expected call of MarkStep
+func (mr *MockStateMarkerMockRecorder) MarkStep(st, meta interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkStep", reflect.TypeOf((*MockStateMarker)(nil).MarkStep), st, meta)
+}
+
 // MockDB is a mock of DB interface
 type MockDB struct {
 	ctrl     *gomock.Controller
@@ -311,6 +562,122 @@ func (mr *MockQuerierMockRecorder) Query(query interface{}, args ...interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockQuerier)(nil).Query), varargs...)
 }
 
+// MockCQLSession is a mock of CQLSession interface
+type MockCQLSession struct {
+	ctrl     *gomock.Controller
+	recorder *MockCQLSessionMockRecorder
+}
+
+// MockCQLSessionMockRecorder is the mock recorder for MockCQLSession
+type MockCQLSessionMockRecorder struct {
+	mock *MockCQLSession
+}
+
+// NewMockCQLSession creates a new mock instance
+func NewMockCQLSession(ctrl *gomock.Controller) *MockCQLSession {
+	mock := &MockCQLSession{ctrl: ctrl}
+	mock.recorder = &MockCQLSessionMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCQLSession) EXPECT() *MockCQLSessionMockRecorder {
+	return m.recorder
+}
+
+// Exec mocks base method
+func (m *MockCQLSession) Exec(stmt string, values ...interface{}) error {
+	varargs := []interface{}{stmt}
+	for _, a := range values {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Exec", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Exec indicates an expected call of Exec
+func (mr *MockCQLSessionMockRecorder) Exec(stmt interface{}, values ...interface{}) *gomock.Call {
+	varargs := append([]interface{}{stmt}, values...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exec", reflect.TypeOf((*MockCQLSession)(nil).Exec), varargs...)
+}
+
+// ExecCAS mocks base method
+func (m *MockCQLSession) ExecCAS(stmt string, values ...interface{}) (bool, error) {
+	varargs := []interface{}{stmt}
+	for _, a := range values {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ExecCAS", varargs...)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExecCAS indicates an expected call of ExecCAS
+func (mr *MockCQLSessionMockRecorder) ExecCAS(stmt interface{}, values ...interface{}) *gomock.Call {
+	varargs := append([]interface{}{stmt}, values...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExecCAS", reflect.TypeOf((*MockCQLSession)(nil).ExecCAS), varargs...)
+}
+
+// QueryStrings mocks base method
+func (m *MockCQLSession) QueryStrings(stmt string, values ...interface{}) ([]string, error) {
+	varargs := []interface{}{stmt}
+	for _, a := range values {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryStrings", varargs...)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryStrings indicates an expected call of QueryStrings
+func (mr *MockCQLSessionMockRecorder) QueryStrings(stmt interface{}, values ...interface{}) *gomock.Call {
+	varargs := append([]interface{}{stmt}, values...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryStrings", reflect.TypeOf((*MockCQLSession)(nil).QueryStrings), varargs...)
+}
+
+// QueryStringRows mocks base method
+func (m *MockCQLSession) QueryStringRows(stmt string, values ...interface{}) ([][]string, error) {
+	varargs := []interface{}{stmt}
+	for _, a := range values {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "QueryStringRows", varargs...)
+	ret0, _ := ret[0].([][]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryStringRows indicates an expected call of QueryStringRows
+func (mr *MockCQLSessionMockRecorder) QueryStringRows(stmt interface{}, values ...interface{}) *gomock.Call {
+	varargs := append([]interface{}{stmt}, values...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryStringRows", reflect.TypeOf((*MockCQLSession)(nil).QueryStringRows), varargs...)
+}
+
+// AwaitSchemaAgreement mocks base method
+func (m *MockCQLSession) AwaitSchemaAgreement() error {
+	ret := m.ctrl.Call(m, "AwaitSchemaAgreement")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AwaitSchemaAgreement indicates an expected call of AwaitSchemaAgreement
+func (mr *MockCQLSessionMockRecorder) AwaitSchemaAgreement() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AwaitSchemaAgreement", reflect.TypeOf((*MockCQLSession)(nil).AwaitSchemaAgreement))
+}
+
+// Close mocks base method
+func (m *MockCQLSession) Close() {
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close
+func (mr *MockCQLSessionMockRecorder) Close() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockCQLSession)(nil).Close))
+}
+
 // MockPrinter is a mock of Printer interface
 type MockPrinter struct {
 	ctrl     *gomock.Controller
@@ -0,0 +1,219 @@
+// Package plugin implements the protocol used by sql-migrate to communicate
+// with external driver plugins. It can be used to implement driver plugins
+// in Go but plugins can be implemented in any language.
+//
+// A plugin is an executable that is started by sql-migrate when the -driver
+// option is set to "exec:<path_to_plugin>". sql-migrate sends requests to the
+// stdin of the plugin and the plugin sends responses to its stdout. Every
+// request and response is a JSON object in a single line terminated by '\n'.
+// The plugin can log to its stderr that is forwarded to the stderr of
+// sql-migrate.
+//
+// sql-migrate sends a request and waits for its response before sending the
+// next request. The ID of a response has to be the ID of the request.
+// A response has either a result or a non-empty error.
+//
+// The first request is always a handshake that contains the protocol versions
+// supported by sql-migrate and the driver parameters (DSN and migrations
+// table name). The plugin has to respond with the protocol version chosen from
+// the offered versions (usually the highest one it supports) or with an error
+// if it doesn't support any of them. The handshake result lists the optional
+// features of the plugin.
+//
+// The remaining methods mirror the Driver interface of sql-migrate and its
+// optional interfaces. The methods of the optional features are sent only
+// to the plugins that have listed the feature in the handshake result.
+// The last request is a close request. After responding to it the plugin
+// has to exit. The plugin has to exit also when its stdin is closed.
+//
+// Version 2 of the protocol added the upgrade_migrations_table,
+// get_checksums and mark_step methods and the optional history and locking
+// features. sql-migrate doesn't offer version 1 so the plugins that support
+// only version 1 fail the handshake.
+package plugin
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// MinProtocolVersion is the oldest supported protocol version.
+	MinProtocolVersion = 2
+	// ProtocolVersion is the latest supported protocol version.
+	ProtocolVersion = 2
+)
+
+// Request methods.
+const (
+	MethodHandshake               = "handshake"
+	MethodExecuteStep             = "execute_step"
+	MethodCreateMigrationsTable   = "create_migrations_table"
+	MethodUpgradeMigrationsTable  = "upgrade_migrations_table"
+	MethodGetForwardMigratedNames = "get_forward_migrated_names"
+	MethodGetChecksums            = "get_checksums"
+	MethodMarkStep                = "mark_step"
+	MethodClose                   = "close"
+
+	// The methods of FeatureHistory.
+	MethodCreateHistoryTable = "create_history_table"
+	MethodRecordHistory      = "record_history"
+	MethodLoadHistory        = "load_history"
+
+	// The methods of FeatureLocking.
+	MethodTryLock     = "try_lock"
+	MethodUnlock      = "unlock"
+	MethodLockStatus  = "lock_status"
+	MethodForceUnlock = "force_unlock"
+)
+
+// Optional features listed in HandshakeResult.
+const (
+	// FeatureHistory means that the plugin records the executed migration
+	// steps in a history table.
+	FeatureHistory = "history"
+	// FeatureLocking means that the plugin implements the migration lock
+	// held by the commands that execute migration steps.
+	FeatureLocking = "locking"
+)
+
+// Directions used in ExecuteStepParams.
+const (
+	DirectionForward  = "forward"
+	DirectionBackward = "backward"
+)
+
+// Request is sent by sql-migrate to the plugin.
+type Request struct {
+	ID     int64           `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is sent by the plugin to sql-migrate.
+type Response struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// HandshakeParams are the params of the handshake request.
+type HandshakeParams struct {
+	ProtocolVersions []int  `json:"protocol_versions"`
+	DSN              string `json:"dsn"`
+	MigrationsTable  string `json:"migrations_table"`
+}
+
+// HandshakeResult is the result of the handshake request.
+type HandshakeResult struct {
+	ProtocolVersion int `json:"protocol_version"`
+	// Capabilities is optional. sql-migrate assumes that the plugin supports
+	// transactional DDL and multi-statement steps when it is omitted.
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+	// Features are the optional features (FeatureHistory, FeatureLocking)
+	// supported by the plugin.
+	Features []string `json:"features,omitempty"`
+}
+
+// Capabilities describes the features of the plugin that can't be taken for
+// granted. sql-migrate uses them to warn about the features used by the
+// migrations that are ignored by the plugin.
+type Capabilities struct {
+	// TransactionalDDL is true if the migration steps are executed in
+	// transactions unless NoTx is set.
+	TransactionalDDL bool `json:"transactional_ddl"`
+	// MultiStatementExec is true if a migration step can contain multiple
+	// statements.
+	MultiStatementExec bool `json:"multi_statement_exec"`
+	// AdvisoryLocking is true if the migration lock is an advisory lock that
+	// is released automatically when its holder dies.
+	AdvisoryLocking bool `json:"advisory_locking"`
+}
+
+// ExecuteStepParams are the params of the execute_step request.
+// The plugin has to execute the contents of the migration step and it has
+// to update the migration state: forward steps mark the migration as forward
+// migrated and backward steps remove this mark.
+type ExecuteStepParams struct {
+	MigrationName string `json:"migration_name"`
+	Filename      string `json:"filename"`
+	Direction     string `json:"direction"`
+	NoTx          bool   `json:"no_tx"`
+	Contents      string `json:"contents"`
+	// Metadata is optional. Plugins that store metadata in their migrations
+	// table can store it along with forward migrated migrations.
+	Metadata *Metadata `json:"metadata,omitempty"`
+}
+
+// Metadata describes the execution of a migration step. The plugin has to
+// measure the execution time of the step if it stores its duration.
+type Metadata struct {
+	// Checksum is the hex encoded SHA-256 checksum of the step contents.
+	Checksum          string `json:"checksum"`
+	SQLMigrateVersion string `json:"sql_migrate_version"`
+	OSUser            string `json:"os_user"`
+	Hostname          string `json:"hostname"`
+	// AppliedBy is the value of the -applied_by option.
+	AppliedBy string `json:"applied_by"`
+}
+
+// GetForwardMigratedNamesResult is the result of the
+// get_forward_migrated_names request.
+type GetForwardMigratedNamesResult struct {
+	Names []string `json:"names"`
+}
+
+// GetChecksumsResult is the result of the get_checksums request. It contains
+// the checksums of the forward migrated migrations keyed by migration name.
+// Plugins that don't store checksums return an empty map and sql-migrate
+// doesn't detect modified migrations.
+type GetChecksumsResult struct {
+	Checksums map[string]string `json:"checksums"`
+}
+
+// MarkStepParams are the params of the mark_step request. The plugin has to
+// update the migration state as if the step had been executed.
+type MarkStepParams struct {
+	MigrationName string    `json:"migration_name"`
+	Filename      string    `json:"filename"`
+	Direction     string    `json:"direction"`
+	Metadata      *Metadata `json:"metadata,omitempty"`
+}
+
+// HistoryEntry is a row of the history table. It is the params of the
+// record_history request.
+type HistoryEntry struct {
+	ID            string `json:"id"`
+	MigrationName string `json:"migration_name"`
+	Filename      string `json:"filename"`
+	Direction     string `json:"direction"`
+	// Status is "succeeded", "failed" or "marked".
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Error     string    `json:"error"`
+	OSUser    string    `json:"os_user"`
+	Hostname  string    `json:"hostname"`
+	AppliedBy string    `json:"applied_by"`
+}
+
+// LoadHistoryResult is the result of the load_history request. The entries
+// are in chronological order. TableExists is false if the history table
+// hasn't been created.
+type LoadHistoryResult struct {
+	TableExists bool            `json:"table_exists"`
+	Entries     []*HistoryEntry `json:"entries"`
+}
+
+// TryLockResult is the result of the try_lock request. Acquired is false if
+// the lock is held by someone else.
+type TryLockResult struct {
+	Acquired bool `json:"acquired"`
+}
+
+// LockStatusResult is the result of the lock_status request. Holder is the
+// description of the holder of the lock or an empty string if the lock isn't
+// held.
+type LockStatusResult struct {
+	Holder string `json:"holder"`
+}
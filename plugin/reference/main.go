@@ -0,0 +1,297 @@
+// The reference driver plugin is used by the tests of sql-migrate and it
+// serves as an example for plugin authors.
+//
+// It stores its "database" in a JSON file. The DSN is the path of the file.
+// Executing a migration step appends the contents of the step to the log
+// stored in the file. The migrations table is a list of migration names
+// in the same file. The migration lock is a lock file next to the database
+// file.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pasztorpisti/sql-migrate/plugin"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("reference plugin: ")
+	if err := plugin.Serve(os.Stdin, os.Stdout, open); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func open(p *plugin.HandshakeParams) (plugin.Driver, error) {
+	if p.DSN == "" {
+		return nil, fmt.Errorf("the DSN has to be the path of the database file")
+	}
+	return &driver{
+		path:      p.DSN,
+		tableName: p.MigrationsTable,
+	}, nil
+}
+
+type database struct {
+	Tables map[string][]string `json:"tables"`
+	// Checksums contains the checksums of the forward migrated migrations
+	// keyed by table name and migration name.
+	Checksums map[string]map[string]string `json:"checksums"`
+	// History contains the history tables keyed by table name.
+	History map[string][]*plugin.HistoryEntry `json:"history"`
+	Log     []string                          `json:"log"`
+}
+
+type driver struct {
+	path      string
+	tableName string
+	lockOwner string
+}
+
+func (o *driver) Capabilities() plugin.Capabilities {
+	// ExecuteStep updates the database file atomically. The lock file isn't
+	// removed automatically if its holder dies.
+	return plugin.Capabilities{
+		TransactionalDDL:   true,
+		MultiStatementExec: true,
+		AdvisoryLocking:    false,
+	}
+}
+
+func (o *driver) ExecuteStep(p *plugin.ExecuteStepParams) error {
+	return o.update(func(db *database) error {
+		if err := o.setState(db, p.MigrationName, p.Direction, p.Metadata); err != nil {
+			return err
+		}
+		db.Log = append(db.Log, p.Contents)
+		return nil
+	})
+}
+
+func (o *driver) MarkStep(p *plugin.MarkStepParams) error {
+	return o.update(func(db *database) error {
+		return o.setState(db, p.MigrationName, p.Direction, p.Metadata)
+	})
+}
+
+// setState updates the migrations table. It fails if the migration is
+// already in the requested state.
+func (o *driver) setState(db *database, migrationName, direction string, meta *plugin.Metadata) error {
+	names, ok := db.Tables[o.tableName]
+	if !ok {
+		return fmt.Errorf("table %q doesn't exist", o.tableName)
+	}
+	idx := sort.SearchStrings(names, migrationName)
+	applied := idx < len(names) && names[idx] == migrationName
+	if applied == (direction == plugin.DirectionForward) {
+		return fmt.Errorf("error setting state for migration %q in the migrations table", migrationName)
+	}
+
+	checksums := db.Checksums[o.tableName]
+	if checksums == nil {
+		checksums = make(map[string]string)
+		db.Checksums[o.tableName] = checksums
+	}
+	if applied {
+		names = append(names[:idx], names[idx+1:]...)
+		delete(checksums, migrationName)
+	} else {
+		names = append(names, migrationName)
+		sort.Strings(names)
+		if meta != nil {
+			checksums[migrationName] = meta.Checksum
+		}
+	}
+	db.Tables[o.tableName] = names
+	return nil
+}
+
+func (o *driver) CreateMigrationsTable() error {
+	return o.update(func(db *database) error {
+		if _, ok := db.Tables[o.tableName]; !ok {
+			db.Tables[o.tableName] = []string{}
+		}
+		return nil
+	})
+}
+
+// UpgradeMigrationsTable is a no-op because the schema of the migrations
+// table hasn't changed.
+func (o *driver) UpgradeMigrationsTable() error {
+	return nil
+}
+
+func (o *driver) GetForwardMigratedNames() ([]string, error) {
+	db, err := o.load()
+	if err != nil {
+		return nil, err
+	}
+	names, ok := db.Tables[o.tableName]
+	if !ok {
+		return nil, fmt.Errorf("table %q doesn't exist", o.tableName)
+	}
+	return names, nil
+}
+
+func (o *driver) GetChecksums() (map[string]string, error) {
+	db, err := o.load()
+	if err != nil {
+		return nil, err
+	}
+	return db.Checksums[o.tableName], nil
+}
+
+func (o *driver) historyTable() string {
+	return o.tableName + "_history"
+}
+
+func (o *driver) CreateHistoryTable() error {
+	return o.update(func(db *database) error {
+		if _, ok := db.History[o.historyTable()]; !ok {
+			db.History[o.historyTable()] = []*plugin.HistoryEntry{}
+		}
+		return nil
+	})
+}
+
+func (o *driver) RecordHistory(e *plugin.HistoryEntry) error {
+	return o.update(func(db *database) error {
+		entries, ok := db.History[o.historyTable()]
+		if !ok {
+			return fmt.Errorf("table %q doesn't exist", o.historyTable())
+		}
+		db.History[o.historyTable()] = append(entries, e)
+		return nil
+	})
+}
+
+func (o *driver) LoadHistory() ([]*plugin.HistoryEntry, error) {
+	db, err := o.load()
+	if err != nil {
+		return nil, err
+	}
+	entries, ok := db.History[o.historyTable()]
+	if !ok {
+		return nil, plugin.ErrNoHistoryTable
+	}
+	return entries, nil
+}
+
+func (o *driver) lockPath() string {
+	return o.path + "." + o.tableName + ".lock"
+}
+
+// TryLock creates the lock file exclusively and writes the description of
+// the holder into it.
+func (o *driver) TryLock() (bool, error) {
+	f, err := os.OpenFile(o.lockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s (pid %d) since %s", hostname, os.Getpid(), time.Now().UTC().Format(time.RFC3339))
+	if _, err := f.WriteString(owner); err != nil {
+		f.Close()
+		os.Remove(o.lockPath())
+		return false, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(o.lockPath())
+		return false, err
+	}
+	o.lockOwner = owner
+	return true, nil
+}
+
+func (o *driver) Unlock() error {
+	holder, err := o.LockStatus()
+	if err != nil {
+		return err
+	}
+	if holder != o.lockOwner {
+		return fmt.Errorf("the migration lock of %s has been released by someone else", o.lockOwner)
+	}
+	return os.Remove(o.lockPath())
+}
+
+func (o *driver) LockStatus() (string, error) {
+	b, err := ioutil.ReadFile(o.lockPath())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(b), err
+}
+
+func (o *driver) ForceUnlock() error {
+	if err := os.Remove(o.lockPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (o *driver) Close() error {
+	return nil
+}
+
+func (o *driver) load() (*database, error) {
+	db := &database{}
+	b, err := ioutil.ReadFile(o.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, db); err != nil {
+			return nil, fmt.Errorf("error decoding database file %q: %s", o.path, err)
+		}
+	}
+	if db.Tables == nil {
+		db.Tables = make(map[string][]string)
+	}
+	if db.Checksums == nil {
+		db.Checksums = make(map[string]map[string]string)
+	}
+	if db.History == nil {
+		db.History = make(map[string][]*plugin.HistoryEntry)
+	}
+	return db, nil
+}
+
+// update saves the modifications of f atomically (all or nothing)
+// like a transaction.
+func (o *driver) update(f func(db *database) error) error {
+	db, err := o.load()
+	if err != nil {
+		return err
+	}
+	if err := f(db); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(o.path), filepath.Base(o.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), o.path)
+}
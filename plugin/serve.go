@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Driver is implemented by the plugins that use Serve.
+type Driver interface {
+	ExecuteStep(p *ExecuteStepParams) error
+	CreateMigrationsTable() error
+	// UpgradeMigrationsTable upgrades an existing migrations table to the
+	// latest schema of the plugin. It is a no-op if the table is up to date.
+	UpgradeMigrationsTable() error
+	GetForwardMigratedNames() ([]string, error)
+	GetChecksums() (map[string]string, error)
+	MarkStep(p *MarkStepParams) error
+	Close() error
+}
+
+// CapabilityReporter is an optional interface of the plugins that use Serve.
+// The capabilities are sent to sql-migrate in the handshake result.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// ErrNoHistoryTable is returned by the LoadHistory method of HistoryRecorder
+// if the history table doesn't exist.
+var ErrNoHistoryTable = errors.New("the history table doesn't exist")
+
+// HistoryRecorder is an optional interface of the plugins that use Serve.
+// Implementing it enables FeatureHistory.
+type HistoryRecorder interface {
+	CreateHistoryTable() error
+	RecordHistory(e *HistoryEntry) error
+	LoadHistory() ([]*HistoryEntry, error)
+}
+
+// Locker is an optional interface of the plugins that use Serve.
+// Implementing it enables FeatureLocking.
+type Locker interface {
+	TryLock() (bool, error)
+	Unlock() error
+	LockStatus() (string, error)
+	ForceUnlock() error
+}
+
+// OpenFunc is called by Serve after a successful handshake.
+type OpenFunc func(p *HandshakeParams) (Driver, error)
+
+// Serve handles the requests received from r and writes the responses to w
+// until it receives a close request or r reaches EOF.
+// Plugins usually call it with os.Stdin and os.Stdout.
+func Serve(r io.Reader, w io.Writer, open OpenFunc) error {
+	br := bufio.NewReader(r)
+	var driver Driver
+	defer func() {
+		if driver != nil {
+			driver.Close()
+		}
+	}()
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		var req Request
+		if err := json.Unmarshal(line, &req); err != nil {
+			return fmt.Errorf("error decoding request: %s", err)
+		}
+
+		var result interface{}
+		var reqErr error
+		switch {
+		case req.Method == MethodHandshake:
+			if driver != nil {
+				reqErr = errors.New("duplicate handshake")
+				break
+			}
+			result, driver, reqErr = handshake(req.Params, open)
+		case driver == nil:
+			reqErr = fmt.Errorf("the first request has to be a handshake instead of %q", req.Method)
+		default:
+			result, reqErr = dispatch(driver, &req)
+		}
+
+		if err := writeResponse(w, req.ID, result, reqErr); err != nil {
+			return err
+		}
+		if req.Method == MethodClose && driver != nil {
+			driver = nil
+			return nil
+		}
+	}
+}
+
+func handshake(params json.RawMessage, open OpenFunc) (*HandshakeResult, Driver, error) {
+	var p HandshakeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, nil, fmt.Errorf("error decoding handshake params: %s", err)
+	}
+	version := 0
+	for _, v := range p.ProtocolVersions {
+		if v >= MinProtocolVersion && v <= ProtocolVersion && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		return nil, nil, fmt.Errorf("none of the offered protocol versions %v are supported - supported versions: %d-%d",
+			p.ProtocolVersions, MinProtocolVersion, ProtocolVersion)
+	}
+	driver, err := open(&p)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &HandshakeResult{ProtocolVersion: version}
+	if cr, ok := driver.(CapabilityReporter); ok {
+		caps := cr.Capabilities()
+		result.Capabilities = &caps
+	}
+	if _, ok := driver.(HistoryRecorder); ok {
+		result.Features = append(result.Features, FeatureHistory)
+	}
+	if _, ok := driver.(Locker); ok {
+		result.Features = append(result.Features, FeatureLocking)
+	}
+	return result, driver, nil
+}
+
+func dispatch(driver Driver, req *Request) (interface{}, error) {
+	switch req.Method {
+	case MethodExecuteStep:
+		var p ExecuteStepParams
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, fmt.Errorf("error decoding %s params: %s", req.Method, err)
+		}
+		return struct{}{}, driver.ExecuteStep(&p)
+	case MethodCreateMigrationsTable:
+		return struct{}{}, driver.CreateMigrationsTable()
+	case MethodUpgradeMigrationsTable:
+		return struct{}{}, driver.UpgradeMigrationsTable()
+	case MethodGetForwardMigratedNames:
+		names, err := driver.GetForwardMigratedNames()
+		if names == nil {
+			names = []string{}
+		}
+		return &GetForwardMigratedNamesResult{Names: names}, err
+	case MethodGetChecksums:
+		checksums, err := driver.GetChecksums()
+		if checksums == nil {
+			checksums = map[string]string{}
+		}
+		return &GetChecksumsResult{Checksums: checksums}, err
+	case MethodMarkStep:
+		var p MarkStepParams
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, fmt.Errorf("error decoding %s params: %s", req.Method, err)
+		}
+		return struct{}{}, driver.MarkStep(&p)
+	case MethodClose:
+		return struct{}{}, driver.Close()
+	case MethodCreateHistoryTable, MethodRecordHistory, MethodLoadHistory:
+		hr, ok := driver.(HistoryRecorder)
+		if !ok {
+			return nil, fmt.Errorf("the %s method requires the %s feature", req.Method, FeatureHistory)
+		}
+		return dispatchHistory(hr, req)
+	case MethodTryLock, MethodUnlock, MethodLockStatus, MethodForceUnlock:
+		l, ok := driver.(Locker)
+		if !ok {
+			return nil, fmt.Errorf("the %s method requires the %s feature", req.Method, FeatureLocking)
+		}
+		return dispatchLocking(l, req)
+	default:
+		return nil, fmt.Errorf("unknown method: %q", req.Method)
+	}
+}
+
+func dispatchHistory(hr HistoryRecorder, req *Request) (interface{}, error) {
+	switch req.Method {
+	case MethodCreateHistoryTable:
+		return struct{}{}, hr.CreateHistoryTable()
+	case MethodRecordHistory:
+		var e HistoryEntry
+		if err := json.Unmarshal(req.Params, &e); err != nil {
+			return nil, fmt.Errorf("error decoding %s params: %s", req.Method, err)
+		}
+		return struct{}{}, hr.RecordHistory(&e)
+	default:
+		entries, err := hr.LoadHistory()
+		if err == ErrNoHistoryTable {
+			return &LoadHistoryResult{Entries: []*HistoryEntry{}}, nil
+		}
+		if entries == nil {
+			entries = []*HistoryEntry{}
+		}
+		return &LoadHistoryResult{TableExists: true, Entries: entries}, err
+	}
+}
+
+func dispatchLocking(l Locker, req *Request) (interface{}, error) {
+	switch req.Method {
+	case MethodTryLock:
+		acquired, err := l.TryLock()
+		return &TryLockResult{Acquired: acquired}, err
+	case MethodUnlock:
+		return struct{}{}, l.Unlock()
+	case MethodLockStatus:
+		holder, err := l.LockStatus()
+		return &LockStatusResult{Holder: holder}, err
+	default:
+		return struct{}{}, l.ForceUnlock()
+	}
+}
+
+func writeResponse(w io.Writer, id int64, result interface{}, reqErr error) error {
+	resp := Response{ID: id}
+	if reqErr != nil {
+		resp.Error = reqErr.Error()
+	} else {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = b
+	}
+	b, err := json.Marshal(&resp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,227 @@
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDriver struct {
+	steps  []*ExecuteStepParams
+	marked []*MarkStepParams
+	closed bool
+}
+
+func (o *testDriver) ExecuteStep(p *ExecuteStepParams) error {
+	if p.Contents == "FAIL" {
+		return errors.New("step failed")
+	}
+	o.steps = append(o.steps, p)
+	return nil
+}
+
+func (o *testDriver) CreateMigrationsTable() error {
+	return nil
+}
+
+func (o *testDriver) UpgradeMigrationsTable() error {
+	return nil
+}
+
+func (o *testDriver) GetForwardMigratedNames() ([]string, error) {
+	return nil, nil
+}
+
+func (o *testDriver) GetChecksums() (map[string]string, error) {
+	return map[string]string{"0001": "checksum"}, nil
+}
+
+func (o *testDriver) MarkStep(p *MarkStepParams) error {
+	o.marked = append(o.marked, p)
+	return nil
+}
+
+func (o *testDriver) Close() error {
+	o.closed = true
+	return nil
+}
+
+// testFeatureDriver supports the optional features.
+type testFeatureDriver struct {
+	testDriver
+	history []*HistoryEntry
+	locked  bool
+}
+
+func (o *testFeatureDriver) CreateHistoryTable() error {
+	o.history = []*HistoryEntry{}
+	return nil
+}
+
+func (o *testFeatureDriver) RecordHistory(e *HistoryEntry) error {
+	o.history = append(o.history, e)
+	return nil
+}
+
+func (o *testFeatureDriver) LoadHistory() ([]*HistoryEntry, error) {
+	if o.history == nil {
+		return nil, ErrNoHistoryTable
+	}
+	return o.history, nil
+}
+
+func (o *testFeatureDriver) TryLock() (bool, error) {
+	if o.locked {
+		return false, nil
+	}
+	o.locked = true
+	return true, nil
+}
+
+func (o *testFeatureDriver) Unlock() error {
+	o.locked = false
+	return nil
+}
+
+func (o *testFeatureDriver) LockStatus() (string, error) {
+	if o.locked {
+		return "me", nil
+	}
+	return "", nil
+}
+
+func (o *testFeatureDriver) ForceUnlock() error {
+	o.locked = false
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	serve := func(requests ...string) (*testDriver, *HandshakeParams, []string) {
+		var driver *testDriver
+		var params *HandshakeParams
+		open := func(p *HandshakeParams) (Driver, error) {
+			params = p
+			driver = &testDriver{}
+			return driver, nil
+		}
+		var out bytes.Buffer
+		err := Serve(strings.NewReader(strings.Join(requests, "\n")), &out, open)
+		require.NoError(t, err)
+		return driver, params, strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	}
+
+	t.Run("full session", func(t *testing.T) {
+		driver, params, responses := serve(
+			`{"id":1,"method":"handshake","params":{"protocol_versions":[1,2],"dsn":"my_dsn","migrations_table":"my_table"}}`,
+			`{"id":2,"method":"create_migrations_table"}`,
+			`{"id":3,"method":"execute_step","params":{"migration_name":"0001","filename":"1.fw.sql","direction":"forward","no_tx":true,"contents":"SELECT 1;\n"}}`,
+			`{"id":4,"method":"execute_step","params":{"contents":"FAIL"}}`,
+			`{"id":5,"method":"get_forward_migrated_names"}`,
+			`{"id":6,"method":"upgrade_migrations_table"}`,
+			`{"id":7,"method":"get_checksums"}`,
+			`{"id":8,"method":"mark_step","params":{"migration_name":"0002","filename":"2.fw.sql","direction":"forward"}}`,
+			`{"id":9,"method":"try_lock"}`,
+			`{"id":10,"method":"close"}`,
+			`{"id":11,"method":"ignored_after_close"}`,
+		)
+		assert.Equal(t, &HandshakeParams{
+			ProtocolVersions: []int{1, 2},
+			DSN:              "my_dsn",
+			MigrationsTable:  "my_table",
+		}, params)
+		assert.Equal(t, []*ExecuteStepParams{{
+			MigrationName: "0001",
+			Filename:      "1.fw.sql",
+			Direction:     DirectionForward,
+			NoTx:          true,
+			Contents:      "SELECT 1;\n",
+		}}, driver.steps)
+		assert.Equal(t, []*MarkStepParams{{
+			MigrationName: "0002",
+			Filename:      "2.fw.sql",
+			Direction:     DirectionForward,
+		}}, driver.marked)
+		assert.True(t, driver.closed)
+		assert.Equal(t, []string{
+			`{"id":1,"result":{"protocol_version":2}}`,
+			`{"id":2,"result":{}}`,
+			`{"id":3,"result":{}}`,
+			`{"id":4,"error":"step failed"}`,
+			`{"id":5,"result":{"names":[]}}`,
+			`{"id":6,"result":{}}`,
+			`{"id":7,"result":{"checksums":{"0001":"checksum"}}}`,
+			`{"id":8,"result":{}}`,
+			`{"id":9,"error":"the try_lock method requires the locking feature"}`,
+			`{"id":10,"result":{}}`,
+		}, responses)
+	})
+
+	t.Run("closes the driver on EOF", func(t *testing.T) {
+		driver, _, _ := serve(`{"id":1,"method":"handshake","params":{"protocol_versions":[2]}}`)
+		assert.True(t, driver.closed)
+	})
+
+	t.Run("unsupported protocol versions", func(t *testing.T) {
+		driver, _, responses := serve(`{"id":1,"method":"handshake","params":{"protocol_versions":[1,3]}}`)
+		assert.Nil(t, driver)
+		assert.Equal(t, []string{
+			`{"id":1,"error":"none of the offered protocol versions [1 3] are supported - supported versions: 2-2"}`,
+		}, responses)
+	})
+
+	t.Run("request before handshake", func(t *testing.T) {
+		_, _, responses := serve(`{"id":1,"method":"create_migrations_table"}`)
+		assert.Equal(t, []string{
+			`{"id":1,"error":"the first request has to be a handshake instead of \"create_migrations_table\""}`,
+		}, responses)
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		_, _, responses := serve(
+			`{"id":1,"method":"handshake","params":{"protocol_versions":[2]}}`,
+			`{"id":2,"method":"unknown"}`,
+		)
+		assert.Equal(t, []string{
+			`{"id":1,"result":{"protocol_version":2}}`,
+			`{"id":2,"error":"unknown method: \"unknown\""}`,
+		}, responses)
+	})
+	t.Run("optional features", func(t *testing.T) {
+		driver := &testFeatureDriver{}
+		open := func(p *HandshakeParams) (Driver, error) {
+			return driver, nil
+		}
+		requests := []string{
+			`{"id":1,"method":"handshake","params":{"protocol_versions":[2]}}`,
+			`{"id":2,"method":"load_history"}`,
+			`{"id":3,"method":"create_history_table"}`,
+			`{"id":4,"method":"record_history","params":{"id":"x","migration_name":"0001","status":"succeeded","start_time":"2020-01-02T03:04:05Z","end_time":"2020-01-02T03:04:06Z"}}`,
+			`{"id":5,"method":"load_history"}`,
+			`{"id":6,"method":"try_lock"}`,
+			`{"id":7,"method":"try_lock"}`,
+			`{"id":8,"method":"lock_status"}`,
+			`{"id":9,"method":"unlock"}`,
+			`{"id":10,"method":"force_unlock"}`,
+		}
+		var out bytes.Buffer
+		err := Serve(strings.NewReader(strings.Join(requests, "\n")), &out, open)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			`{"id":1,"result":{"protocol_version":2,"features":["history","locking"]}}`,
+			`{"id":2,"result":{"table_exists":false,"entries":[]}}`,
+			`{"id":3,"result":{}}`,
+			`{"id":4,"result":{}}`,
+			`{"id":5,"result":{"table_exists":true,"entries":[{"id":"x","migration_name":"0001","filename":"","direction":"","status":"succeeded",` +
+				`"start_time":"2020-01-02T03:04:05Z","end_time":"2020-01-02T03:04:06Z","error":"","os_user":"","hostname":"","applied_by":""}]}}`,
+			`{"id":6,"result":{"acquired":true}}`,
+			`{"id":7,"result":{"acquired":false}}`,
+			`{"id":8,"result":{"holder":"me"}}`,
+			`{"id":9,"result":{}}`,
+			`{"id":10,"result":{}}`,
+		}, strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"))
+	})
+}
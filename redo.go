@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// redoPlan returns the steps that revert the last n forward migrated
+// migrations in descending order and then forward migrate them again in
+// ascending order.
+func redoPlan(n int, ms *Migrations, forwardMigrated map[string]struct{}) ([]*Step, error) {
+	if err := checkMissingMigrationFiles(ms, forwardMigrated); err != nil {
+		return nil, err
+	}
+
+	var applied []*Migration
+	for _, m := range ms.Sorted {
+		if _, ok := forwardMigrated[m.Forward.MigrationName]; ok {
+			applied = append(applied, m)
+		}
+	}
+	if n > len(applied) {
+		return nil, fmt.Errorf("can't redo %d migrations because only %d have been forward migrated", n, len(applied))
+	}
+	redone := applied[len(applied)-n:]
+
+	steps := make([]*Step, 0, 2*n)
+	for i := len(redone) - 1; i >= 0; i-- {
+		if redone[i].Backward == nil {
+			return nil, fmt.Errorf("migration %q doesn't have a backward step", redone[i].Forward.Filename)
+		}
+		steps = append(steps, redone[i].Backward)
+	}
+	for _, m := range redone {
+		steps = append(steps, m.Forward)
+	}
+	return steps, nil
+}
+
+// withoutRedoneMigrations returns the migrations that aren't redone by the
+// steps. The redone migrations are expected to be modified so they are
+// excluded from the check of modified migrations.
+func withoutRedoneMigrations(ms *Migrations, steps []*Step) *Migrations {
+	redone := make(map[string]struct{}, len(steps))
+	for _, st := range steps {
+		redone[st.MigrationName] = struct{}{}
+	}
+	result := &Migrations{IDScheme: ms.IDScheme}
+	for _, m := range ms.Sorted {
+		if _, ok := redone[m.Forward.MigrationName]; !ok {
+			result.Sorted = append(result.Sorted, m)
+		}
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedoPlan(t *testing.T) {
+	ms, err := loadMigrationsDir("", IDSchemeSequential, ".fw", ".bw", ".nt", ".sql", func(string) []string {
+		return []string{"1.fw.sql", "2.fw.sql", "2.bw.sql", "3_x.fw.sql", "3_x.bw.sql", "4.fw.sql", "4.bw.sql"}
+	})
+	require.NoError(t, err)
+	forwardMigrated := map[string]struct{}{"0001": {}, "0002": {}, "0003_x": {}}
+
+	steps, err := redoPlan(1, ms, forwardMigrated)
+	require.NoError(t, err)
+	assert.Equal(t, []*Step{ms.Sorted[2].Backward, ms.Sorted[2].Forward}, steps)
+
+	steps, err = redoPlan(2, ms, forwardMigrated)
+	require.NoError(t, err)
+	assert.Equal(t, []*Step{
+		ms.Sorted[2].Backward,
+		ms.Sorted[1].Backward,
+		ms.Sorted[1].Forward,
+		ms.Sorted[2].Forward,
+	}, steps)
+
+	others := withoutRedoneMigrations(ms, steps)
+	assert.Equal(t, []*Migration{ms.Sorted[0], ms.Sorted[3]}, others.Sorted)
+
+	_, err = redoPlan(3, ms, forwardMigrated)
+	assert.EqualError(t, err, `migration "1.fw.sql" doesn't have a backward step`)
+	_, err = redoPlan(4, ms, forwardMigrated)
+	assert.EqualError(t, err, "can't redo 4 migrations because only 3 have been forward migrated")
+	_, err = redoPlan(1, ms, map[string]struct{}{"0005": {}})
+	assert.EqualError(t, err, `there is at least one entry in the migrations table without an existing migration file `+
+		`(examine it with the status command and remove it with the mark-unapplied command) - entry="0005"`)
+}
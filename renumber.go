@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// renumberTempSuffix is appended to the filenames during the first phase of
+// the renaming to avoid collisions between the old and new filenames.
+const renumberTempSuffix = ".renumber-tmp"
+
+// renumberGroup is a migration that is identified by its ID and description
+// because the renumber command has to handle migrations with duplicate IDs.
+type renumberGroup struct {
+	Forward  *Step
+	Backward *Step
+	Fixed    bool
+}
+
+func (o *renumberGroup) steps() []*Step {
+	steps := []*Step{o.Forward}
+	if o.Backward != nil {
+		steps = append(steps, o.Backward)
+	}
+	return steps
+}
+
+// useRenumberBase returns true if the applied migrations are specified by
+// the -base option instead of the migrations table. cmdLine contains the
+// options specified on the command line: the -base option overrides the
+// -driver and -dsn values of the environment variables and the config file.
+func useRenumberBase(base int64, driverName, dsn string, cmdLine map[string]bool) (bool, error) {
+	if base >= 0 {
+		if cmdLine["driver"] || cmdLine["dsn"] {
+			return false, errors.New("the -base option can't be used together with the -driver and -dsn options")
+		}
+		return true, nil
+	}
+	if driverName == "" && dsn == "" {
+		return false, errors.New("either the -base option or the -driver and -dsn options have to be used")
+	}
+	return false, nil
+}
+
+// renumberRename is a file rename performed by the renumber command.
+type renumberRename struct {
+	From string
+	To   string
+}
+
+// loadRenumberGroups groups the migration files by ID and description. Unlike
+// loadMigrationsDir it accepts duplicate and gapped IDs.
+func loadRenumberGroups(filenames []string, fwd, bwd, notx, ext string) ([]*renumberGroup, error) {
+	type groupKey struct {
+		ID          int64
+		Description string
+	}
+	groupMap := make(map[groupKey]*renumberGroup, len(filenames))
+	var groups []*renumberGroup
+	for _, name := range filenames {
+		parsed, err := parseFilename(name, fwd, bwd, notx, ext)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing filename %q: %s", name, err)
+		}
+
+		key := groupKey{parsed.ID, parsed.Description}
+		g, ok := groupMap[key]
+		if !ok {
+			g = &renumberGroup{}
+			groupMap[key] = g
+			groups = append(groups, g)
+		}
+		p := &g.Forward
+		if parsed.Direction == DirectionBackward {
+			p = &g.Backward
+		}
+		if *p != nil {
+			return nil, fmt.Errorf("duplicate %s migration with the same ID and description: %q and %q", parsed.Direction, (*p).Filename, name)
+		}
+		*p = &Step{
+			Filename:       name,
+			MigrationName:  IDSchemeSequential.migrationName(parsed),
+			ParsedFilename: parsed,
+		}
+	}
+
+	for _, g := range groups {
+		if g.Forward == nil {
+			return nil, fmt.Errorf("migration without forward step - %q", g.Backward.Filename)
+		}
+		if g.Backward != nil {
+			g.Backward.MigrationName = g.Forward.MigrationName
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i].Forward.ParsedFilename, groups[j].Forward.ParsedFilename
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.Description < b.Description
+	})
+	return groups, nil
+}
+
+// planRenumber returns the renames that make the IDs of the migrations
+// sequential. The fixed (applied) migrations keep their IDs so they must
+// already have the IDs 1..N. The rest of the migrations get the subsequent
+// IDs in their current order. The new IDs keep the zero-padding width of the
+// old ones.
+func planRenumber(groups []*renumberGroup) ([]*renumberRename, error) {
+	var fixed, rest []*renumberGroup
+	for _, g := range groups {
+		if g.Fixed {
+			fixed = append(fixed, g)
+		} else {
+			rest = append(rest, g)
+		}
+	}
+
+	for i, g := range fixed {
+		if g.Forward.ParsedFilename.ID != int64(i+1) {
+			return nil, fmt.Errorf("can't renumber the applied migration %q: the applied migrations must have the IDs 1..%d", g.Forward.Filename, len(fixed))
+		}
+	}
+
+	var renames []*renumberRename
+	for i, g := range rest {
+		id := int64(len(fixed) + i + 1)
+		for _, st := range g.steps() {
+			parsed := st.ParsedFilename
+			if parsed.ID == id {
+				continue
+			}
+			renames = append(renames, &renumberRename{
+				From: st.Filename,
+				To:   fmt.Sprintf("%0*d", len(parsed.IDStr), id) + st.Filename[len(parsed.IDStr):],
+			})
+		}
+	}
+	return renames, nil
+}
+
+// renameFiles performs the renames in two phases because the new filename of
+// a migration can be the old filename of another one. The new filenames are
+// checked before renaming anything and the renamed files get back their old
+// filenames if a rename fails.
+func renameFiles(dir string, renames []*renumberRename) error {
+	renamed := make(map[string]bool, len(renames))
+	for _, r := range renames {
+		renamed[r.From] = true
+	}
+	for _, r := range renames {
+		if renamed[r.To] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, r.To)); err == nil {
+			return fmt.Errorf("can't rename %q to %q: file exists", r.From, r.To)
+		}
+	}
+
+	var temp, done []*renumberRename
+	for _, r := range renames {
+		if err := os.Rename(filepath.Join(dir, r.From), filepath.Join(dir, r.From+renumberTempSuffix)); err != nil {
+			return restoreFilenames(dir, temp, done, err)
+		}
+		temp = append(temp, r)
+	}
+	for _, r := range renames {
+		if err := os.Rename(filepath.Join(dir, r.From+renumberTempSuffix), filepath.Join(dir, r.To)); err != nil {
+			return restoreFilenames(dir, temp, done, err)
+		}
+		done = append(done, r)
+	}
+	return nil
+}
+
+// restoreFilenames undoes the renames of a failed renameFiles call. The temp
+// renames have completed the first phase and the done renames have completed
+// the second phase too. It returns the error of the failed rename.
+func restoreFilenames(dir string, temp, done []*renumberRename, renameErr error) error {
+	// The new filenames are moved back to the temporary filenames first
+	// because they can be the old filenames of other migrations.
+	for _, r := range done {
+		if err := os.Rename(filepath.Join(dir, r.To), filepath.Join(dir, r.From+renumberTempSuffix)); err != nil {
+			return fmt.Errorf("%s (error restoring the old filenames: %s)", renameErr, err)
+		}
+	}
+	for _, r := range temp {
+		if err := os.Rename(filepath.Join(dir, r.From+renumberTempSuffix), filepath.Join(dir, r.From)); err != nil {
+			return fmt.Errorf("%s (error restoring the old filenames: %s)", renameErr, err)
+		}
+	}
+	return renameErr
+}
+
+// markAppliedGroups marks the forward migrated migrations as fixed.
+func markAppliedGroups(groups []*renumberGroup, forwardMigrated map[string]struct{}) error {
+	names := make(map[string]struct{}, len(groups))
+	for _, g := range groups {
+		names[g.Forward.MigrationName] = struct{}{}
+		_, g.Fixed = forwardMigrated[g.Forward.MigrationName]
+	}
+	for name := range forwardMigrated {
+		if _, ok := names[name]; !ok {
+			return fmt.Errorf("there is at least one entry in the migrations table without an existing migration file (examine it with the status command and remove it with the mark-unapplied command) - entry=%q", name)
+		}
+	}
+	return nil
+}
+
+// markBaseGroups marks the migrations with IDs not greater than base as fixed.
+func markBaseGroups(groups []*renumberGroup, base int64) {
+	for _, g := range groups {
+		g.Fixed = g.Forward.ParsedFilename.ID <= base
+	}
+}
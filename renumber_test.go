@@ -0,0 +1,181 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanRenumber(t *testing.T) {
+	mergedFilenames := []string{
+		"0001_initial.sql", "0001_initial.back.sql",
+		"0002_users.sql",
+		"0003_orders.sql", "0003_orders.back.sql",
+		"0003_items.notx.sql",
+		"05_logs.sql", "5_logs.back.sql",
+	}
+
+	load := func(t *testing.T, filenames []string) []*renumberGroup {
+		groups, err := loadRenumberGroups(filenames, "", ".back", ".notx", ".sql")
+		require.NoError(t, err)
+		return groups
+	}
+
+	t.Run("base", func(t *testing.T) {
+		groups := load(t, mergedFilenames)
+		markBaseGroups(groups, 2)
+		renames, err := planRenumber(groups)
+		require.NoError(t, err)
+		assert.Equal(t, []*renumberRename{
+			{From: "0003_orders.sql", To: "0004_orders.sql"},
+			{From: "0003_orders.back.sql", To: "0004_orders.back.sql"},
+		}, renames)
+	})
+
+	t.Run("applied", func(t *testing.T) {
+		groups := load(t, mergedFilenames)
+		err := markAppliedGroups(groups, map[string]struct{}{
+			"0001_initial": {}, "0002_users": {}, "0003_orders": {},
+		})
+		require.NoError(t, err)
+		renames, err := planRenumber(groups)
+		require.NoError(t, err)
+		assert.Equal(t, []*renumberRename{
+			{From: "0003_items.notx.sql", To: "0004_items.notx.sql"},
+		}, renames)
+	})
+
+	t.Run("gaps", func(t *testing.T) {
+		groups := load(t, []string{"1.sql", "03_x.sql", "3_x.back.sql", "7_y.sql"})
+		markBaseGroups(groups, 0)
+		renames, err := planRenumber(groups)
+		require.NoError(t, err)
+		assert.Equal(t, []*renumberRename{
+			{From: "03_x.sql", To: "02_x.sql"},
+			{From: "3_x.back.sql", To: "2_x.back.sql"},
+			{From: "7_y.sql", To: "3_y.sql"},
+		}, renames)
+	})
+
+	t.Run("applied migration without file", func(t *testing.T) {
+		groups := load(t, mergedFilenames)
+		err := markAppliedGroups(groups, map[string]struct{}{"0004_woof": {}})
+		assert.EqualError(t, err, `there is at least one entry in the migrations table without an existing migration file `+
+			`(examine it with the status command and remove it with the mark-unapplied command) - entry="0004_woof"`)
+	})
+
+	t.Run("applied migrations with gaps", func(t *testing.T) {
+		groups := load(t, mergedFilenames)
+		err := markAppliedGroups(groups, map[string]struct{}{"0001_initial": {}, "0005_logs": {}})
+		require.NoError(t, err)
+		_, err = planRenumber(groups)
+		assert.EqualError(t, err, `can't renumber the applied migration "05_logs.sql": the applied migrations must have the IDs 1..2`)
+	})
+}
+
+func TestLoadRenumberGroups(t *testing.T) {
+	_, err := loadRenumberGroups([]string{"1_x.sql", "01_x.sql"}, "", ".back", ".notx", ".sql")
+	assert.EqualError(t, err, `duplicate forward migration with the same ID and description: "1_x.sql" and "01_x.sql"`)
+
+	_, err = loadRenumberGroups([]string{"1_x.sql", "1_y.back.sql"}, "", ".back", ".notx", ".sql")
+	assert.EqualError(t, err, `migration without forward step - "1_y.back.sql"`)
+}
+
+func TestUseRenumberBase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-migrate-renumber")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "sql-migrate.toml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte("driver = \"sqlite\"\ndsn = \"db.sqlite\"\n"), 0666))
+
+	parse := func(t *testing.T, args ...string) (bool, error) {
+		fs := flag.NewFlagSet("renumber", flag.ContinueOnError)
+		driverName, dsn, _ := addDriverFlags(fs)
+		base := fs.Int64("base", -1, "")
+		parseFlags(fs, append([]string{"-config", configPath}, args...))
+		return useRenumberBase(*base, *driverName, *dsn, cmdLineFlags[fs])
+	}
+
+	t.Run("base overrides the config file", func(t *testing.T) {
+		useBase, err := parse(t, "-base", "3")
+		require.NoError(t, err)
+		assert.True(t, useBase)
+	})
+
+	t.Run("driver and dsn of the config file", func(t *testing.T) {
+		useBase, err := parse(t)
+		require.NoError(t, err)
+		assert.False(t, useBase)
+	})
+
+	t.Run("base with command line dsn", func(t *testing.T) {
+		_, err := parse(t, "-base", "3", "-dsn", "other.sqlite")
+		assert.EqualError(t, err, "the -base option can't be used together with the -driver and -dsn options")
+	})
+
+	t.Run("neither base nor driver", func(t *testing.T) {
+		_, err := useRenumberBase(-1, "", "", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestRenameFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-migrate-renumber")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, fn := range []string{"1_x.sql", "2_x.sql", "3_y.sql"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fn), []byte(fn), 0666))
+	}
+
+	// The new filename of 1_x.sql is the old filename of 2_x.sql.
+	err = renameFiles(dir, []*renumberRename{
+		{From: "1_x.sql", To: "2_x.sql"},
+		{From: "2_x.sql", To: "4_x.sql"},
+	})
+	require.NoError(t, err)
+
+	names := listMigrationsDir(dir)
+	sort.Strings(names)
+	assert.Equal(t, []string{"2_x.sql", "3_y.sql", "4_x.sql"}, names)
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "2_x.sql"))
+	require.NoError(t, err)
+	assert.Equal(t, "1_x.sql", string(contents))
+
+	t.Run("existing new filename", func(t *testing.T) {
+		err := renameFiles(dir, []*renumberRename{
+			{From: "4_x.sql", To: "5_x.sql"},
+			{From: "2_x.sql", To: "3_y.sql"},
+		})
+		assert.EqualError(t, err, `can't rename "2_x.sql" to "3_y.sql": file exists`)
+
+		names := listMigrationsDir(dir)
+		sort.Strings(names)
+		assert.Equal(t, []string{"2_x.sql", "3_y.sql", "4_x.sql"}, names)
+	})
+
+	t.Run("failed rename restores the old filenames", func(t *testing.T) {
+		err := renameFiles(dir, []*renumberRename{
+			{From: "2_x.sql", To: "4_x.sql"},
+			{From: "4_x.sql", To: "2_x.sql"},
+			{From: "3_y.sql", To: filepath.Join("missing", "5_y.sql")},
+		})
+		assert.Error(t, err)
+
+		names := listMigrationsDir(dir)
+		sort.Strings(names)
+		assert.Equal(t, []string{"2_x.sql", "3_y.sql", "4_x.sql"}, names)
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "4_x.sql"))
+		require.NoError(t, err)
+		assert.Equal(t, "2_x.sql", string(contents))
+	})
+}
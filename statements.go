@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+)
+
+// sqlSplitter splits a script into statements at the semicolons that aren't
+// inside string literals, quoted identifiers and comments. It is used by the
+// drivers of databases that can't execute multiple statements with a single
+// Exec call.
+type sqlSplitter struct {
+	// LineComments are the tokens that start a comment that lasts until
+	// the end of the line (e.g.: "--"). Block comments (/* ... */) are
+	// always recognised.
+	LineComments []string
+	// QuoteChars are the characters that start and end string literals and
+	// quoted identifiers. Inside a quoted section a doubled quote character
+	// is an escaped quote character.
+	QuoteChars string
+	// BackslashEscapes enables backslash escape sequences in quoted sections.
+	BackslashEscapes bool
+	// DollarQuotes enables string literals between $$ pairs
+	// (e.g.: CQL function bodies).
+	DollarQuotes bool
+}
+
+// Split returns the statements of the script without the terminating
+// semicolons and surrounding whitespace. Statements that contain only
+// comments and whitespace are omitted.
+func (o *sqlSplitter) Split(script string) []string {
+	var statements []string
+	start := 0
+	hasCode := false
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == ';':
+			if hasCode {
+				statements = append(statements, strings.TrimSpace(script[start:i]))
+			}
+			start = i + 1
+			hasCode = false
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += 2 + end + 1
+			}
+		case o.DollarQuotes && strings.HasPrefix(script[i:], "$$"):
+			hasCode = true
+			end := strings.Index(script[i+2:], "$$")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += 2 + end + 1
+			}
+		case o.isLineComment(script[i:]):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+			}
+		case strings.IndexByte(o.QuoteChars, c) >= 0:
+			hasCode = true
+			i = o.skipQuoted(script, i)
+		case c != ' ' && c != '\t' && c != '\r' && c != '\n':
+			hasCode = true
+		}
+	}
+
+	if hasCode {
+		statements = append(statements, strings.TrimSpace(script[start:]))
+	}
+	return statements
+}
+
+func (o *sqlSplitter) isLineComment(s string) bool {
+	for _, prefix := range o.LineComments {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipQuoted returns the index of the closing quote character of the quoted
+// section that starts at s[i]. It returns len(s)-1 if the quoted section
+// isn't terminated.
+func (o *sqlSplitter) skipQuoted(s string, i int) int {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case o.BackslashEscapes && s[j] == '\\':
+			j++
+		case s[j] == q:
+			if j+1 < len(s) && s[j+1] == q {
+				j++
+				continue
+			}
+			return j
+		}
+	}
+	return len(s) - 1
+}
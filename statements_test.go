@@ -0,0 +1,92 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLSplitter(t *testing.T) {
+	splitter := &sqlSplitter{
+		LineComments:     []string{"--", "//"},
+		QuoteChars:       "'\"`",
+		BackslashEscapes: true,
+	}
+
+	tests := []*struct {
+		name       string
+		script     string
+		statements []string
+	}{
+		{
+			name:       "empty",
+			script:     "",
+			statements: nil,
+		},
+		{
+			name:       "single statement without semicolon",
+			script:     " SELECT 1 ",
+			statements: []string{"SELECT 1"},
+		},
+		{
+			name:       "multiple statements",
+			script:     "SELECT 1;\nSELECT 2;\n\nSELECT 3",
+			statements: []string{"SELECT 1", "SELECT 2", "SELECT 3"},
+		},
+		{
+			name:       "empty statements are omitted",
+			script:     ";;SELECT 1;; ;\n",
+			statements: []string{"SELECT 1"},
+		},
+		{
+			name:       "comment-only statements are omitted",
+			script:     "-- header;\nSELECT 1;\n/* trailing; */\n// comment;",
+			statements: []string{"-- header;\nSELECT 1"},
+		},
+		{
+			name:       "semicolons in quoted sections",
+			script:     "SELECT 'a;b', \"c;d\", `e;f`; SELECT 'it''s;', 'x\\';y'",
+			statements: []string{"SELECT 'a;b', \"c;d\", `e;f`", "SELECT 'it''s;', 'x\\';y'"},
+		},
+		{
+			name:       "comment tokens in quoted sections",
+			script:     "SELECT '--', '/*'; SELECT 2",
+			statements: []string{"SELECT '--', '/*'", "SELECT 2"},
+		},
+		{
+			name:       "unterminated quoted section",
+			script:     "SELECT 1; SELECT 'a;b",
+			statements: []string{"SELECT 1", "SELECT 'a;b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.statements, splitter.Split(test.script))
+		})
+	}
+
+	t.Run("without backslash escapes", func(t *testing.T) {
+		splitter := &sqlSplitter{
+			LineComments: []string{"--"},
+			QuoteChars:   "'",
+		}
+		assert.Equal(t, []string{`SELECT 'a\'`, `SELECT 'b'`}, splitter.Split(`SELECT 'a\'; SELECT 'b'`))
+	})
+
+	t.Run("dollar quotes", func(t *testing.T) {
+		splitter := &sqlSplitter{
+			LineComments: []string{"--"},
+			QuoteChars:   "'",
+			DollarQuotes: true,
+		}
+		script := "CREATE FUNCTION f() RETURNS text LANGUAGE lua AS $$ return 'a;' $$;\nSELECT $$;$$;"
+		assert.Equal(t, []string{
+			"CREATE FUNCTION f() RETURNS text LANGUAGE lua AS $$ return 'a;' $$",
+			"SELECT $$;$$",
+		}, splitter.Split(script))
+	})
+}
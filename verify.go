@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumStatus is the result of the verification of the forward step of
+// a forward migrated migration.
+type checksumStatus int
+
+const (
+	checksumOK checksumStatus = iota
+	checksumModified
+	// checksumUnknown is the status of the steps that don't have a checksum
+	// in the migrations table.
+	checksumUnknown
+)
+
+func (o checksumStatus) String() string {
+	switch o {
+	case checksumOK:
+		return "OK"
+	case checksumModified:
+		return "MODIFIED"
+	case checksumUnknown:
+		return "UNKNOWN"
+	default:
+		return fmt.Sprintf("checksumStatus(%d)", int(o))
+	}
+}
+
+type verifiedStep struct {
+	Step   *Step
+	Status checksumStatus
+}
+
+// verifyChecksums compares the checksums stored in the migrations table with
+// the current contents of the forward steps of the forward migrated
+// migrations. The migrations that aren't in checksums are skipped.
+// The steps are read the same way as Step.ExecuteAndLog reads them.
+func verifyChecksums(ms *Migrations, checksums map[string]string, dir string, r FileReader) ([]*verifiedStep, error) {
+	var result []*verifiedStep
+	for _, m := range ms.Sorted {
+		st := m.Forward
+		stored, ok := checksums[st.MigrationName]
+		if !ok {
+			continue
+		}
+		status := checksumUnknown
+		if stored != "" {
+			contents, err := r.ReadFile(filepath.Join(dir, st.Filename))
+			if err != nil {
+				return nil, err
+			}
+			status = checksumOK
+			if checksum(contents) != stored {
+				status = checksumModified
+			}
+		}
+		result = append(result, &verifiedStep{Step: st, Status: status})
+	}
+	return result, nil
+}
+
+// modifiedFilenames returns the filenames of the modified steps.
+func modifiedFilenames(steps []*verifiedStep) []string {
+	var filenames []string
+	for _, vs := range steps {
+		if vs.Status == checksumModified {
+			filenames = append(filenames, vs.Step.Filename)
+		}
+	}
+	return filenames
+}
+
+// checkModifiedMigrations is the pre-flight check of the goto and plan
+// commands. It returns an error if a forward migrated migration has been
+// modified since its execution unless allowModified is true.
+func checkModifiedMigrations(driverName string, d Driver, ms *Migrations, dir string, r FileReader, allowModified, noDriverWarnings bool) error {
+	cl, ok := d.(ChecksumLoader)
+	if !ok {
+		if !noDriverWarnings {
+			log.Printf("Warning: the %s driver doesn't store checksums. "+
+				"Modified migration files can't be detected.", driverName)
+		}
+		return nil
+	}
+	checksums, err := cl.GetChecksums()
+	if err != nil {
+		return fmt.Errorf("error loading checksums from the migrations table: %s", err)
+	}
+	steps, err := verifyChecksums(ms, checksums, dir, r)
+	if err != nil {
+		return err
+	}
+	filenames := modifiedFilenames(steps)
+	if len(filenames) == 0 {
+		return nil
+	}
+	if allowModified {
+		log.Printf("Warning: the following forward migrated migrations have been modified since their execution: %s",
+			strings.Join(filenames, ", "))
+		return nil
+	}
+	return fmt.Errorf("the following forward migrated migrations have been modified since their execution: %s "+
+		"(examine them with the verify command or use the -allow_modified option)", strings.Join(filenames, ", "))
+}
+
+// driverChecksumLoader returns the ChecksumLoader of the driver. It exits
+// with an error if the driver doesn't store checksums.
+func driverChecksumLoader(driverName string, d Driver) ChecksumLoader {
+	cl, ok := d.(ChecksumLoader)
+	if !ok {
+		log.Printf("The %s driver doesn't store checksums.", driverName)
+		os.Exit(1)
+	}
+	return cl
+}
@@ -0,0 +1,129 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checksumLoaderDriver is a mock driver that implements the optional
+// ChecksumLoader interface.
+type checksumLoaderDriver struct {
+	*MockDriver
+	*MockChecksumLoader
+}
+
+func TestVerifyChecksums(t *testing.T) {
+	const dir = "my/dir"
+
+	newMigrations := func() *Migrations {
+		var ms Migrations
+		for _, name := range []string{"1", "2", "3"} {
+			st := newTestStep(name + ".fw.sql")
+			st.MigrationName = name
+			ms.Sorted = append(ms.Sorted, &Migration{Forward: st})
+		}
+		return &ms
+	}
+
+	t.Run("statuses", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		fileReader := NewMockFileReader(ctrl)
+		ms := newMigrations()
+
+		fileReader.EXPECT().ReadFile(filepath.Join(dir, "1.fw.sql")).Return([]byte("a"), nil)
+		fileReader.EXPECT().ReadFile(filepath.Join(dir, "2.fw.sql")).Return([]byte("b"), nil)
+
+		steps, err := verifyChecksums(ms, map[string]string{
+			"1": checksum([]byte("a")),
+			"2": checksum([]byte("modified")),
+			"3": "",
+		}, dir, fileReader)
+		require.NoError(t, err)
+		assert.Equal(t, []*verifiedStep{
+			{Step: ms.Sorted[0].Forward, Status: checksumOK},
+			{Step: ms.Sorted[1].Forward, Status: checksumModified},
+			{Step: ms.Sorted[2].Forward, Status: checksumUnknown},
+		}, steps)
+		assert.Equal(t, []string{"2.fw.sql"}, modifiedFilenames(steps))
+		ctrl.Finish()
+	})
+
+	t.Run("not forward migrated", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		fileReader := NewMockFileReader(ctrl)
+
+		steps, err := verifyChecksums(newMigrations(), map[string]string{}, dir, fileReader)
+		require.NoError(t, err)
+		assert.Empty(t, steps)
+		ctrl.Finish()
+	})
+
+	t.Run("ReadFile error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		fileReader := NewMockFileReader(ctrl)
+
+		fileReader.EXPECT().ReadFile(gomock.Any()).Return(nil, assert.AnError)
+
+		_, err := verifyChecksums(newMigrations(), map[string]string{"1": "x"}, dir, fileReader)
+		assert.Equal(t, assert.AnError, err)
+		ctrl.Finish()
+	})
+}
+
+func TestCheckModifiedMigrations(t *testing.T) {
+	const dir = "my/dir"
+	st := newTestStep("7_users.fw.sql")
+	st.MigrationName = "7_users"
+	ms := &Migrations{Sorted: []*Migration{{Forward: st}}}
+
+	newDriver := func(ctrl *gomock.Controller, stored string) (Driver, *MockFileReader) {
+		cl := NewMockChecksumLoader(ctrl)
+		cl.EXPECT().GetChecksums().Return(map[string]string{"7_users": stored}, nil)
+		fileReader := NewMockFileReader(ctrl)
+		fileReader.EXPECT().ReadFile(filepath.Join(dir, "7_users.fw.sql")).Return([]byte("CREATE TABLE users;"), nil)
+		return checksumLoaderDriver{NewMockDriver(ctrl), cl}, fileReader
+	}
+
+	t.Run("not modified", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, fileReader := newDriver(ctrl, checksum([]byte("CREATE TABLE users;")))
+
+		err := checkModifiedMigrations("my_driver", driver, ms, dir, fileReader, false, false)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, fileReader := newDriver(ctrl, checksum([]byte("CREATE TABLE people;")))
+
+		err := checkModifiedMigrations("my_driver", driver, ms, dir, fileReader, false, false)
+		assert.EqualError(t, err, "the following forward migrated migrations have been modified since their execution: 7_users.fw.sql "+
+			"(examine them with the verify command or use the -allow_modified option)")
+		ctrl.Finish()
+	})
+
+	t.Run("modified with -allow_modified", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		driver, fileReader := newDriver(ctrl, checksum([]byte("CREATE TABLE people;")))
+
+		err := checkModifiedMigrations("my_driver", driver, ms, dir, fileReader, true, false)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+
+	t.Run("driver without checksums", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+
+		err := checkModifiedMigrations("my_driver", NewMockDriver(ctrl), ms, dir, NewMockFileReader(ctrl), false, true)
+		require.NoError(t, err)
+		ctrl.Finish()
+	})
+}